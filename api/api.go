@@ -10,11 +10,30 @@
 // @BasePath /api/
 package api
 
+import "time"
+
 const (
 	BlockingStatusPath  = "/api/blocking/status"
 	BlockingEnablePath  = "/api/blocking/enable"
 	BlockingDisablePath = "/api/blocking/disable"
 	BlockingQueryPath   = "/api/query"
+	ConfigReloadPath    = "/api/config/reload"
+
+	BlockingVerdictCacheFlushPath = "/api/blocking/verdictcache/flush"
+	BlockingGlobalEnablePath      = "/api/blocking/global/enable"
+	BlockingGlobalDisablePath     = "/api/blocking/global/disable"
+	BlockingBudgetsPath           = "/api/blocking/budgets"
+	BlockingBudgetsResetPath      = "/api/blocking/budgets/reset"
+	BlockingAllowPath             = "/api/blocking/allow"
+	BlockingAllowRevokePath       = "/api/blocking/allow/revoke"
+	BlockingAllowListPath         = "/api/blocking/allow/list"
+
+	ClientsPath   = "/api/clients"
+	SchedulesPath = "/api/schedules"
+
+	ListsPath        = "/api/lists"
+	ListsRefreshPath = "/api/lists/refresh"
+	ListsSearchPath  = "/api/lists/search"
 )
 
 type QueryRequest struct {
@@ -22,6 +41,17 @@ type QueryRequest struct {
 	Query string
 	// request type (A, AAAA, ...)
 	Type string
+	// if true, the result contains a step-by-step trace of all resolvers
+	Explain bool
+}
+
+type TraceStep struct {
+	// name of the resolver
+	Resolver string `json:"resolver"`
+	// decision or action of the resolver
+	Message string `json:"message"`
+	// additional information (groups, client identifier, upstream, ...)
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 type QueryResult struct {
@@ -33,6 +63,10 @@ type QueryResult struct {
 	Response string `json:"response"`
 	// DNS return code (NOERROR, NXDOMAIN, ...)
 	ReturnCode string `json:"returnCode"`
+	// true, if the DNS server doesn't answer the query at all (for example RPZ DROP)
+	Dropped bool `json:"dropped,omitempty"`
+	// step-by-step trace of all resolvers, only in explain mode
+	Trace []TraceStep `json:"trace,omitempty"`
 }
 
 type BlockingStatus struct {
@@ -40,4 +74,152 @@ type BlockingStatus struct {
 	Enabled bool `json:"enabled"`
 	// If blocking is temporary disabled: amount of seconds until blocking will be enabled
 	AutoEnableInSec uint `json:"autoEnableInSec"`
+	// current state of the global categories
+	Global []GlobalCategoryStatus `json:"global,omitempty"`
+	// active pauses of groups, clients or categories
+	Pauses []BlockingPause `json:"pauses,omitempty"`
+}
+
+type BlockingPause struct {
+	// type of the pause: group, client or category
+	Type string `json:"type"`
+	// name of the group, client or category
+	Name string `json:"name"`
+	// amount of seconds until blocking will be enabled, 0 if the pause has no end
+	AutoEnableInSec uint `json:"autoEnableInSec"`
+}
+
+type GlobalCategoryStatus struct {
+	// name of the category
+	Category string `json:"category"`
+	// True if the category is enabled globally
+	Enabled bool `json:"enabled"`
+	// True if the configured value was changed via API
+	Runtime bool `json:"runtime"`
+	// If the change is temporary: amount of seconds until the configured value will be restored
+	AutoResetInSec uint `json:"autoResetInSec,omitempty"`
+}
+
+type Client struct {
+	// unique name of the client
+	Name string `json:"name"`
+	// MAC addresses of the client
+	MAC []string `json:"mac,omitempty"`
+	// CPE IDs of the client
+	CPEID []string `json:"cpeId,omitempty"`
+	// IP addresses of the client
+	IP []string `json:"ip,omitempty"`
+	// networks of the client in CIDR notation
+	CIDR []string `json:"cidr,omitempty"`
+	// host names of the client
+	Names []string `json:"names,omitempty"`
+	// groups of the client
+	Groups []string `json:"groups"`
+	// tags of the client
+	Tags []string `json:"tags,omitempty"`
+	// optional: block type for this client (zeroIP, nxDomain)
+	BlockType string `json:"blockType,omitempty"`
+	// True if the client was created or changed via API
+	Runtime bool `json:"runtime"`
+}
+
+type ScheduleStatus struct {
+	// name of the schedule
+	Name string `json:"name"`
+	// True if the schedule is active now
+	Active bool `json:"active"`
+	// blocking groups, which are only enforced while one of their schedules is active
+	BlockingGroups []string `json:"blockingGroups,omitempty"`
+	// cname groups, which are only enforced while one of their schedules is active
+	CnameGroups []string `json:"cnameGroups,omitempty"`
+}
+
+type BudgetStatus struct {
+	// client, which uses the budget
+	Client string `json:"client"`
+	// black list group with the budget
+	Group string `json:"group"`
+	// daily budget in seconds
+	DailySec uint `json:"dailySec"`
+	// estimated usage since the last reset in seconds
+	UsedSec uint `json:"usedSec"`
+	// remaining budget in seconds
+	RemainingSec uint `json:"remainingSec"`
+	// seconds until the next reset
+	ResetInSec uint `json:"resetInSec"`
+}
+
+type AllowGrant struct {
+	// client (name, MAC, IP or host name), for which the domain is allowed
+	Client string `json:"client"`
+	// allowed domain including its subdomains
+	Domain string `json:"domain"`
+	// seconds until the grant expires
+	ExpiresInSec uint `json:"expiresInSec"`
+}
+
+type ClientGroups struct {
+	// groups of the client
+	Groups []string `json:"groups"`
+}
+
+type ListGroupStatus struct {
+	// type of the list (blacklist or whitelist)
+	Type string `json:"type"`
+	// name of the group
+	Group string `json:"group"`
+	// number of entries in the cache of the group
+	Entries int `json:"entries"`
+	// sources of the group
+	Sources []ListSourceStatus `json:"sources"`
+}
+
+type ListSourceStatus struct {
+	// URL or file path of the source
+	Link string `json:"link"`
+	// detected format of the source (hosts, adblock, dnsmasq, unbound)
+	Format string `json:"format"`
+	// number of entries of the source
+	Entries int `json:"entries"`
+	// number of lines, which couldn't be parsed
+	InvalidLines int `json:"invalidLines"`
+	// time of the last successful refresh
+	LastRefresh *time.Time `json:"lastRefresh,omitempty"`
+	// error of the last refresh, empty if it was successful
+	LastError string `json:"lastError,omitempty"`
+}
+
+type ListSearchResult struct {
+	// searched domain
+	Domain string `json:"domain"`
+	// rules of the black and white lists, which match the domain
+	Matches []ListMatch `json:"matches"`
+	// verdict of the private DNS for each category, empty if private DNS is not used
+	PrivateDNS []CategoryVerdict `json:"privateDNS,omitempty"`
+}
+
+type ListMatch struct {
+	// type of the list (blacklist or whitelist)
+	Type string `json:"type"`
+	// name of the group
+	Group string `json:"group"`
+	// URL or file path of the source
+	Link string `json:"link"`
+	// matching entry of the source
+	Rule string `json:"rule"`
+	// kind of the match (exact, wildcard or regex)
+	Kind string `json:"kind"`
+	// if true, the rule is an exception, which excludes the domain from the matches of the group
+	Exception bool `json:"exception,omitempty"`
+}
+
+type CategoryVerdict struct {
+	// private DNS category
+	Category string `json:"category"`
+	// true, if the private DNS blocks the domain for the category
+	Blocked bool `json:"blocked"`
+	// state of the global category switch
+	GlobalEnabled bool `json:"globalEnabled"`
+	// error of the private DNS request, empty if the request was successful
+	Error string `json:"error,omitempty"`
 }
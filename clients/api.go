@@ -0,0 +1,191 @@
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/log"
+
+	"github.com/go-chi/chi"
+)
+
+// RegisterAPIEndpoints registers the REST endpoints to manage clients at runtime
+func (r *Registry) RegisterAPIEndpoints(router chi.Router) {
+	router.Get(api.ClientsPath, r.apiClientsList)
+	router.Post(api.ClientsPath, r.apiClientsPut)
+	router.Delete(api.ClientsPath+"/{name}", r.apiClientsRemove)
+	router.Put(api.ClientsPath+"/{name}/groups", r.apiClientsAssign)
+}
+
+// apiClientsList is the http endpoint to list all clients
+// @Summary List clients
+// @Description returns all configured clients and clients created via API
+// @Tags clients
+// @Produce  json
+// @Success 200 {array} api.Client "all clients sorted by name"
+// @Router /clients [get]
+func (r *Registry) apiClientsList(rw http.ResponseWriter, _ *http.Request) {
+	result := make([]api.Client, 0)
+	for _, c := range r.Clients() {
+		result = append(result, ToAPI(c))
+	}
+
+	writeJSON(rw, result)
+}
+
+// apiClientsPut is the http endpoint to create or replace a client
+// @Summary Create or replace client
+// @Description creates the client or replaces an existing client with the same name
+// @Tags clients
+// @Accept  json
+// @Produce  json
+// @Param client body api.Client true "client"
+// @Success 200 {object} api.Client "created client"
+// @Failure 400 "client is invalid"
+// @Router /clients [post]
+func (r *Registry) apiClientsPut(rw http.ResponseWriter, req *http.Request) {
+	var client api.Client
+
+	if err := json.NewDecoder(req.Body).Decode(&client); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cfg, err := FromAPI(client)
+	if err == nil {
+		err = config.ValidateClient(client.Name, &cfg)
+	}
+
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Logger.Infof("setting client '%s'...", client.Name)
+
+	c, err := r.Put(client.Name, cfg)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(rw, ToAPI(c))
+}
+
+// apiClientsRemove is the http endpoint to remove a client
+// @Summary Remove client
+// @Description removes the client, also if it is defined in the configuration
+// @Tags clients
+// @Param name path string true "name of the client"
+// @Success 200 "client is removed"
+// @Failure 404 "client does not exist"
+// @Router /clients/{name} [delete]
+func (r *Registry) apiClientsRemove(rw http.ResponseWriter, req *http.Request) {
+	name := chi.URLParam(req, "name")
+
+	log.Logger.Infof("removing client '%s'...", name)
+
+	writeError(rw, r.Remove(name))
+}
+
+// apiClientsAssign is the http endpoint to assign groups to a client
+// @Summary Assign groups
+// @Description replaces the groups of the client
+// @Tags clients
+// @Accept  json
+// @Produce  json
+// @Param name path string true "name of the client"
+// @Param groups body api.ClientGroups true "new groups of the client"
+// @Success 200 {object} api.Client "changed client"
+// @Failure 404 "client does not exist"
+// @Router /clients/{name}/groups [put]
+func (r *Registry) apiClientsAssign(rw http.ResponseWriter, req *http.Request) {
+	name := chi.URLParam(req, "name")
+
+	var groups api.ClientGroups
+
+	if err := json.NewDecoder(req.Body).Decode(&groups); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Logger.Infof("assigning groups %v to client '%s'...", groups.Groups, name)
+
+	c, err := r.Assign(name, groups.Groups)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	writeJSON(rw, ToAPI(c))
+}
+
+// ToAPI converts the client to its API representation
+func ToAPI(c *Client) api.Client {
+	cfg := c.Config()
+	result := api.Client{
+		Name:      c.Name,
+		MAC:       cfg.MAC,
+		CPEID:     cfg.CPEID,
+		CIDR:      cfg.CIDR,
+		Names:     cfg.Name,
+		Groups:    cfg.Groups,
+		Tags:      cfg.Tags,
+		BlockType: cfg.BlockType,
+		Runtime:   c.Runtime,
+	}
+
+	for _, ip := range cfg.IP {
+		result.IP = append(result.IP, ip.String())
+	}
+
+	return result
+}
+
+// FromAPI converts the API representation to the client configuration
+func FromAPI(c api.Client) (config.ClientConfig, error) {
+	result := config.ClientConfig{
+		MAC:       c.MAC,
+		CPEID:     c.CPEID,
+		CIDR:      c.CIDR,
+		Name:      c.Names,
+		Groups:    c.Groups,
+		Tags:      c.Tags,
+		BlockType: c.BlockType,
+	}
+
+	for _, s := range c.IP {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return result, fmt.Errorf("client '%s' has invalid ip '%s'", c.Name, s)
+		}
+
+		result.IP = append(result.IP, ip)
+	}
+
+	return result, nil
+}
+
+func writeError(rw http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrUnknownClient):
+		http.Error(rw, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	response, _ := json.Marshal(v)
+	rw.Header().Set("Content-Type", "application/json")
+
+	if _, err := rw.Write(response); err != nil {
+		log.Logger.Error("unable to write response ", err)
+	}
+}
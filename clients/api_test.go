@@ -0,0 +1,79 @@
+package clients
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Clients API", func() {
+	var (
+		router *chi.Mux
+		sut    *Registry
+	)
+
+	BeforeEach(func() {
+		var err error
+		sut, err = NewRegistry(map[string]config.ClientConfig{
+			"tablet": {MAC: []string{"aa:bb:cc:dd:ee:ff"}, Groups: []string{"kids"}},
+		}, nil)
+		Expect(err).Should(Succeed())
+
+		router = chi.NewRouter()
+		sut.RegisterAPIEndpoints(router)
+	})
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	It("should list, add, assign and remove clients", func() {
+		rr := call(http.MethodPost, api.ClientsPath, `{"name":"laptop","ip":["192.168.178.29"],"groups":["adults"]}`)
+		Expect(rr.Code).Should(Equal(http.StatusOK))
+
+		rr = call(http.MethodPut, api.ClientsPath+"/tablet/groups", `{"groups":["kids","music"]}`)
+		Expect(rr.Code).Should(Equal(http.StatusOK))
+
+		rr = call(http.MethodGet, api.ClientsPath, "")
+		Expect(rr.Code).Should(Equal(http.StatusOK))
+
+		var result []api.Client
+		Expect(json.NewDecoder(rr.Body).Decode(&result)).Should(Succeed())
+		Expect(result).Should(HaveLen(2))
+		Expect(result[0].Name).Should(Equal("laptop"))
+		Expect(result[0].IP).Should(Equal([]string{"192.168.178.29"}))
+		Expect(result[1].Groups).Should(Equal([]string{"kids", "music"}))
+		Expect(result[1].Runtime).Should(BeTrue())
+
+		rr = call(http.MethodDelete, api.ClientsPath+"/laptop", "")
+		Expect(rr.Code).Should(Equal(http.StatusOK))
+		Expect(sut.Clients()).Should(HaveLen(1))
+	})
+
+	It("should reject invalid clients", func() {
+		Expect(call(http.MethodPost, api.ClientsPath, `{"name":"laptop","groups":["adults"]}`).Code).
+			Should(Equal(http.StatusBadRequest))
+		Expect(call(http.MethodPost, api.ClientsPath, `{"name":"laptop","ip":["x"]}`).Code).
+			Should(Equal(http.StatusBadRequest))
+		Expect(call(http.MethodPost, api.ClientsPath, `no json`).Code).
+			Should(Equal(http.StatusBadRequest))
+	})
+
+	It("should return not found for unknown clients", func() {
+		Expect(call(http.MethodDelete, api.ClientsPath+"/unknown", "").Code).Should(Equal(http.StatusNotFound))
+		Expect(call(http.MethodPut, api.ClientsPath+"/unknown/groups", `{"groups":[]}`).Code).
+			Should(Equal(http.StatusNotFound))
+	})
+})
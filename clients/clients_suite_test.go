@@ -0,0 +1,16 @@
+package clients
+
+import (
+	"testing"
+
+	"github.com/stgnet/blocky/log"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestClients(t *testing.T) {
+	log.NewLogger("Warn", "text")
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Clients Suite")
+}
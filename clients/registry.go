@@ -0,0 +1,459 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/log"
+	"github.com/stgnet/blocky/state"
+)
+
+// Selector describes, how a client was identified. The order of the constants is the precedence of the lookup
+type Selector string
+
+const (
+	SelectorMAC   Selector = "mac"
+	SelectorCPEID Selector = "cpeId"
+	SelectorIP    Selector = "ip"
+	SelectorCIDR  Selector = "cidr"
+	SelectorName  Selector = "name"
+)
+
+// Client is a known client with its selectors, groups and settings
+type Client struct {
+	Name      string
+	MACs      []net.HardwareAddr
+	CPEIDs    []string
+	IPs       []net.IP
+	CIDRs     []*net.IPNet
+	Names     []string
+	Groups    []string
+	Tags      []string
+	BlockType string
+	// Runtime is true if the client was created or changed via API
+	Runtime bool
+
+	cfg config.ClientConfig
+}
+
+// ErrUnknownClient is returned, if a client should be changed, which does not exist
+var ErrUnknownClient = errors.New("unknown client")
+
+// stateSection is the section of the state file with runtime changes of clients
+const stateSection = "clients"
+
+// runtimeClients contains all changes of clients via API, they are applied on top of the configured clients
+type runtimeClients struct {
+	Clients map[string]config.ClientConfig `json:"clients,omitempty"`
+	Removed []string                       `json:"removed,omitempty"`
+}
+
+// clone returns a copy, which can be changed without affecting the original
+func (rc runtimeClients) clone() runtimeClients {
+	result := runtimeClients{
+		Clients: make(map[string]config.ClientConfig, len(rc.Clients)),
+		Removed: append([]string(nil), rc.Removed...),
+	}
+
+	for name, cfg := range rc.Clients {
+		result.Clients[name] = cfg
+	}
+
+	return result
+}
+
+// Identity contains everything known about the client of a query
+type Identity struct {
+	IP    net.IP
+	Names []string
+	MAC   net.HardwareAddr
+	CPEID string
+}
+
+// Registry contains all known clients and finds the client of a query
+type Registry struct {
+	lock       sync.RWMutex
+	configured map[string]*Client
+	clients    map[string]*Client
+	runtime    runtimeClients
+	store      *state.Store
+
+	byMAC   map[string]*Client
+	byCPEID map[string]*Client
+	byIP    map[string]*Client
+	byName  map[string]*Client
+	cidrs   []cidrEntry
+}
+
+type cidrEntry struct {
+	net    *net.IPNet
+	client *Client
+}
+
+// NewClient creates a client from its configuration
+func NewClient(name string, cfg config.ClientConfig) (*Client, error) {
+	if err := config.ValidateClient(name, &cfg); err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Name:      name,
+		CPEIDs:    cfg.CPEID,
+		IPs:       cfg.IP,
+		Names:     cfg.Name,
+		Groups:    cfg.Groups,
+		Tags:      cfg.Tags,
+		BlockType: cfg.BlockType,
+		cfg:       cfg,
+	}
+
+	for _, m := range cfg.MAC {
+		mac, _ := net.ParseMAC(m)
+		c.MACs = append(c.MACs, mac)
+	}
+
+	for _, cidr := range cfg.CIDR {
+		_, n, _ := net.ParseCIDR(cidr)
+		c.CIDRs = append(c.CIDRs, n)
+	}
+
+	return c, nil
+}
+
+// Config returns the configuration of the client
+func (c *Client) Config() config.ClientConfig {
+	return c.cfg
+}
+
+// NewRegistry creates a registry with the configured clients. Runtime changes from the store (can be nil)
+// are applied on top of the configured clients
+func NewRegistry(cfg map[string]config.ClientConfig, store *state.Store) (*Registry, error) {
+	r := &Registry{
+		configured: make(map[string]*Client, len(cfg)),
+		store:      store,
+	}
+
+	for name, clientCfg := range cfg {
+		c, err := NewClient(name, clientCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		r.configured[name] = c
+	}
+
+	if store.Path() == "" {
+		log.Logger.Warn("no stateFile configured, changes of clients via API are lost on restart")
+	}
+
+	var runtime runtimeClients
+	if _, err := store.Load(stateSection, &runtime); err != nil {
+		return nil, err
+	}
+
+	if err := r.apply(runtime); err != nil {
+		return nil, fmt.Errorf("invalid client in state file '%s': %w", store.Path(), err)
+	}
+
+	return r, nil
+}
+
+// TakeOver continues the runtime changes of the registry, which is replaced on config reload. Without state file,
+// they would be lost otherwise. The changes are applied on top of the configured clients of this registry
+func (r *Registry) TakeOver(old *Registry) error {
+	old.lock.RLock()
+	runtime := old.runtime.clone()
+	old.lock.RUnlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.apply(runtime)
+}
+
+// apply must be called with write lock or before the registry is shared, it creates the clients from the configured
+// clients with the runtime changes on top
+func (r *Registry) apply(runtime runtimeClients) error {
+	if runtime.Clients == nil {
+		runtime.Clients = make(map[string]config.ClientConfig)
+	}
+
+	result := make(map[string]*Client, len(r.configured)+len(runtime.Clients))
+	for name, c := range r.configured {
+		result[name] = c
+	}
+
+	for _, name := range runtime.Removed {
+		delete(result, name)
+	}
+
+	for name, clientCfg := range runtime.Clients {
+		c, err := NewClient(name, clientCfg)
+		if err != nil {
+			return err
+		}
+
+		c.Runtime = true
+		result[name] = c
+	}
+
+	r.clients = result
+	r.runtime = runtime
+	r.rebuildIndex()
+
+	return nil
+}
+
+// Put creates the client or replaces an existing client with the same name. The change is persisted
+func (r *Registry) Put(name string, cfg config.ClientConfig) (*Client, error) {
+	c, err := NewClient(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.put(c)
+}
+
+// put must be called with write lock, it stores the client as runtime client
+func (r *Registry) put(c *Client) (*Client, error) {
+	c.Runtime = true
+
+	runtime := r.runtime.clone()
+	runtime.Clients[c.Name] = c.Config()
+	runtime.Removed = removeString(runtime.Removed, c.Name)
+
+	if err := r.commit(runtime); err != nil {
+		return nil, err
+	}
+
+	r.clients[c.Name] = c
+	r.rebuildIndex()
+
+	return c, nil
+}
+
+// Assign replaces the groups of an existing client. The change is persisted
+func (r *Registry) Assign(name string, groups []string) (*Client, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	existing, found := r.clients[name]
+	if !found {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownClient, name)
+	}
+
+	cfg := existing.Config()
+	cfg.Groups = groups
+
+	c, err := NewClient(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.put(c)
+}
+
+// Remove deletes the client, also if it was defined in the configuration. The change is persisted
+func (r *Registry) Remove(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.clients[name]; !found {
+		return fmt.Errorf("%w '%s'", ErrUnknownClient, name)
+	}
+
+	runtime := r.runtime.clone()
+	delete(runtime.Clients, name)
+	runtime.Removed = append(removeString(runtime.Removed, name), name)
+
+	if err := r.commit(runtime); err != nil {
+		return err
+	}
+
+	delete(r.clients, name)
+	r.rebuildIndex()
+
+	return nil
+}
+
+// commit must be called with write lock, it persists the changed runtime clients and takes them over only if
+// they were saved. The caller applies the change to the clients afterwards
+func (r *Registry) commit(runtime runtimeClients) error {
+	if err := r.store.Save(stateSection, runtime); err != nil {
+		return err
+	}
+
+	r.runtime = runtime
+
+	return nil
+}
+
+func removeString(values []string, value string) (result []string) {
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+
+	return
+}
+
+// rebuildIndex must be called with write lock or before the registry is shared
+func (r *Registry) rebuildIndex() {
+	r.byMAC = make(map[string]*Client)
+	r.byCPEID = make(map[string]*Client)
+	r.byIP = make(map[string]*Client)
+	r.byName = make(map[string]*Client)
+	r.cidrs = nil
+
+	for _, c := range r.sortedClients() {
+		for _, mac := range c.MACs {
+			r.byMAC[mac.String()] = c
+		}
+
+		for _, id := range c.CPEIDs {
+			r.byCPEID[id] = c
+		}
+
+		for _, ip := range c.IPs {
+			r.byIP[ip.String()] = c
+		}
+
+		for _, name := range c.Names {
+			r.byName[strings.ToLower(name)] = c
+		}
+
+		for _, n := range c.CIDRs {
+			r.cidrs = append(r.cidrs, cidrEntry{net: n, client: c})
+		}
+	}
+
+	// most specific network first
+	sort.SliceStable(r.cidrs, func(i, j int) bool {
+		onesI, _ := r.cidrs[i].net.Mask.Size()
+		onesJ, _ := r.cidrs[j].net.Mask.Size()
+
+		return onesI > onesJ
+	})
+}
+
+func (r *Registry) sortedClients() []*Client {
+	result := make([]*Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		result = append(result, c)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// Lookup returns the client of the identity and the selector, which matched. The precedence is:
+// MAC, CPE ID, IP, CIDR (most specific network first), client name. Returns nil if no client matches
+func (r *Registry) Lookup(id Identity) (*Client, Selector) {
+	if r == nil {
+		return nil, ""
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if id.MAC != nil {
+		if c, found := r.byMAC[id.MAC.String()]; found {
+			return c, SelectorMAC
+		}
+	}
+
+	if id.CPEID != "" {
+		if c, found := r.byCPEID[id.CPEID]; found {
+			return c, SelectorCPEID
+		}
+	}
+
+	if id.IP != nil {
+		if c, found := r.byIP[id.IP.String()]; found {
+			return c, SelectorIP
+		}
+
+		for _, e := range r.cidrs {
+			if e.net.Contains(id.IP) {
+				return e.client, SelectorCIDR
+			}
+		}
+	}
+
+	for _, name := range id.Names {
+		if c, found := r.byName[strings.ToLower(name)]; found {
+			return c, SelectorName
+		}
+	}
+
+	return nil, ""
+}
+
+// Clients returns all clients sorted by name
+func (r *Registry) Clients() []*Client {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.sortedClients()
+}
+
+// Configuration returns the clients with their selectors and groups
+func (r *Registry) Configuration() (result []string) {
+	for _, c := range r.Clients() {
+		source := ""
+		if c.Runtime {
+			source = " (runtime)"
+		}
+
+		result = append(result, fmt.Sprintf("%s%s = groups %v, tags %v, selectors %s",
+			c.Name, source, c.Groups, c.Tags, c.selectors()))
+	}
+
+	if len(result) == 0 {
+		result = []string{"no clients defined"}
+	}
+
+	return
+}
+
+func (c *Client) selectors() string {
+	var parts []string
+
+	for _, mac := range c.MACs {
+		parts = append(parts, fmt.Sprintf("%s:%s", SelectorMAC, mac))
+	}
+
+	for _, id := range c.CPEIDs {
+		parts = append(parts, fmt.Sprintf("%s:%s", SelectorCPEID, id))
+	}
+
+	for _, ip := range c.IPs {
+		parts = append(parts, fmt.Sprintf("%s:%s", SelectorIP, ip))
+	}
+
+	for _, n := range c.CIDRs {
+		parts = append(parts, fmt.Sprintf("%s:%s", SelectorCIDR, n))
+	}
+
+	for _, name := range c.Names {
+		parts = append(parts, fmt.Sprintf("%s:%s", SelectorName, name))
+	}
+
+	return strings.Join(parts, ", ")
+}
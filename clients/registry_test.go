@@ -0,0 +1,224 @@
+package clients
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/state"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var sut *Registry
+
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+
+	BeforeEach(func() {
+		var err error
+		sut, err = NewRegistry(map[string]config.ClientConfig{
+			"tablet": {
+				MAC:    []string{"aa:bb:cc:dd:ee:ff"},
+				Groups: []string{"kids"},
+				Tags:   []string{"mobile"},
+			},
+			"router": {
+				CPEID:  []string{"cpe-1234"},
+				Groups: []string{"router"},
+			},
+			"laptop": {
+				IP:     []net.IP{net.ParseIP("192.168.178.29")},
+				Name:   []string{"Laptop.fritz.box"},
+				Groups: []string{"adults"},
+			},
+			"guests": {
+				CIDR:   []string{"192.168.0.0/16"},
+				Groups: []string{"guests"},
+			},
+			"iot": {
+				CIDR:   []string{"192.168.100.0/24"},
+				Groups: []string{"iot"},
+			},
+		}, nil)
+		Expect(err).Should(Succeed())
+	})
+
+	DescribeTable("Lookup of clients",
+		func(id Identity, expectedClient string, expectedSelector Selector) {
+			client, selector := sut.Lookup(id)
+
+			if expectedClient == "" {
+				Expect(client).Should(BeNil())
+			} else {
+				Expect(client).ShouldNot(BeNil())
+				Expect(client.Name).Should(Equal(expectedClient))
+			}
+
+			Expect(selector).Should(Equal(expectedSelector))
+		},
+		Entry("MAC has precedence over IP",
+			Identity{MAC: mac, IP: net.ParseIP("192.168.178.29")}, "tablet", SelectorMAC),
+		Entry("CPE ID has precedence over IP",
+			Identity{CPEID: "cpe-1234", IP: net.ParseIP("192.168.178.29")}, "router", SelectorCPEID),
+		Entry("IP has precedence over CIDR",
+			Identity{IP: net.ParseIP("192.168.178.29")}, "laptop", SelectorIP),
+		Entry("most specific CIDR",
+			Identity{IP: net.ParseIP("192.168.100.5")}, "iot", SelectorCIDR),
+		Entry("less specific CIDR",
+			Identity{IP: net.ParseIP("192.168.5.5")}, "guests", SelectorCIDR),
+		Entry("name is case insensitive",
+			Identity{IP: net.ParseIP("10.0.0.1"), Names: []string{"laptop.FRITZ.box"}}, "laptop", SelectorName),
+		Entry("unknown client",
+			Identity{IP: net.ParseIP("10.0.0.1"), Names: []string{"unknown"}}, "", Selector("")),
+	)
+
+	When("registry is nil", func() {
+		It("should not find clients", func() {
+			var registry *Registry
+
+			client, _ := registry.Lookup(Identity{MAC: mac})
+			Expect(client).Should(BeNil())
+			Expect(registry.Clients()).Should(BeEmpty())
+		})
+	})
+
+	When("client has no selector", func() {
+		It("should return error", func() {
+			_, err := NewRegistry(map[string]config.ClientConfig{"tablet": {Groups: []string{"kids"}}}, nil)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("at least one selector"))
+		})
+	})
+
+	It("should return configuration sorted by client name", func() {
+		cfg := sut.Configuration()
+
+		Expect(cfg).Should(HaveLen(5))
+		Expect(cfg[0]).Should(HavePrefix("guests = groups [guests]"))
+		Expect(cfg[4]).Should(Equal("tablet = groups [kids], tags [mobile], selectors mac:aa:bb:cc:dd:ee:ff"))
+	})
+
+	Describe("runtime changes", func() {
+		var (
+			dir   string
+			store *state.Store
+			cfg   map[string]config.ClientConfig
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "clients")
+			Expect(err).Should(Succeed())
+
+			store = state.NewStore(filepath.Join(dir, "state.json"))
+			cfg = map[string]config.ClientConfig{
+				"tablet": {MAC: []string{"aa:bb:cc:dd:ee:ff"}, Groups: []string{"kids"}},
+			}
+			sut, err = NewRegistry(cfg, store)
+			Expect(err).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(dir)
+		})
+
+		It("should apply changes immediately and keep them after restart", func() {
+			_, err := sut.Put("phone", config.ClientConfig{MAC: []string{"11:22:33:44:55:66"}, Groups: []string{"adults"}})
+			Expect(err).Should(Succeed())
+
+			c, err := sut.Assign("tablet", []string{"adults"})
+			Expect(err).Should(Succeed())
+			Expect(c.Runtime).Should(BeTrue())
+
+			phoneMAC, _ := net.ParseMAC("11:22:33:44:55:66")
+			client, _ := sut.Lookup(Identity{MAC: phoneMAC})
+			Expect(client.Name).Should(Equal("phone"))
+
+			client, _ = sut.Lookup(Identity{MAC: mac})
+			Expect(client.Groups).Should(Equal([]string{"adults"}))
+
+			restarted, err := NewRegistry(cfg, store)
+			Expect(err).Should(Succeed())
+			Expect(restarted.Clients()).Should(HaveLen(2))
+
+			client, _ = restarted.Lookup(Identity{MAC: mac})
+			Expect(client.Groups).Should(Equal([]string{"adults"}))
+		})
+
+		It("should remove configured clients permanently", func() {
+			Expect(sut.Remove("tablet")).Should(Succeed())
+
+			client, _ := sut.Lookup(Identity{MAC: mac})
+			Expect(client).Should(BeNil())
+
+			restarted, err := NewRegistry(cfg, store)
+			Expect(err).Should(Succeed())
+			Expect(restarted.Clients()).Should(BeEmpty())
+
+			_, err = restarted.Put("tablet", cfg["tablet"])
+			Expect(err).Should(Succeed())
+
+			restarted, err = NewRegistry(cfg, store)
+			Expect(err).Should(Succeed())
+			Expect(restarted.Clients()).Should(HaveLen(1))
+		})
+
+		It("should reject changes of unknown clients", func() {
+			_, err := sut.Assign("unknown", []string{"kids"})
+			Expect(errors.Is(err, ErrUnknownClient)).Should(BeTrue())
+			Expect(errors.Is(sut.Remove("unknown"), ErrUnknownClient)).Should(BeTrue())
+		})
+
+		It("should reject invalid clients", func() {
+			_, err := sut.Put("phone", config.ClientConfig{MAC: []string{"invalid"}})
+			Expect(err).Should(HaveOccurred())
+			Expect(sut.Clients()).Should(HaveLen(1))
+		})
+
+		It("should keep the changes on reload without state file", func() {
+			sut, err := NewRegistry(cfg, state.NewStore(""))
+			Expect(err).Should(Succeed())
+
+			_, err = sut.Put("phone", config.ClientConfig{MAC: []string{"11:22:33:44:55:66"}, Groups: []string{"adults"}})
+			Expect(err).Should(Succeed())
+			Expect(sut.Remove("tablet")).Should(Succeed())
+
+			reloaded, err := NewRegistry(cfg, state.NewStore(""))
+			Expect(err).Should(Succeed())
+			Expect(reloaded.TakeOver(sut)).Should(Succeed())
+
+			Expect(reloaded.Clients()).Should(HaveLen(1))
+
+			phoneMAC, _ := net.ParseMAC("11:22:33:44:55:66")
+			client, _ := reloaded.Lookup(Identity{MAC: phoneMAC})
+			Expect(client.Name).Should(Equal("phone"))
+			Expect(client.Runtime).Should(BeTrue())
+		})
+
+		It("should keep the clients unchanged if the change can't be saved", func() {
+			// the directory of the state file is missing, save fails
+			Expect(os.RemoveAll(dir)).Should(Succeed())
+
+			_, err := sut.Put("phone", config.ClientConfig{MAC: []string{"11:22:33:44:55:66"}})
+			Expect(err).Should(HaveOccurred())
+
+			_, err = sut.Assign("tablet", []string{"adults"})
+			Expect(err).Should(HaveOccurred())
+			Expect(sut.Remove("tablet")).ShouldNot(Succeed())
+
+			Expect(sut.Clients()).Should(HaveLen(1))
+			Expect(sut.runtime.Clients).Should(BeEmpty())
+			Expect(sut.runtime.Removed).Should(BeEmpty())
+
+			client, _ := sut.Lookup(Identity{MAC: mac})
+			Expect(client.Groups).Should(Equal([]string{"kids"}))
+			Expect(client.Runtime).Should(BeFalse())
+		})
+	})
+})
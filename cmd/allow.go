@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/log"
+
+	"github.com/spf13/cobra"
+)
+
+//nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(allowCmd)
+
+	allowCmd.Flags().String("client", "", "client (name, MAC, IP or host name)")
+	allowCmd.Flags().Duration("for", 30*time.Minute, "duration of the grant")
+	_ = allowCmd.MarkFlagRequired("client")
+
+	allowCmd.AddCommand(&cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		Short:   "Print all active allow grants",
+		Run:     listGrants,
+	})
+
+	revokeCommand := &cobra.Command{
+		Use:   "revoke <domain>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Revoke the allow grant of a domain for a client",
+		Run:   revokeGrant,
+	}
+	revokeCommand.Flags().String("client", "", "client (name, MAC, IP or host name)")
+	_ = revokeCommand.MarkFlagRequired("client")
+	allowCmd.AddCommand(revokeCommand)
+}
+
+//nolint:gochecknoglobals
+var allowCmd = &cobra.Command{
+	Use:   "allow <domain>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Allow a blocked domain for one client for a certain duration",
+	Run:   allowDomain,
+}
+
+func allowDomain(cmd *cobra.Command, args []string) {
+	client, _ := cmd.Flags().GetString("client")
+	duration, _ := cmd.Flags().GetDuration("for")
+
+	query := url.Values{}
+	query.Set("domain", args[0])
+	query.Set("client", client)
+	query.Set("duration", duration.String())
+
+	resp := apiRequest(http.MethodGet, fmt.Sprintf("%s?%s", apiURL(api.BlockingAllowPath), query.Encode()), nil)
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	log.Logger.Info("OK")
+}
+
+func revokeGrant(cmd *cobra.Command, args []string) {
+	client, _ := cmd.Flags().GetString("client")
+
+	query := url.Values{}
+	query.Set("domain", args[0])
+	query.Set("client", client)
+
+	resp := apiRequest(http.MethodGet, fmt.Sprintf("%s?%s", apiURL(api.BlockingAllowRevokePath), query.Encode()),
+		nil)
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	log.Logger.Info("OK")
+}
+
+func listGrants(_ *cobra.Command, _ []string) {
+	resp := apiRequest(http.MethodGet, apiURL(api.BlockingAllowListPath), nil)
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var result []api.AllowGrant
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Logger.Fatal("can't read response: ", err)
+		return
+	}
+
+	if len(result) == 0 {
+		log.Logger.Info("no active allow grants")
+		return
+	}
+
+	for _, g := range result {
+		log.Logger.Infof("%s allowed for client '%s' for %d seconds", g.Domain, g.Client, g.ExpiresInSec)
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/stgnet/blocky/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Allow command", func() {
+	var (
+		ts          *httptest.Server
+		mockFn      func(w http.ResponseWriter, r *http.Request)
+		lastRequest *http.Request
+	)
+	JustBeforeEach(func() {
+		ts = testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+			lastRequest = r
+			mockFn(w, r)
+		})
+	})
+	JustAfterEach(func() {
+		ts.Close()
+	})
+	BeforeEach(func() {
+		fatal = false
+		mockFn = func(w http.ResponseWriter, _ *http.Request) {}
+	})
+	Describe("allow domain", func() {
+		It("should create the grant for the client", func() {
+			Expect(allowCmd.Flags().Set("client", "aa:bb:cc:dd:ee:ff")).Should(Succeed())
+			Expect(allowCmd.Flags().Set("for", "1h")).Should(Succeed())
+
+			allowDomain(allowCmd, []string{"example.com"})
+			Expect(fatal).Should(BeFalse())
+			Expect(lastRequest.URL.Path).Should(Equal(api.BlockingAllowPath))
+			Expect(lastRequest.URL.Query().Get("domain")).Should(Equal("example.com"))
+			Expect(lastRequest.URL.Query().Get("client")).Should(Equal("aa:bb:cc:dd:ee:ff"))
+			Expect(lastRequest.URL.Query().Get("duration")).Should(Equal("1h0m0s"))
+			Expect(loggerHook.LastEntry().Message).Should(Equal("OK"))
+		})
+	})
+	Describe("list grants", func() {
+		BeforeEach(func() {
+			mockFn = func(w http.ResponseWriter, _ *http.Request) {
+				response, _ := json.Marshal([]api.AllowGrant{{Client: "tablet", Domain: "example.com", ExpiresInSec: 60}})
+				_, _ = w.Write(response)
+			}
+		})
+		It("should print all grants", func() {
+			listGrants(allowCmd, []string{})
+			Expect(fatal).Should(BeFalse())
+			Expect(loggerHook.LastEntry().Message).
+				Should(Equal("example.com allowed for client 'tablet' for 60 seconds"))
+		})
+	})
+	Describe("revoke grant", func() {
+		BeforeEach(func() {
+			mockFn = func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "unknown grant for domain 'example.com' and client 'tablet'", http.StatusNotFound)
+			}
+		})
+		It("should end with error for unknown grant", func() {
+			cmd, _, _ := allowCmd.Find([]string{"revoke"})
+			Expect(cmd.Flags().Set("client", "tablet")).Should(Succeed())
+
+			revokeGrant(cmd, []string{"example.com"})
+			Expect(fatal).Should(BeTrue())
+			Expect(lastRequest.URL.Path).Should(Equal(api.BlockingAllowRevokePath))
+			Expect(loggerHook.LastEntry().Message).
+				Should(Equal("NOK: 404 Not Found unknown grant for domain 'example.com' and client 'tablet'"))
+		})
+	})
+})
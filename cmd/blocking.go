@@ -3,7 +3,10 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/stgnet/blocky/api"
 
@@ -16,13 +19,15 @@ import (
 func init() {
 	rootCmd.AddCommand(blockingCmd)
 
-	blockingCmd.AddCommand(&cobra.Command{
+	enableCommand := &cobra.Command{
 		Use:     "enable",
 		Args:    cobra.NoArgs,
 		Aliases: []string{"on"},
 		Short:   "Enable blocking",
 		Run:     enableBlocking,
-	})
+	}
+	addPauseFlags(enableCommand)
+	blockingCmd.AddCommand(enableCommand)
 
 	disableCommand := &cobra.Command{
 		Use:     "disable",
@@ -32,6 +37,7 @@ func init() {
 		Run:     disableBlocking,
 	}
 	disableCommand.Flags().DurationP("duration", "d", 0, "duration in min")
+	addPauseFlags(disableCommand)
 	blockingCmd.AddCommand(disableCommand)
 
 	blockingCmd.AddCommand(&cobra.Command{
@@ -40,6 +46,51 @@ func init() {
 		Short: "Print the status of blocking resolver",
 		Run:   statusBlocking,
 	})
+
+	globalCmd := &cobra.Command{
+		Use:   "global",
+		Short: "Switch global categories of the private DNS",
+	}
+	blockingCmd.AddCommand(globalCmd)
+
+	globalEnableCommand := &cobra.Command{
+		Use:     "enable <category>",
+		Aliases: []string{"on"},
+		Args:    cobra.ExactArgs(1),
+		Short:   "Enable global category, optionally for certain duration",
+		Run:     enableGlobalCategory,
+	}
+	globalEnableCommand.Flags().DurationP("duration", "d", 0, "duration in min")
+	globalCmd.AddCommand(globalEnableCommand)
+
+	globalDisableCommand := &cobra.Command{
+		Use:     "disable <category>",
+		Aliases: []string{"off"},
+		Args:    cobra.ExactArgs(1),
+		Short:   "Disable global category, optionally for certain duration",
+		Run:     disableGlobalCategory,
+	}
+	globalDisableCommand.Flags().DurationP("duration", "d", 0, "duration in min")
+	globalCmd.AddCommand(globalDisableCommand)
+}
+
+func addPauseFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceP("groups", "g", nil, "only for these groups")
+	cmd.Flags().StringSlice("client", nil, "only for these clients (name, MAC, IP or host name)")
+	cmd.Flags().StringSlice("category", nil, "only for these categories")
+}
+
+// pauseQuery returns the query parameters for groups, clients and categories
+func pauseQuery(cmd *cobra.Command) url.Values {
+	values := url.Values{}
+
+	for _, name := range []string{"groups", "client", "category"} {
+		if v, _ := cmd.Flags().GetStringSlice(name); len(v) > 0 {
+			values.Set(name, strings.Join(v, ","))
+		}
+	}
+
+	return values
 }
 
 //nolint:gochecknoglobals
@@ -49,8 +100,13 @@ var blockingCmd = &cobra.Command{
 	Short:   "Control status of blocking resolver",
 }
 
-func enableBlocking(_ *cobra.Command, _ []string) {
-	resp, err := http.Get(apiURL(api.BlockingEnablePath))
+func enableBlocking(cmd *cobra.Command, _ []string) {
+	u := apiURL(api.BlockingEnablePath)
+	if query := pauseQuery(cmd); len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	resp, err := http.Get(u)
 	if err != nil {
 		log.Logger.Fatal("can't execute", err)
 		return
@@ -67,7 +123,10 @@ func enableBlocking(_ *cobra.Command, _ []string) {
 func disableBlocking(cmd *cobra.Command, _ []string) {
 	duration, _ := cmd.Flags().GetDuration("duration")
 
-	resp, err := http.Get(fmt.Sprintf("%s?duration=%s", apiURL(api.BlockingDisablePath), duration))
+	query := pauseQuery(cmd)
+	query.Set("duration", duration.String())
+
+	resp, err := http.Get(fmt.Sprintf("%s?%s", apiURL(api.BlockingDisablePath), query.Encode()))
 	if err != nil {
 		log.Logger.Fatal("can't execute", err)
 		return
@@ -110,4 +169,54 @@ func statusBlocking(_ *cobra.Command, _ []string) {
 			log.Logger.Infof("blocking disabled for %d seconds", result.AutoEnableInSec)
 		}
 	}
+
+	for _, p := range result.Pauses {
+		if p.AutoEnableInSec > 0 {
+			log.Logger.Infof("blocking paused for %s '%s' for %d seconds", p.Type, p.Name, p.AutoEnableInSec)
+		} else {
+			log.Logger.Infof("blocking paused for %s '%s'", p.Type, p.Name)
+		}
+	}
+
+	for _, c := range result.Global {
+		state := "disabled"
+		if c.Enabled {
+			state = "enabled"
+		}
+
+		switch {
+		case c.AutoResetInSec > 0:
+			log.Logger.Infof("global category '%s' %s for %d seconds", c.Category, state, c.AutoResetInSec)
+		case c.Runtime:
+			log.Logger.Infof("global category '%s' %s (runtime)", c.Category, state)
+		default:
+			log.Logger.Infof("global category '%s' %s", c.Category, state)
+		}
+	}
+}
+
+func enableGlobalCategory(cmd *cobra.Command, args []string) {
+	setGlobalCategory(cmd, api.BlockingGlobalEnablePath, args[0])
+}
+
+func disableGlobalCategory(cmd *cobra.Command, args []string) {
+	setGlobalCategory(cmd, api.BlockingGlobalDisablePath, args[0])
+}
+
+func setGlobalCategory(cmd *cobra.Command, path, category string) {
+	duration, _ := cmd.Flags().GetDuration("duration")
+
+	resp, err := http.Get(fmt.Sprintf("%s?category=%s&duration=%s", apiURL(path), url.QueryEscape(category), duration))
+	if err != nil {
+		log.Logger.Fatal("can't execute", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		log.Logger.Info("OK")
+	} else {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Logger.Fatalf("NOK: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
 }
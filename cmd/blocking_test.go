@@ -122,6 +122,25 @@ var _ = Describe("Blocking command", func() {
 				Expect(loggerHook.LastEntry().Message).Should(Equal("blocking disabled"))
 			})
 		})
+		When("status contains global categories", func() {
+			BeforeEach(func() {
+				mockFn = func(w http.ResponseWriter, _ *http.Request) {
+					response, _ := json.Marshal(api.BlockingStatus{
+						Enabled: true,
+						Global: []api.GlobalCategoryStatus{
+							{Category: "adblock", Enabled: true},
+							{Category: "adult", Enabled: false, Runtime: true, AutoResetInSec: 60},
+						},
+					})
+					_, err := w.Write(response)
+					Expect(err).Should(Succeed())
+				}
+			})
+			It("should show the state of the categories", func() {
+				statusBlocking(blockingCmd, []string{})
+				Expect(loggerHook.LastEntry().Message).Should(Equal("global category 'adult' disabled for 60 seconds"))
+			})
+		})
 		When("Wrong url is used", func() {
 			It("Should end with error", func() {
 				apiPort = 0
@@ -143,6 +162,79 @@ var _ = Describe("Blocking command", func() {
 			})
 		})
 	})
+	Describe("pause blocking for groups and clients", func() {
+		var query url.Values
+		BeforeEach(func() {
+			mockFn = func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+			}
+		})
+		It("should pass groups, clients and duration", func() {
+			cmd, _, _ := blockingCmd.Find([]string{"disable"})
+			Expect(cmd.Flags().Set("groups", "kids,guests")).Should(Succeed())
+			Expect(cmd.Flags().Set("client", "laptop")).Should(Succeed())
+			Expect(cmd.Flags().Set("duration", "10m")).Should(Succeed())
+
+			disableBlocking(cmd, []string{})
+			Expect(loggerHook.LastEntry().Message).Should(Equal("OK"))
+			Expect(query.Get("groups")).Should(Equal("kids,guests"))
+			Expect(query.Get("client")).Should(Equal("laptop"))
+			Expect(query.Get("duration")).Should(Equal("10m0s"))
+		})
+		It("should enable blocking for the category", func() {
+			cmd, _, _ := blockingCmd.Find([]string{"enable"})
+			Expect(cmd.Flags().Set("category", "adult")).Should(Succeed())
+
+			enableBlocking(cmd, []string{})
+			Expect(loggerHook.LastEntry().Message).Should(Equal("OK"))
+			Expect(query.Get("category")).Should(Equal("adult"))
+		})
+		When("status contains pauses", func() {
+			BeforeEach(func() {
+				mockFn = func(w http.ResponseWriter, _ *http.Request) {
+					response, _ := json.Marshal(api.BlockingStatus{
+						Enabled: true,
+						Pauses: []api.BlockingPause{
+							{Type: "client", Name: "laptop"},
+							{Type: "group", Name: "kids", AutoEnableInSec: 30},
+						},
+					})
+					_, _ = w.Write(response)
+				}
+			})
+			It("should list all pauses", func() {
+				statusBlocking(blockingCmd, []string{})
+				Expect(loggerHook.LastEntry().Message).Should(Equal("blocking paused for group 'kids' for 30 seconds"))
+			})
+		})
+	})
+	Describe("global category", func() {
+		var query url.Values
+		BeforeEach(func() {
+			mockFn = func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				if query.Get("category") == "unknown" {
+					http.Error(w, "unknown category 'unknown'", http.StatusBadRequest)
+				}
+			}
+		})
+		It("should disable the category for the duration", func() {
+			cmd, _, _ := blockingCmd.Find([]string{"global", "disable"})
+			Expect(cmd.Flags().Set("duration", "5m")).Should(Succeed())
+
+			disableGlobalCategory(cmd, []string{"adult"})
+			Expect(loggerHook.LastEntry().Message).Should(Equal("OK"))
+			Expect(query.Get("category")).Should(Equal("adult"))
+			Expect(query.Get("duration")).Should(Equal("5m0s"))
+		})
+		It("should end with error for unknown category", func() {
+			cmd, _, _ := blockingCmd.Find([]string{"global", "enable"})
+
+			enableGlobalCategory(cmd, []string{"unknown"})
+			Expect(fatal).Should(BeTrue())
+			Expect(loggerHook.LastEntry().Message).Should(Equal("NOK: 400 Bad Request unknown category 'unknown'"))
+		})
+	})
 })
 
 func testHTTPAPIServer(fn func(w http.ResponseWriter, _ *http.Request)) *httptest.Server {
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/log"
+
+	"github.com/spf13/cobra"
+)
+
+//nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(clientsCmd)
+
+	clientsCmd.AddCommand(&cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		Short:   "Print all clients with their groups",
+		Run:     listClients,
+	})
+
+	addCommand := &cobra.Command{
+		Use:   "add <name>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Create a client or replace an existing client with the same name",
+		Run:   addClient,
+	}
+	addCommand.Flags().StringSlice("mac", nil, "MAC address(es) of the client")
+	addCommand.Flags().StringSlice("cpeId", nil, "CPE ID(s) of the client")
+	addCommand.Flags().StringSlice("ip", nil, "IP address(es) of the client")
+	addCommand.Flags().StringSlice("cidr", nil, "network(s) of the client in CIDR notation")
+	addCommand.Flags().StringSlice("hostname", nil, "host name(s) of the client")
+	addCommand.Flags().StringSliceP("group", "g", nil, "group(s) of the client")
+	addCommand.Flags().StringSlice("tag", nil, "tag(s) of the client")
+	addCommand.Flags().String("blockType", "", "block type for this client (zeroIP, nxDomain)")
+	clientsCmd.AddCommand(addCommand)
+
+	clientsCmd.AddCommand(&cobra.Command{
+		Use:     "remove <name>",
+		Aliases: []string{"rm"},
+		Args:    cobra.ExactArgs(1),
+		Short:   "Remove a client",
+		Run:     removeClient,
+	})
+
+	clientsCmd.AddCommand(&cobra.Command{
+		Use:   "assign <name> [group...]",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Replace the groups of a client",
+		Run:   assignClient,
+	})
+}
+
+//nolint:gochecknoglobals
+var clientsCmd = &cobra.Command{
+	Use:     "clients",
+	Aliases: []string{"client"},
+	Short:   "Manage clients and their groups at runtime",
+}
+
+func listClients(_ *cobra.Command, _ []string) {
+	resp := apiRequest(http.MethodGet, apiURL(api.ClientsPath), nil)
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var result []api.Client
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Logger.Fatal("can't read response: ", err)
+		return
+	}
+
+	if len(result) == 0 {
+		log.Logger.Info("no clients defined")
+		return
+	}
+
+	for _, c := range result {
+		logClient(c)
+	}
+}
+
+func addClient(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	client := api.Client{Name: args[0]}
+	client.MAC, _ = flags.GetStringSlice("mac")
+	client.CPEID, _ = flags.GetStringSlice("cpeId")
+	client.IP, _ = flags.GetStringSlice("ip")
+	client.CIDR, _ = flags.GetStringSlice("cidr")
+	client.Names, _ = flags.GetStringSlice("hostname")
+	client.Groups, _ = flags.GetStringSlice("group")
+	client.Tags, _ = flags.GetStringSlice("tag")
+	client.BlockType, _ = flags.GetString("blockType")
+
+	jsonValue, _ := json.Marshal(client)
+
+	resp := apiRequest(http.MethodPost, apiURL(api.ClientsPath), bytes.NewBuffer(jsonValue))
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	log.Logger.Info("OK")
+}
+
+func removeClient(_ *cobra.Command, args []string) {
+	resp := apiRequest(http.MethodDelete, apiURL(api.ClientsPath+"/"+url.PathEscape(args[0])), nil)
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	log.Logger.Info("OK")
+}
+
+func assignClient(_ *cobra.Command, args []string) {
+	jsonValue, _ := json.Marshal(api.ClientGroups{Groups: args[1:]})
+
+	resp := apiRequest(http.MethodPut, apiURL(api.ClientsPath+"/"+url.PathEscape(args[0])+"/groups"),
+		bytes.NewBuffer(jsonValue))
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var result api.Client
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Logger.Fatal("can't read response: ", err)
+		return
+	}
+
+	logClient(result)
+}
+
+func logClient(c api.Client) {
+	var selectors []string
+
+	add := func(name string, values []string) {
+		for _, v := range values {
+			selectors = append(selectors, name+":"+v)
+		}
+	}
+
+	add("mac", c.MAC)
+	add("cpeId", c.CPEID)
+	add("ip", c.IP)
+	add("cidr", c.CIDR)
+	add("name", c.Names)
+
+	source := ""
+	if c.Runtime {
+		source = " (runtime)"
+	}
+
+	log.Logger.Infof("%s%s: groups %v, selectors %s", c.Name, source, c.Groups, strings.Join(selectors, ", "))
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/stgnet/blocky/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Clients command", func() {
+	var (
+		ts          *httptest.Server
+		mockFn      func(w http.ResponseWriter, r *http.Request)
+		lastRequest *http.Request
+		lastBody    string
+	)
+	JustBeforeEach(func() {
+		ts = testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			lastRequest, lastBody = r, string(body)
+			mockFn(w, r)
+		})
+	})
+	JustAfterEach(func() {
+		ts.Close()
+	})
+	BeforeEach(func() {
+		fatal = false
+		mockFn = func(w http.ResponseWriter, _ *http.Request) {}
+	})
+	Describe("list clients", func() {
+		BeforeEach(func() {
+			mockFn = func(w http.ResponseWriter, _ *http.Request) {
+				response, _ := json.Marshal([]api.Client{{
+					Name:    "tablet",
+					MAC:     []string{"aa:bb:cc:dd:ee:ff"},
+					Groups:  []string{"kids"},
+					Runtime: true,
+				}})
+				_, _ = w.Write(response)
+			}
+		})
+		It("should print all clients", func() {
+			listClients(clientsCmd, []string{})
+			Expect(fatal).Should(BeFalse())
+			Expect(lastRequest.Method).Should(Equal(http.MethodGet))
+			Expect(loggerHook.LastEntry().Message).
+				Should(Equal("tablet (runtime): groups [kids], selectors mac:aa:bb:cc:dd:ee:ff"))
+		})
+	})
+	Describe("add client", func() {
+		It("should post the client", func() {
+			cmd, _, _ := clientsCmd.Find([]string{"add"})
+			Expect(cmd.Flags().Set("mac", "aa:bb:cc:dd:ee:ff")).Should(Succeed())
+			Expect(cmd.Flags().Set("group", "kids,music")).Should(Succeed())
+
+			addClient(cmd, []string{"tablet"})
+			Expect(fatal).Should(BeFalse())
+			Expect(lastRequest.Method).Should(Equal(http.MethodPost))
+			Expect(lastRequest.URL.Path).Should(Equal(api.ClientsPath))
+
+			var client api.Client
+			Expect(json.Unmarshal([]byte(lastBody), &client)).Should(Succeed())
+			Expect(client.Name).Should(Equal("tablet"))
+			Expect(client.MAC).Should(Equal([]string{"aa:bb:cc:dd:ee:ff"}))
+			Expect(client.Groups).Should(Equal([]string{"kids", "music"}))
+			Expect(loggerHook.LastEntry().Message).Should(Equal("OK"))
+		})
+	})
+	Describe("remove client", func() {
+		It("should delete the client", func() {
+			removeClient(clientsCmd, []string{"tablet"})
+			Expect(lastRequest.Method).Should(Equal(http.MethodDelete))
+			Expect(lastRequest.URL.Path).Should(Equal(api.ClientsPath + "/tablet"))
+			Expect(loggerHook.LastEntry().Message).Should(Equal("OK"))
+		})
+		When("client does not exist", func() {
+			BeforeEach(func() {
+				mockFn = func(w http.ResponseWriter, _ *http.Request) {
+					http.Error(w, "unknown client 'tablet'", http.StatusNotFound)
+				}
+			})
+			It("should end with error", func() {
+				removeClient(clientsCmd, []string{"tablet"})
+				Expect(fatal).Should(BeTrue())
+				Expect(loggerHook.LastEntry().Message).Should(Equal("NOK: 404 Not Found unknown client 'tablet'"))
+			})
+		})
+	})
+	Describe("assign groups", func() {
+		BeforeEach(func() {
+			mockFn = func(w http.ResponseWriter, _ *http.Request) {
+				response, _ := json.Marshal(api.Client{Name: "tablet", IP: []string{"1.2.3.4"}, Groups: []string{"adults"}})
+				_, _ = w.Write(response)
+			}
+		})
+		It("should put the groups", func() {
+			assignClient(clientsCmd, []string{"tablet", "adults"})
+			Expect(lastRequest.Method).Should(Equal(http.MethodPut))
+			Expect(lastRequest.URL.Path).Should(Equal(api.ClientsPath + "/tablet/groups"))
+			Expect(lastBody).Should(Equal(`{"groups":["adults"]}`))
+			Expect(loggerHook.LastEntry().Message).Should(Equal("tablet: groups [adults], selectors ip:1.2.3.4"))
+		})
+	})
+	When("Wrong url is used", func() {
+		It("Should end with error", func() {
+			apiPort = 0
+			listClients(clientsCmd, []string{})
+			Expect(fatal).Should(BeTrue())
+			Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("connection refused"))
+		})
+	})
+})
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/log"
+
+	"github.com/spf13/cobra"
+)
+
+//nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(listsCmd)
+
+	listsCmd.AddCommand(&cobra.Command{
+		Use:   "refresh [group]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Refresh the lists of the group (all groups without argument) immediately",
+		Run:   refreshLists,
+	})
+
+	listsCmd.AddCommand(&cobra.Command{
+		Use:   "search <domain>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Print all groups, sources and rules of the lists, which match the domain",
+		Run:   searchLists,
+	})
+}
+
+//nolint:gochecknoglobals
+var listsCmd = &cobra.Command{
+	Use:   "lists",
+	Args:  cobra.NoArgs,
+	Short: "Print the state of the black and white lists",
+	Run:   printLists,
+}
+
+func printLists(_ *cobra.Command, _ []string) {
+	resp := apiRequest(http.MethodGet, apiURL(api.ListsPath), nil)
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	logListsStatus(resp)
+}
+
+func refreshLists(_ *cobra.Command, args []string) {
+	u := apiURL(api.ListsRefreshPath)
+
+	if len(args) > 0 {
+		query := url.Values{}
+		query.Set("group", args[0])
+		u = fmt.Sprintf("%s?%s", u, query.Encode())
+	}
+
+	resp := apiRequest(http.MethodGet, u, nil)
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	logListsStatus(resp)
+}
+
+func searchLists(_ *cobra.Command, args []string) {
+	query := url.Values{}
+	query.Set("domain", args[0])
+
+	resp := apiRequest(http.MethodGet, fmt.Sprintf("%s?%s", apiURL(api.ListsSearchPath), query.Encode()), nil)
+	if resp == nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	var result api.ListSearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Logger.Fatal("can't read response: ", err)
+		return
+	}
+
+	if len(result.Matches) == 0 {
+		log.Logger.Infof("%s is not contained in any list", result.Domain)
+	}
+
+	for _, m := range result.Matches {
+		if m.Exception {
+			log.Logger.Infof("%s %s: %s (exception %s, %s)", m.Type, m.Group, m.Link, m.Rule, m.Kind)
+		} else {
+			log.Logger.Infof("%s %s: %s (rule %s, %s)", m.Type, m.Group, m.Link, m.Rule, m.Kind)
+		}
+	}
+
+	for _, v := range result.PrivateDNS {
+		verdict := "not blocked"
+		if v.Blocked {
+			verdict = "blocked"
+		}
+
+		switch {
+		case v.Error != "":
+			log.Logger.Warnf("private DNS %s: %s", v.Category, v.Error)
+		case v.GlobalEnabled:
+			log.Logger.Infof("private DNS %s: %s", v.Category, verdict)
+		default:
+			log.Logger.Infof("private DNS %s: %s (globally disabled)", v.Category, verdict)
+		}
+	}
+}
+
+func logListsStatus(resp *http.Response) {
+	var result []api.ListGroupStatus
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Logger.Fatal("can't read response: ", err)
+		return
+	}
+
+	if len(result) == 0 {
+		log.Logger.Info("no lists configured")
+		return
+	}
+
+	for _, g := range result {
+		log.Logger.Infof("%s %s: %d entries", g.Type, g.Group, g.Entries)
+
+		for _, s := range g.Sources {
+			refreshed := "never"
+			if s.LastRefresh != nil {
+				refreshed = s.LastRefresh.Format(time.RFC3339)
+			}
+
+			log.Logger.Infof("  - %s (format %s, %d entries, %d invalid lines, refreshed %s)", s.Link, s.Format,
+				s.Entries, s.InvalidLines, refreshed)
+
+			if s.LastError != "" {
+				log.Logger.Warnf("    last error: %s", s.LastError)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lists command", func() {
+	var (
+		ts          *httptest.Server
+		mockFn      func(w http.ResponseWriter, r *http.Request)
+		lastRequest *http.Request
+	)
+	JustBeforeEach(func() {
+		ts = testHTTPAPIServer(func(w http.ResponseWriter, r *http.Request) {
+			lastRequest = r
+			mockFn(w, r)
+		})
+	})
+	JustAfterEach(func() {
+		ts.Close()
+	})
+	BeforeEach(func() {
+		fatal = false
+		mockFn = func(w http.ResponseWriter, _ *http.Request) {
+			refreshed := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+			response, _ := json.Marshal([]api.ListGroupStatus{{Type: "blacklist", Group: "ads", Entries: 2,
+				Sources: []api.ListSourceStatus{{Link: "http://example.com/list", Format: "hosts", Entries: 2,
+					InvalidLines: 1, LastRefresh: &refreshed}}}})
+			_, _ = w.Write(response)
+		}
+	})
+	Describe("print lists", func() {
+		It("should print the groups and their sources", func() {
+			printLists(listsCmd, []string{})
+			Expect(fatal).Should(BeFalse())
+			Expect(lastRequest.URL.Path).Should(Equal(api.ListsPath))
+			Expect(loggerHook.LastEntry().Message).Should(Equal("  - http://example.com/list (format hosts, " +
+				"2 entries, 1 invalid lines, refreshed 2026-10-18T10:00:00Z)"))
+		})
+	})
+	Describe("search domain", func() {
+		BeforeEach(func() {
+			mockFn = func(w http.ResponseWriter, _ *http.Request) {
+				response, _ := json.Marshal(api.ListSearchResult{Domain: "ads.example.com",
+					Matches: []api.ListMatch{{Type: "blacklist", Group: "ads", Link: "http://example.com/list",
+						Rule: "*.example.com", Kind: "wildcard"}},
+					PrivateDNS: []api.CategoryVerdict{{Category: "adblock", Blocked: true, GlobalEnabled: true}}})
+				_, _ = w.Write(response)
+			}
+		})
+		It("should print the matches and the private DNS verdicts", func() {
+			searchLists(listsCmd, []string{"ads.example.com"})
+			Expect(fatal).Should(BeFalse())
+			Expect(lastRequest.URL.Path).Should(Equal(api.ListsSearchPath))
+			Expect(lastRequest.URL.Query().Get("domain")).Should(Equal("ads.example.com"))
+			entries := loggerHook.AllEntries()
+			Expect(len(entries)).Should(BeNumerically(">=", 2))
+			Expect(entries[len(entries)-2].Message).
+				Should(Equal("blacklist ads: http://example.com/list (rule *.example.com, wildcard)"))
+			Expect(entries[len(entries)-1].Message).Should(Equal("private DNS adblock: blocked"))
+		})
+	})
+	Describe("refresh lists", func() {
+		It("should refresh the group", func() {
+			refreshLists(listsCmd, []string{"ads"})
+			Expect(fatal).Should(BeFalse())
+			Expect(lastRequest.URL.Path).Should(Equal(api.ListsRefreshPath))
+			Expect(lastRequest.URL.Query().Get("group")).Should(Equal("ads"))
+		})
+		When("group is unknown", func() {
+			BeforeEach(func() {
+				mockFn = func(w http.ResponseWriter, _ *http.Request) {
+					http.Error(w, "unknown group 'other'", http.StatusNotFound)
+				}
+			})
+			It("should end with error", func() {
+				refreshLists(listsCmd, []string{"other"})
+				Expect(fatal).Should(BeTrue())
+				Expect(loggerHook.LastEntry().Message).Should(Equal("NOK: 404 Not Found unknown group 'other'"))
+			})
+		})
+	})
+})
@@ -3,8 +3,11 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/stgnet/blocky/api"
 
@@ -18,6 +21,7 @@ import (
 func init() {
 	rootCmd.AddCommand(queryCmd)
 	queryCmd.Flags().StringP("type", "t", "A", "query type (A, AAAA, ...)")
+	queryCmd.Flags().BoolP("explain", "e", false, "print the decisions of all resolvers")
 }
 
 //nolint:gochecknoglobals
@@ -30,6 +34,7 @@ var queryCmd = &cobra.Command{
 
 func query(cmd *cobra.Command, args []string) {
 	typeFlag, _ := cmd.Flags().GetString("type")
+	explainFlag, _ := cmd.Flags().GetBool("explain")
 	qType := dns.StringToType[typeFlag]
 
 	if qType == dns.TypeNone {
@@ -37,8 +42,9 @@ func query(cmd *cobra.Command, args []string) {
 	}
 
 	apiRequest := api.QueryRequest{
-		Query: args[0],
-		Type:  typeFlag,
+		Query:   args[0],
+		Type:    typeFlag,
+		Explain: explainFlag,
 	}
 	jsonValue, _ := json.Marshal(apiRequest)
 
@@ -72,4 +78,36 @@ func query(cmd *cobra.Command, args []string) {
 	log.Logger.Infof("\tresponse type: %20s", result.ResponseType)
 	log.Logger.Infof("\tresponse:      %20s", result.Response)
 	log.Logger.Infof("\treturn code:   %20s", result.ReturnCode)
+
+	if result.Dropped {
+		log.Logger.Infof("\tdropped:       %20t", result.Dropped)
+	}
+
+	if len(result.Trace) > 0 {
+		log.Logger.Info("Trace:")
+
+		for i, step := range result.Trace {
+			log.Logger.Infof("\t%2d. %-28s %s %s", i+1, step.Resolver, step.Message, formatDetails(step.Details))
+		}
+	}
+}
+
+func formatDetails(details map[string]interface{}) string {
+	if len(details) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%v", k, details[k])
+	}
+
+	return strings.Join(parts, ", ")
 }
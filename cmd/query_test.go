@@ -56,6 +56,40 @@ var _ = Describe("Blocking command", func() {
 				Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("NOERROR"))
 			})
 		})
+		When("query command is called with explain flag", func() {
+			BeforeEach(func() {
+				mockFn = func(w http.ResponseWriter, r *http.Request) {
+					var request api.QueryRequest
+					Expect(json.NewDecoder(r.Body).Decode(&request)).Should(Succeed())
+					Expect(request.Explain).Should(BeTrue())
+
+					response, _ := json.Marshal(api.QueryResult{
+						Reason:       "BLOCKED PRIVATE (1025)",
+						ResponseType: "BLOCKED",
+						ReturnCode:   "NOERROR",
+						Trace: []api.TraceStep{
+							{
+								Resolver: "BlockingResolver",
+								Message:  "checking domain with private DNS",
+								Details:  map[string]interface{}{"port": 1025, "domain": "google.de"},
+							},
+						},
+					})
+					_, err := w.Write(response)
+					Expect(err).Should(Succeed())
+				}
+			})
+			AfterEach(func() {
+				Expect(queryCmd.Flags().Set("explain", "false")).Should(Succeed())
+			})
+			It("should print trace", func() {
+				Expect(queryCmd.Flags().Set("explain", "true")).Should(Succeed())
+				query(queryCmd, []string{"google.de"})
+
+				Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("BlockingResolver"))
+				Expect(loggerHook.LastEntry().Message).Should(ContainSubstring("domain=google.de, port=1025"))
+			})
+		})
 		When("Server returns 500", func() {
 			BeforeEach(func() {
 				mockFn = func(w http.ResponseWriter, _ *http.Request) {
@@ -4,7 +4,11 @@ import (
 	"github.com/stgnet/blocky/config"
 	"github.com/stgnet/blocky/log"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -36,6 +40,31 @@ func apiURL(path string) string {
 	return fmt.Sprintf("http://%s:%d%s", apiHost, apiPort, path)
 }
 
+// apiRequest executes the request to the REST API and returns the response or nil if the request failed
+func apiRequest(method, u string, body io.Reader) *http.Response {
+	req, _ := http.NewRequest(method, u, body)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Logger.Fatal("can't execute", err)
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		msg, _ := ioutil.ReadAll(resp.Body)
+		log.Logger.Fatalf("NOK: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+
+		return nil
+	}
+
+	return resp
+}
+
 //nolint:gochecknoinits
 func init() {
 	cobra.OnInitialize(initConfig)
@@ -9,9 +9,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/stgnet/blocky/log"
 
+	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
@@ -108,8 +110,27 @@ func ParseUpstream(upstream string) (result Upstream, err error) {
 const (
 	cfgDefaultPort           = 53
 	cfgDefaultPrometheusPath = "/metrics"
+	cfgDefaultQueryTimeout   = 10 * time.Second
+
+	// PrivateDNSDefaultBasePort is the port for private DNS queries without active category
+	PrivateDNSDefaultBasePort = 1024
+
+	// BlockingModePrivate uses only the verdict of the private DNS (default)
+	BlockingModePrivate = "private"
+	// BlockingModeLists uses only the local black lists
+	BlockingModeLists = "lists"
+	// BlockingModeBoth blocks on local list match, asks the private DNS otherwise and falls back to the lists
+	// if the private DNS is unreachable
+	BlockingModeBoth = "both"
 )
 
+// nolint:gochecknoglobals
+var defaultPrivateDNSCategories = map[string]uint16{
+	"adblock": 1,
+	"malware": 2,
+	"adult":   4,
+}
+
 // main configuration
 type Config struct {
 	Upstream     UpstreamConfig            `yaml:"upstream"`
@@ -117,6 +138,9 @@ type Config struct {
 	Conditional  ConditionalUpstreamConfig `yaml:"conditional"`
 	Blocking     BlockingConfig            `yaml:"blocking"`
 	ClientLookup ClientLookupConfig        `yaml:"clientLookup"`
+	EdnsClientID EdnsClientIDConfig        `yaml:"ednsClientID"`
+	Clients      map[string]ClientConfig   `yaml:"clients"`
+	Schedules    map[string]ScheduleConfig `yaml:"schedules"`
 	Caching      CachingConfig             `yaml:"caching"`
 	QueryLog     QueryLogConfig            `yaml:"queryLog"`
 	Prometheus   PrometheusConfig          `yaml:"prometheus"`
@@ -129,11 +153,35 @@ type Config struct {
 	KeyFile      string                    `yaml:"httpsKeyFile"`
 	BootstrapDNS Upstream                  `yaml:"bootstrapDns"`
 	Cname        CnameConfig               `yaml:"cname"`
+	RPZ          RPZConfig                 `yaml:"rpz"`
+	QueryTimeout time.Duration             `yaml:"queryTimeout"`
+	Pipeline     []string                  `yaml:"pipeline"`
+	// optional: JSON file for runtime changes (for example clients managed via API)
+	StateFile string `yaml:"stateFile"`
+	// Path of the loaded config file, is used to reload the configuration
+	Path string `yaml:"-"`
+}
+
+// RPZConfig contains the response policy zones. The order of the zones defines their precedence
+type RPZConfig struct {
+	Zones []RPZZoneConfig `yaml:"zones"`
+	// optional: refresh period of the zones in minutes, default 4h, negative value deactivates the refresh
+	RefreshPeriod int `yaml:"refreshPeriod"`
+}
+
+// RPZZoneConfig is a response policy zone, which is loaded from a local file or URL
+type RPZZoneConfig struct {
+	// optional: name (origin) of the zone, default: owner of the SOA record. Required for zones with relative owner
+	// names and without $ORIGIN
+	Name   string `yaml:"name"`
+	Source string `yaml:"source"`
 }
 
 type Groups struct {
 	Domains []string `yaml:"domains"`
 	Cname   string   `yaml:"cname"`
+	// optional: the group is only enforced, if one of the schedules is active
+	Schedules []string `yaml:"schedules"`
 }
 type CnameConfig struct {
 	Groups            map[string]Groups   `yaml:"groups"`
@@ -165,6 +213,101 @@ type BlockingConfig struct {
 	Global            map[string]bool     `yaml:"global"`
 	BlockType         string              `yaml:"blockType"`
 	RefreshPeriod     int                 `yaml:"refreshPeriod"`
+	PrivateDNS        PrivateDNSConfig    `yaml:"privateDNS"`
+	Mode              string              `yaml:"mode"`
+	// optional: groups, which are only enforced if one of their schedules is active
+	GroupSchedules map[string][]string `yaml:"groupSchedules"`
+	// optional: daily usage budgets per black list group and client
+	Budgets map[string]BudgetConfig `yaml:"budgets"`
+	// optional: groups, whose black and white list entries match their subdomains too
+	MatchSubdomains []string `yaml:"matchSubdomains"`
+	// optional: directory to store the downloaded lists, used on startup before the first download
+	ListCacheDir string `yaml:"listCacheDir"`
+	// optional: settings of the list download
+	Download DownloadConfig `yaml:"download"`
+}
+
+// DownloadConfig contains the settings of the list download. Sources overrides the settings per link, unset values
+// are taken from the defaults
+type DownloadConfig struct {
+	// optional: timeout of one attempt, default 30 seconds
+	Timeout time.Duration `yaml:"timeout"`
+	// optional: number of retries on temporary errors, default 2
+	Retries int `yaml:"retries"`
+	// optional: wait time before the first retry, doubled for each further retry, default 1 second
+	Backoff time.Duration `yaml:"backoff"`
+	// optional: maximum size of a list in bytes (downloaded and uncompressed), default 0 (unlimited)
+	MaxSize int64 `yaml:"maxSize"`
+	// optional: additional HTTP headers
+	Headers map[string]string `yaml:"headers"`
+	// optional: settings per link
+	Sources map[string]DownloadConfig `yaml:"sources"`
+}
+
+// BudgetConfig limits the daily usage of the domains of a black list group per client. The usage is estimated from
+// DNS activity: each query of the group's domains counts as usage for the following window. If the budget is used up,
+// the group is blocked for the client until the next reset
+type BudgetConfig struct {
+	Daily time.Duration `yaml:"daily"`
+	// optional: activity window per query, default 5 minutes
+	Window time.Duration `yaml:"window"`
+	// optional: time of the daily reset (HH:MM, local time), default 00:00
+	Reset string `yaml:"reset"`
+}
+
+// ScheduleConfig defines when a schedule is active: on the listed days (empty: every day) during one of the
+// time ranges (empty: whole day) in the timezone (empty: local time). A time range may end on the next day
+type ScheduleConfig struct {
+	// days of week, for example "mon", "sunday" or "mon-fri"
+	Days []string `yaml:"days"`
+	// time ranges, for example "20:00-06:00"
+	Times    []string `yaml:"times"`
+	Timezone string   `yaml:"timezone"`
+}
+
+// PrivateDNSConfig contains the backends of the private category DNS, which decides if a query should be blocked.
+// The port of the query is the base port plus the bitmask of the active categories.
+type PrivateDNSConfig struct {
+	Hosts        []string           `yaml:"hosts"`
+	Net          string             `yaml:"net"`
+	Timeout      time.Duration      `yaml:"timeout"`
+	Retries      int                `yaml:"retries"`
+	BasePort     uint16             `yaml:"basePort"`
+	Categories   map[string]uint16  `yaml:"categories"`
+	VerdictCache VerdictCacheConfig `yaml:"verdictCache"`
+}
+
+// VerdictCacheConfig limits the cache of private DNS verdicts per domain and category port
+type VerdictCacheConfig struct {
+	// maximum amount of cached verdicts, 0 uses the default, a negative value disables the cache
+	MaxEntries int `yaml:"maxEntries"`
+	// upper limit of the TTL of a cached verdict, 0 uses the default
+	MaxTime time.Duration `yaml:"maxTime"`
+}
+
+// CategoryBits returns the configured categories with their bit or the default categories (adblock, malware, adult)
+func (c *PrivateDNSConfig) CategoryBits() map[string]uint16 {
+	if len(c.Categories) == 0 {
+		return defaultPrivateDNSCategories
+	}
+
+	return c.Categories
+}
+
+// PortRange returns the first and the last port, which can be used for private DNS queries
+func (c *PrivateDNSConfig) PortRange() (first, last int) {
+	first = int(c.BasePort)
+	if first == 0 {
+		first = PrivateDNSDefaultBasePort
+	}
+
+	last = first
+
+	for _, bit := range c.CategoryBits() {
+		last += int(bit)
+	}
+
+	return
 }
 
 type ClientLookupConfig struct {
@@ -173,6 +316,26 @@ type ClientLookupConfig struct {
 	SingleNameOrder     []uint              `yaml:"singleNameOrder"`
 }
 
+// ClientConfig defines a client by its selectors (MAC, CPE ID, IP, CIDR, name), its groups and optional settings
+type ClientConfig struct {
+	MAC    []string `yaml:"mac" json:"mac,omitempty"`
+	CPEID  []string `yaml:"cpeId" json:"cpeId,omitempty"`
+	IP     []net.IP `yaml:"ip" json:"ip,omitempty"`
+	CIDR   []string `yaml:"cidr" json:"cidr,omitempty"`
+	Name   []string `yaml:"name" json:"name,omitempty"`
+	Groups []string `yaml:"groups" json:"groups,omitempty"`
+	Tags   []string `yaml:"tags" json:"tags,omitempty"`
+	// optional: overrides the blockType of the blocking configuration
+	BlockType string `yaml:"blockType" json:"blockType,omitempty"`
+}
+
+// EdnsClientIDConfig defines the EDNS0 option codes, which identify the client (for example added by dnsmasq)
+type EdnsClientIDConfig struct {
+	MACOptionCodes   []uint16 `yaml:"macOptionCodes"`
+	CPEIDOptionCodes []uint16 `yaml:"cpeIdOptionCodes"`
+	UseClientSubnet  bool     `yaml:"useClientSubnet"`
+}
+
 type CachingConfig struct {
 	MinCachingTime int `yaml:"minTime"`
 	MaxCachingTime int `yaml:"maxTime"`
@@ -184,25 +347,346 @@ type QueryLogConfig struct {
 	LogRetentionDays uint64 `yaml:"logRetentionDays"`
 }
 
+// NewConfig loads the config file, exits the program execution if the config is invalid
 func NewConfig(path string) Config {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		log.Logger.Fatal(err)
+	}
+
+	return cfg
+}
+
+// LoadConfig reads, parses and validates the config file
+func LoadConfig(path string) (Config, error) {
 	cfg := Config{}
 	setDefaultValues(&cfg)
 
 	data, err := ioutil.ReadFile(path)
 
 	if err != nil {
-		log.Logger.Fatal("Can't read config file: ", err)
+		return cfg, fmt.Errorf("can't read config file: %v", err)
 	}
 
 	err = yaml.UnmarshalStrict(data, &cfg)
 	if err != nil {
-		log.Logger.Fatal("wrong file structure: ", err)
+		return cfg, fmt.Errorf("wrong file structure: %v", err)
+	}
+
+	if err = validate(&cfg); err != nil {
+		return cfg, err
 	}
+
+	cfg.Path = path
+
+	return cfg, nil
+}
+
+func validate(cfg *Config) error {
 	if cfg.LogFormat != log.CfgLogFormatText && cfg.LogFormat != log.CfgLogFormatJSON {
-		log.Logger.Fatal("LogFormat should be 'text' or 'json'")
+		return errors.New("LogFormat should be 'text' or 'json'")
 	}
 
-	return cfg
+	if _, err := logrus.ParseLevel(cfg.LogLevel); err != nil {
+		return fmt.Errorf("invalid log level '%s'", cfg.LogLevel)
+	}
+
+	if err := validateBlockType(cfg.Blocking.BlockType); err != nil {
+		return err
+	}
+
+	if err := validateBlockingMode(cfg.Blocking.Mode); err != nil {
+		return err
+	}
+
+	if err := validatePrivateDNS(&cfg.Blocking.PrivateDNS); err != nil {
+		return err
+	}
+
+	if err := validateBudgets(&cfg.Blocking); err != nil {
+		return err
+	}
+
+	for i, zone := range cfg.RPZ.Zones {
+		if zone.Source == "" {
+			return fmt.Errorf("rpz zone %d ('%s') must have a source", i+1, zone.Name)
+		}
+	}
+
+	for name, client := range cfg.Clients {
+		if err := ValidateClient(name, &client); err != nil {
+			return err
+		}
+	}
+
+	return validateSchedules(cfg)
+}
+
+// validateBudgets checks if each budget belongs to a black list group and has a valid limit, window and reset time
+func validateBudgets(cfg *BlockingConfig) error {
+	for group, budget := range cfg.Budgets {
+		if _, found := cfg.BlackLists[group]; !found {
+			return fmt.Errorf("budget '%s' must be a black list group", group)
+		}
+
+		if budget.Daily <= 0 {
+			return fmt.Errorf("budget '%s' must have a positive daily limit", group)
+		}
+
+		if budget.Window < 0 {
+			return fmt.Errorf("budget '%s' must not have a negative window", group)
+		}
+
+		if budget.Reset != "" {
+			if m, err := ParseClock(budget.Reset); err != nil || m == 24*60 {
+				return fmt.Errorf("budget '%s' has invalid reset time '%s'", group, budget.Reset)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSchedules checks all schedules and the references of blocking and cname groups to them
+func validateSchedules(cfg *Config) error {
+	for name, schedule := range cfg.Schedules {
+		if err := ValidateSchedule(name, &schedule); err != nil {
+			return err
+		}
+	}
+
+	checkRefs := func(kind, group string, schedules []string) error {
+		for _, s := range schedules {
+			if _, found := cfg.Schedules[s]; !found {
+				return fmt.Errorf("%s group '%s' references unknown schedule '%s'", kind, group, s)
+			}
+		}
+
+		return nil
+	}
+
+	for group, schedules := range cfg.Blocking.GroupSchedules {
+		if err := checkRefs("blocking", group, schedules); err != nil {
+			return err
+		}
+	}
+
+	for group, g := range cfg.Cname.Groups {
+		if err := checkRefs("cname", group, g.Schedules); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateSchedule checks if days, time ranges and timezone of the schedule can be parsed
+func ValidateSchedule(name string, cfg *ScheduleConfig) error {
+	if len(cfg.Days)+len(cfg.Times) == 0 {
+		return fmt.Errorf("schedule '%s' must define days or times", name)
+	}
+
+	for _, d := range cfg.Days {
+		if _, err := ParseWeekdays(d); err != nil {
+			return fmt.Errorf("schedule '%s': %w", name, err)
+		}
+	}
+
+	for _, t := range cfg.Times {
+		if _, _, err := ParseTimeRange(t); err != nil {
+			return fmt.Errorf("schedule '%s': %w", name, err)
+		}
+	}
+
+	if _, err := time.LoadLocation(cfg.Timezone); cfg.Timezone != "" && err != nil {
+		return fmt.Errorf("schedule '%s' has invalid timezone '%s': %w", name, cfg.Timezone, err)
+	}
+
+	return nil
+}
+
+// ParseWeekdays parses a day of week ("mon", "Monday") or a range of days ("mon-fri", "fri-mon")
+func ParseWeekdays(s string) ([]time.Weekday, error) {
+	parts := strings.SplitN(s, "-", 2)
+
+	from, err := parseWeekday(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	to := from
+
+	if len(parts) == 2 {
+		if to, err = parseWeekday(parts[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	result := []time.Weekday{from}
+	for d := from; d != to; {
+		d = (d + 1) % 7
+		result = append(result, d)
+	}
+
+	return result, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || (len(s) >= 3 && strings.HasPrefix(name, s)) {
+			return d, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid day of week '%s'", s)
+}
+
+// ParseTimeRange parses a time range "HH:MM-HH:MM" and returns start and end as minutes after midnight.
+// The end may be "24:00", an end before the start means, the range ends on the next day
+func ParseTimeRange(s string) (from, to int, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid time range '%s', format: HH:MM-HH:MM", s)
+	}
+
+	if from, err = ParseClock(parts[0]); err != nil || from == 24*60 {
+		return 0, 0, fmt.Errorf("invalid time range '%s', format: HH:MM-HH:MM", s)
+	}
+
+	if to, err = ParseClock(parts[1]); err != nil {
+		return 0, 0, fmt.Errorf("invalid time range '%s', format: HH:MM-HH:MM", s)
+	}
+
+	if from == to {
+		return 0, 0, fmt.Errorf("invalid time range '%s', start and end are equal", s)
+	}
+
+	return from, to, nil
+}
+
+// ParseClock parses a time of day "HH:MM" (up to "24:00") and returns the minutes after midnight
+func ParseClock(s string) (int, error) {
+	var h, m int
+
+	s = strings.TrimSpace(s)
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time '%s'", s)
+	}
+
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time '%s'", s)
+	}
+
+	return h*60 + m, nil
+}
+
+// ValidateClient checks if the client has at least one selector and all selectors and settings can be parsed
+func ValidateClient(name string, cfg *ClientConfig) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("client name must not be empty")
+	}
+
+	if len(cfg.MAC)+len(cfg.CPEID)+len(cfg.IP)+len(cfg.CIDR)+len(cfg.Name) == 0 {
+		return fmt.Errorf("client '%s' must have at least one selector (mac, cpeId, ip, cidr or name)", name)
+	}
+
+	for _, mac := range cfg.MAC {
+		if _, err := net.ParseMAC(mac); err != nil {
+			return fmt.Errorf("client '%s' has invalid mac '%s'", name, mac)
+		}
+	}
+
+	for _, cidr := range cfg.CIDR {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("client '%s' has invalid cidr '%s'", name, cidr)
+		}
+	}
+
+	if err := validateBlockType(cfg.BlockType); err != nil {
+		return fmt.Errorf("client '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// validateBlockingMode checks if mode is empty (default) or one of private, lists or both
+func validateBlockingMode(mode string) error {
+	switch mode {
+	case "", BlockingModePrivate, BlockingModeLists, BlockingModeBoth:
+		return nil
+	default:
+		return fmt.Errorf("unknown blocking mode '%s', please use one of: %s, %s, %s",
+			mode, BlockingModePrivate, BlockingModeLists, BlockingModeBoth)
+	}
+}
+
+// validatePrivateDNS checks transport, timeout, retry count and port range of the private DNS backends
+func validatePrivateDNS(cfg *PrivateDNSConfig) error {
+	if cfg.Net != "" && cfg.Net != "udp" && cfg.Net != "tcp" && cfg.Net != "tcp-tls" {
+		return fmt.Errorf("unknown privateDNS net '%s', please use one of: udp, tcp, tcp-tls", cfg.Net)
+	}
+
+	for _, host := range cfg.Hosts {
+		if strings.TrimSpace(host) == "" {
+			return errors.New("privateDNS hosts must not be empty")
+		}
+	}
+
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("invalid privateDNS timeout '%s'", cfg.Timeout)
+	}
+
+	if cfg.Retries < 0 {
+		return fmt.Errorf("invalid privateDNS retries %d", cfg.Retries)
+	}
+
+	bitsInUse := make(map[uint16]string)
+
+	for name, bit := range cfg.Categories {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("privateDNS category name must not be empty")
+		}
+
+		if bit == 0 || bit&(bit-1) != 0 {
+			return fmt.Errorf("privateDNS category '%s' must use a single bit (1, 2, 4, 8, ...), but was %d", name, bit)
+		}
+
+		if other, found := bitsInUse[bit]; found {
+			return fmt.Errorf("privateDNS categories '%s' and '%s' use the same bit %d", other, name, bit)
+		}
+
+		bitsInUse[bit] = name
+	}
+
+	if cfg.VerdictCache.MaxTime < 0 {
+		return fmt.Errorf("invalid privateDNS verdictCache maxTime '%s'", cfg.VerdictCache.MaxTime)
+	}
+
+	if first, last := cfg.PortRange(); last > 65535 {
+		return fmt.Errorf("privateDNS port range %d-%d exceeds 65535, please use a smaller basePort", first, last)
+	}
+
+	return nil
+}
+
+// validateBlockType checks if block type is one of ZeroIP, NxDomain or a comma separated list of IP addresses
+func validateBlockType(blockType string) error {
+	cfgBlockType := strings.TrimSpace(strings.ToUpper(blockType))
+	if cfgBlockType == "" || cfgBlockType == "ZEROIP" || cfgBlockType == "NXDOMAIN" {
+		return nil
+	}
+
+	for _, part := range strings.Split(cfgBlockType, ",") {
+		if ip := net.ParseIP(strings.TrimSpace(part)); ip != nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown blockType '%s', please use one of: ZeroIP, NxDomain or specify destination IP address(es)",
+		blockType)
 }
 
 func setDefaultValues(cfg *Config) {
@@ -210,4 +694,5 @@ func setDefaultValues(cfg *Config) {
 	cfg.LogLevel = "info"
 	cfg.LogFormat = log.CfgLogFormatText
 	cfg.Prometheus.Path = cfgDefaultPrometheusPath
+	cfg.QueryTimeout = cfgDefaultQueryTimeout
 }
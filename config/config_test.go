@@ -4,6 +4,8 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
@@ -45,6 +47,9 @@ var _ = Describe("Config", func() {
 				Expect(len(cfg.Cname.ClientGroupsBlock)).Should(Equal(2))
 				Expect(len(cfg.Cname.ClientGroupsBlock["192.168.2.1"])).Should(Equal(1))
 				Expect(cfg.Cname.ClientGroupsBlock["192.168.2.1"][0]).Should(Equal("youtube"))
+
+				Expect(cfg.Pipeline).Should(Equal([]string{"ednsClientID", "clientNames", "queryLogging", "caching", "blocking",
+					"parallelBest"}))
 			})
 		})
 		When("config file is malformed", func() {
@@ -85,6 +90,256 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Describe("Loading of Config", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "blocky")
+			Expect(err).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(dir)
+		})
+
+		load := func(data string) (Config, error) {
+			path := filepath.Join(dir, "config.yml")
+			err := ioutil.WriteFile(path, []byte(data), 0600)
+			Expect(err).Should(Succeed())
+
+			return LoadConfig(path)
+		}
+
+		When("config is valid", func() {
+			It("should return config with path", func() {
+				cfg, err := load("port: 55555")
+				Expect(err).Should(Succeed())
+				Expect(cfg.Port).Should(Equal(uint16(55555)))
+				Expect(cfg.Path).Should(Equal(filepath.Join(dir, "config.yml")))
+			})
+		})
+		When("config is malformed", func() {
+			It("should return error", func() {
+				_, err := load("malformed_config")
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		When("blockType is unknown", func() {
+			It("should return error", func() {
+				_, err := load("blocking:\n  blockType: wrong")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("unknown blockType"))
+			})
+		})
+		When("blockType contains IP addresses", func() {
+			It("should return config", func() {
+				_, err := load("blocking:\n  blockType: 192.168.178.1, ::1")
+				Expect(err).Should(Succeed())
+			})
+		})
+		When("blocking mode is unknown", func() {
+			It("should return error", func() {
+				_, err := load("blocking:\n  mode: wrong")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("unknown blocking mode 'wrong'"))
+			})
+		})
+		When("blocking mode is both", func() {
+			It("should return config", func() {
+				cfg, err := load("blocking:\n  mode: both")
+				Expect(err).Should(Succeed())
+				Expect(cfg.Blocking.Mode).Should(Equal(BlockingModeBoth))
+			})
+		})
+		When("privateDNS is configured", func() {
+			It("should return config", func() {
+				cfg, err := load(`blocking:
+  privateDNS:
+    hosts:
+      - 10.0.0.1
+      - 10.0.0.2
+    net: tcp-tls
+    timeout: 500ms
+    retries: 2
+    basePort: 2048`)
+				Expect(err).Should(Succeed())
+				Expect(cfg.Blocking.PrivateDNS.Hosts).Should(Equal([]string{"10.0.0.1", "10.0.0.2"}))
+				Expect(cfg.Blocking.PrivateDNS.Net).Should(Equal("tcp-tls"))
+				Expect(cfg.Blocking.PrivateDNS.Timeout).Should(Equal(500 * time.Millisecond))
+				Expect(cfg.Blocking.PrivateDNS.Retries).Should(Equal(2))
+				Expect(cfg.Blocking.PrivateDNS.BasePort).Should(Equal(uint16(2048)))
+			})
+		})
+		When("privateDNS net is unknown", func() {
+			It("should return error", func() {
+				_, err := load("blocking:\n  privateDNS:\n    net: https")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("unknown privateDNS net"))
+			})
+		})
+		When("privateDNS categories are configured", func() {
+			It("should return config with categories", func() {
+				cfg, err := load("blocking:\n  privateDNS:\n    categories:\n      adblock: 1\n      gambling: 8")
+				Expect(err).Should(Succeed())
+				Expect(cfg.Blocking.PrivateDNS.CategoryBits()).Should(Equal(map[string]uint16{"adblock": 1, "gambling": 8}))
+
+				first, last := cfg.Blocking.PrivateDNS.PortRange()
+				Expect(first).Should(Equal(1024))
+				Expect(last).Should(Equal(1033))
+			})
+		})
+		When("privateDNS categories are not configured", func() {
+			It("should use default categories", func() {
+				cfg, err := load("port: 55555")
+				Expect(err).Should(Succeed())
+				Expect(cfg.Blocking.PrivateDNS.CategoryBits()).Should(Equal(map[string]uint16{"adblock": 1, "malware": 2, "adult": 4}))
+			})
+		})
+		When("privateDNS category uses more than one bit", func() {
+			It("should return error", func() {
+				_, err := load("blocking:\n  privateDNS:\n    categories:\n      adblock: 3")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("must use a single bit"))
+			})
+		})
+		When("privateDNS categories use the same bit", func() {
+			It("should return error", func() {
+				_, err := load("blocking:\n  privateDNS:\n    categories:\n      adblock: 8\n      gambling: 8")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("use the same bit 8"))
+			})
+		})
+		When("privateDNS basePort is too large", func() {
+			It("should return error", func() {
+				_, err := load("blocking:\n  privateDNS:\n    basePort: 65530")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("basePort"))
+			})
+		})
+		When("clients are configured", func() {
+			It("should return config with clients", func() {
+				cfg, err := load(`clients:
+  tablet:
+    mac:
+      - aa:bb:cc:dd:ee:ff
+    cidr:
+      - 192.168.178.0/24
+    groups:
+      - kids
+    tags:
+      - mobile
+    blockType: NxDomain`)
+				Expect(err).Should(Succeed())
+				Expect(cfg.Clients).Should(HaveKey("tablet"))
+				Expect(cfg.Clients["tablet"].Groups).Should(Equal([]string{"kids"}))
+				Expect(cfg.Clients["tablet"].BlockType).Should(Equal("NxDomain"))
+			})
+		})
+		When("client has invalid mac", func() {
+			It("should return error", func() {
+				_, err := load("clients:\n  tablet:\n    mac:\n      - wrong")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("client 'tablet' has invalid mac 'wrong'"))
+			})
+		})
+		When("client has no selector", func() {
+			It("should return error", func() {
+				_, err := load("clients:\n  tablet:\n    groups:\n      - kids")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("at least one selector"))
+			})
+		})
+		When("schedules are configured", func() {
+			It("should return config with schedules and attached groups", func() {
+				cfg, err := load(`schedules:
+  schoolNights:
+    days:
+      - sun-thu
+    times:
+      - 20:00-06:00
+    timezone: Europe/Berlin
+blocking:
+  groupSchedules:
+    social:
+      - schoolNights
+cname:
+  groups:
+    youtube:
+      cname: restrict.youtube.com
+      schedules:
+        - schoolNights`)
+				Expect(err).Should(Succeed())
+				Expect(cfg.Schedules["schoolNights"].Times).Should(Equal([]string{"20:00-06:00"}))
+				Expect(cfg.Blocking.GroupSchedules["social"]).Should(Equal([]string{"schoolNights"}))
+				Expect(cfg.Cname.Groups["youtube"].Schedules).Should(Equal([]string{"schoolNights"}))
+			})
+		})
+		When("schedule is invalid", func() {
+			It("should return error", func() {
+				_, err := load("schedules:\n  night:\n    times:\n      - 20:00-25:00")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("invalid time range '20:00-25:00'"))
+
+				_, err = load("schedules:\n  night:\n    days:\n      - mon\n    timezone: Mars/Olympus")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("invalid timezone"))
+			})
+		})
+		When("schedule uses a range of days", func() {
+			It("should contain all days of the range", func() {
+				days, err := ParseWeekdays("fri-Mon")
+				Expect(err).Should(Succeed())
+				Expect(days).Should(Equal([]time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}))
+
+				from, to, err := ParseTimeRange("22:30-24:00")
+				Expect(err).Should(Succeed())
+				Expect(from).Should(Equal(22*60 + 30))
+				Expect(to).Should(Equal(24 * 60))
+			})
+		})
+		When("group references unknown schedule", func() {
+			It("should return error", func() {
+				_, err := load("blocking:\n  groupSchedules:\n    social:\n      - unknown")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("blocking group 'social' references unknown schedule 'unknown'"))
+			})
+		})
+		When("budgets are configured", func() {
+			It("should return config with budgets", func() {
+				cfg, err := load("blocking:\n  blackLists:\n    gaming:\n      - games.txt\n  budgets:\n    gaming:\n" +
+					"      daily: 1h\n      reset: \"04:00\"")
+				Expect(err).Should(Succeed())
+				Expect(cfg.Blocking.Budgets["gaming"].Daily).Should(Equal(time.Hour))
+				Expect(cfg.Blocking.Budgets["gaming"].Reset).Should(Equal("04:00"))
+			})
+		})
+		When("budget is invalid", func() {
+			It("should return error", func() {
+				_, err := load("blocking:\n  budgets:\n    gaming:\n      daily: 1h")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("budget 'gaming' must be a black list group"))
+
+				_, err = load("blocking:\n  blackLists:\n    gaming:\n      - games.txt\n  budgets:\n    gaming:\n" +
+					"      daily: 1h\n      reset: \"25:00\"")
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("invalid reset time '25:00'"))
+			})
+		})
+		When("log level is unknown", func() {
+			It("should return error", func() {
+				_, err := load("logLevel: wrong")
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+		When("config file does not exist", func() {
+			It("should return error", func() {
+				_, err := LoadConfig(filepath.Join(dir, "unknown.yml"))
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
 	DescribeTable("parse upstream string",
 		func(in string, wantResult Upstream, wantErr bool) {
 			result, err := ParseUpstream(in)
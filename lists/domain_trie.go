@@ -0,0 +1,261 @@
+package lists
+
+import (
+	"sort"
+	"strings"
+)
+
+// flags of a trie node
+const (
+	// nodeDomain: the domain itself is listed ("example.com" as IP or "||example.com^")
+	nodeDomain uint8 = 1 << iota
+	// nodeSubdomains: all subdomains are listed ("*.example.com" or "||example.com^")
+	nodeSubdomains
+	// nodePlain: plain domain entry, matches its subdomains too if the group matches subdomains
+	nodePlain
+)
+
+// trieNode is a label of the trie. The nodes are stored in breadth-first order: the children of a node start at
+// firstChild and end at firstChild of the next node, the label ends at the start of the label of the next node. A
+// sentinel node terminates the slice
+type trieNode struct {
+	// start of the label (lower 29 bits) and flags (upper 3 bits)
+	label      uint32
+	firstChild uint32
+}
+
+const (
+	trieFlagShift = 29
+	trieLabelMask = 1<<trieFlagShift - 1
+)
+
+func (n trieNode) labelStart() uint32 {
+	return n.label & trieLabelMask
+}
+
+func (n trieNode) flags() uint8 {
+	return uint8(n.label >> trieFlagShift)
+}
+
+// domainTrie is a read-only trie of domains by reversed labels ("www.example.com" is stored as com -> example ->
+// www). All nodes are stored in one slice and all labels in one string, so common parent domains are stored only
+// once and the trie contains no pointers, which must be scanned by the garbage collector
+type domainTrie struct {
+	nodes  []trieNode
+	labels string
+	count  int
+}
+
+// trieEntry is a domain with its flags. During the build, rest contains the labels, which are not inserted yet
+type trieEntry struct {
+	rest  string
+	flags uint8
+}
+
+// newDomainTrie creates the trie from the entries, duplicate domains are merged. The entries are modified
+func newDomainTrie(entries []trieEntry) *domainTrie {
+	sort.Slice(entries, func(i, j int) bool {
+		return compareReversed(entries[i].rest, entries[j].rest) < 0
+	})
+
+	t := &domainTrie{nodes: make([]trieNode, 1, len(entries)+2)}
+
+	var labels strings.Builder
+
+	// spans contains for each node the range of the entries below it, which have labels left
+	spans := [][2]int{{0, len(entries)}}
+
+	for i := 0; i < len(spans); i++ {
+		t.nodes[i].firstChild = uint32(len(t.nodes))
+
+		offset := spans[i][0]
+		sub := entries[offset:spans[i][1]]
+
+		for j := 0; j < len(sub); {
+			label := lastLabel(sub[j].rest)
+
+			var (
+				flags    uint8
+				terminal bool
+			)
+
+			k := j
+			for ; k < len(sub) && lastLabel(sub[k].rest) == label; k++ {
+				sub[k].rest = withoutLastLabel(sub[k].rest)
+
+				if sub[k].rest == "" {
+					terminal = true
+					flags |= sub[k].flags
+				}
+			}
+
+			if terminal {
+				t.count++
+			}
+
+			// entries without further labels are sorted first
+			start := j
+			for start < k && sub[start].rest == "" {
+				start++
+			}
+
+			t.nodes = append(t.nodes, trieNode{label: uint32(labels.Len()) | uint32(flags)<<trieFlagShift})
+			spans = append(spans, [2]int{offset + start, offset + k})
+			labels.WriteString(label)
+
+			j = k
+		}
+	}
+
+	t.nodes = append(t.nodes, trieNode{label: uint32(labels.Len()), firstChild: uint32(len(t.nodes))})
+	t.labels = labels.String()
+
+	return t
+}
+
+// match returns true, if the domain or one of its parent domains matches. If matchPlainSubdomains is set, plain
+// entries match their subdomains too
+func (t *domainTrie) match(domain string, matchPlainSubdomains bool) bool {
+	if t == nil || domain == "" {
+		return false
+	}
+
+	node := 0
+	rest := domain
+
+	for rest != "" {
+		label := lastLabel(rest)
+		rest = withoutLastLabel(rest)
+
+		if node = t.child(node, label); node < 0 {
+			return false
+		}
+
+		flags := t.nodes[node].flags()
+
+		if rest == "" {
+			return flags&(nodeDomain|nodePlain) != 0
+		}
+
+		if flags&nodeSubdomains != 0 || (matchPlainSubdomains && flags&nodePlain != 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trieMatch is a node of the trie, which matches a domain: the listed domain, the flags of the node, whether it
+// matches the domain itself or as parent domain and whether a plain entry matches as parent domain
+type trieMatch struct {
+	domain          string
+	flags           uint8
+	exact           bool
+	plainSubdomains bool
+}
+
+// matches returns all entries, which match the domain, from the top-level domain down to the domain itself
+func (t *domainTrie) matches(domain string, matchPlainSubdomains bool) (result []trieMatch) {
+	if t == nil || domain == "" {
+		return nil
+	}
+
+	node := 0
+	rest := domain
+
+	for rest != "" {
+		label := lastLabel(rest)
+		rest = withoutLastLabel(rest)
+
+		if node = t.child(node, label); node < 0 {
+			return
+		}
+
+		flags := t.nodes[node].flags()
+
+		if rest == "" {
+			if flags&(nodeDomain|nodePlain) != 0 {
+				result = append(result, trieMatch{domain: domain, flags: flags, exact: true})
+			}
+
+			return
+		}
+
+		if flags&nodeSubdomains != 0 || (matchPlainSubdomains && flags&nodePlain != 0) {
+			result = append(result, trieMatch{domain: domain[len(rest)+1:], flags: flags,
+				plainSubdomains: matchPlainSubdomains && flags&nodePlain != 0})
+		}
+	}
+
+	return
+}
+
+// child returns the index of the child node with the label (binary search) or -1
+func (t *domainTrie) child(node int, label string) int {
+	lo, hi := int(t.nodes[node].firstChild), int(t.nodes[node+1].firstChild)
+
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if t.label(mid) < label {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	if lo < int(t.nodes[node+1].firstChild) && t.label(lo) == label {
+		return lo
+	}
+
+	return -1
+}
+
+func (t *domainTrie) label(node int) string {
+	return t.labels[t.nodes[node].labelStart():t.nodes[node+1].labelStart()]
+}
+
+func (t *domainTrie) len() int {
+	if t == nil {
+		return 0
+	}
+
+	return t.count
+}
+
+func lastLabel(domain string) string {
+	return domain[strings.LastIndexByte(domain, '.')+1:]
+}
+
+func withoutLastLabel(domain string) string {
+	if i := strings.LastIndexByte(domain, '.'); i >= 0 {
+		return domain[:i]
+	}
+
+	return ""
+}
+
+// compareReversed compares the domains label by label from the right, a parent domain is sorted before its
+// subdomains
+func compareReversed(a, b string) int {
+	for a != "" && b != "" {
+		la, lb := lastLabel(a), lastLabel(b)
+		if la != lb {
+			if la < lb {
+				return -1
+			}
+
+			return 1
+		}
+
+		a, b = withoutLastLabel(a), withoutLastLabel(b)
+	}
+
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
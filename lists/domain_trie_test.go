@@ -0,0 +1,185 @@
+package lists
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+	"unsafe"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DomainTrie", func() {
+	var sut *domainTrie
+
+	BeforeEach(func() {
+		sut = newDomainTrie([]trieEntry{
+			{rest: "exact.com", flags: nodePlain},
+			{rest: "wildcard.com", flags: nodeSubdomains},
+			{rest: "adblock.com", flags: nodeDomain | nodeSubdomains},
+			{rest: "sub.parent.com", flags: nodePlain},
+			{rest: "192.168.178.55", flags: nodeDomain},
+			{rest: "exact.com", flags: nodePlain},
+		})
+	})
+
+	It("should count distinct entries", func() {
+		Expect(sut.len()).Should(Equal(5))
+	})
+
+	DescribeTable("should match domains",
+		func(domain string, matchSubdomains bool, expected bool) {
+			Expect(sut.match(domain, matchSubdomains)).Should(Equal(expected))
+		},
+		Entry("exact entry", "exact.com", false, true),
+		Entry("subdomain of exact entry", "www.exact.com", false, false),
+		Entry("subdomain of exact entry with matchSubdomains", "www.exact.com", true, true),
+		Entry("wildcard entry itself", "wildcard.com", false, false),
+		Entry("subdomain of wildcard entry", "a.b.wildcard.com", false, true),
+		Entry("adblock entry", "adblock.com", false, true),
+		Entry("subdomain of adblock entry", "ads.adblock.com", false, true),
+		Entry("parent of entry", "parent.com", true, false),
+		Entry("tld without flags", "com", true, false),
+		Entry("other domain with same suffix", "otherexact.com", true, false),
+		Entry("IP", "192.168.178.55", true, true),
+		Entry("IP is no parent domain", "1.192.168.178.55", true, false),
+		Entry("empty domain", "", true, false),
+	)
+
+	It("should not match anything if empty", func() {
+		Expect(newDomainTrie(nil).match("example.com", true)).Should(BeFalse())
+		Expect((*domainTrie)(nil).match("example.com", true)).Should(BeFalse())
+	})
+
+	It("should sort parent domains before subdomains", func() {
+		domains := []string{"b.a.com", "a.com", "com", "b.com", "a.org", "z.a.com"}
+		sort.Slice(domains, func(i, j int) bool { return compareReversed(domains[i], domains[j]) < 0 })
+
+		Expect(domains).Should(Equal([]string{"com", "a.com", "b.a.com", "z.a.com", "b.com", "a.org"}))
+	})
+})
+
+const benchmarkEntries = 1000000
+
+// benchmarkDomains creates random domains with a distribution similar to large block lists: many subdomains of
+// popular tracking domains and many distinct registered domains
+func benchmarkDomains(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	tlds := []string{"com", "net", "org", "de", "io", "info", "co.uk"}
+
+	randomLabel := func() string {
+		b := make([]byte, 4+r.Intn(8))
+		for i := range b {
+			b[i] = byte('a' + r.Intn(26))
+		}
+
+		return string(b)
+	}
+
+	parents := make([]string, n/10)
+	for i := range parents {
+		parents[i] = randomLabel() + "." + tlds[r.Intn(len(tlds))]
+	}
+
+	result := make([]string, n)
+	for i := range result {
+		if i%2 == 0 {
+			result[i] = randomLabel() + "." + tlds[r.Intn(len(tlds))]
+		} else {
+			result[i] = randomLabel() + "." + parents[r.Intn(len(parents))]
+		}
+	}
+
+	return result
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+
+	var m runtime.MemStats
+
+	runtime.ReadMemStats(&m)
+
+	return m.HeapInuse
+}
+
+// BenchmarkNewSourceCache reports the memory of the cache of a list with one million entries
+func BenchmarkNewSourceCache(b *testing.B) {
+	domains := benchmarkDomains(benchmarkEntries)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var cache *sourceCache
+
+	for i := 0; i < b.N; i++ {
+		cache = newSourceCache(domains)
+	}
+
+	b.StopTimer()
+
+	size := len(cache.domains.nodes)*int(unsafe.Sizeof(trieNode{})) + len(cache.domains.labels)
+	b.ReportMetric(float64(size)/(1<<20), "MB")
+	b.ReportMetric(float64(size)/float64(benchmarkEntries), "bytes/entry")
+}
+
+// BenchmarkSortedSlice reports the memory of the entries as sorted slice for comparison
+func BenchmarkSortedSlice(b *testing.B) {
+	domains := benchmarkDomains(benchmarkEntries)
+
+	before := heapInUse()
+
+	entries := make([]string, len(domains))
+	for i, d := range domains {
+		entries[i] = string(append([]byte(nil), d...))
+	}
+
+	sort.Strings(entries)
+
+	size := heapInUse() - before
+
+	b.ReportMetric(float64(size)/(1<<20), "MB")
+	b.ReportMetric(float64(size)/float64(benchmarkEntries), "bytes/entry")
+	runtime.KeepAlive(domains)
+	runtime.KeepAlive(entries)
+}
+
+func BenchmarkDomainTrie_Match(b *testing.B) {
+	domains := benchmarkDomains(benchmarkEntries)
+	trie := newSourceCache(domains).domains
+
+	queries := make([]string, 1000)
+	for i := range queries {
+		if i%2 == 0 {
+			queries[i] = domains[(i*7919)%len(domains)]
+		} else {
+			queries[i] = fmt.Sprintf("www.notlisted%d.com", i)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		trie.match(queries[i%len(queries)], true)
+	}
+}
+
+func BenchmarkListCache_Match(b *testing.B) {
+	domains := benchmarkDomains(benchmarkEntries)
+	cache := &ListCache{groupCaches: map[string]*groupCache{
+		"ads": {sources: []*sourceCache{newSourceCache(domains)}},
+	}}
+	groups := []string{"ads"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		cache.Match(domains[(i*7919)%len(domains)], groups)
+	}
+}
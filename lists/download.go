@@ -0,0 +1,305 @@
+package lists
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stgnet/blocky/config"
+)
+
+const (
+	defaultRetries = 2
+	defaultBackoff = time.Second
+)
+
+// errNotModified is returned, if a source wasn't changed since the last download
+var errNotModified = errors.New("not modified")
+
+// errTooLarge is returned, if a source exceeds the maximum size
+var errTooLarge = errors.New("list exceeds the maximum size")
+
+// nolint:gochecknoglobals
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+// sourceValidators are the HTTP cache validators of the last download of a source
+type sourceValidators struct {
+	etag         string
+	lastModified string
+}
+
+// downloadSettings returns the settings for the link: the settings of the source, the configured defaults for unset
+// values and the built-in defaults for values, which are not configured at all
+func downloadSettings(cfg config.DownloadConfig, link string) config.DownloadConfig {
+	result := config.DownloadConfig{
+		Timeout: cfg.Timeout,
+		Retries: cfg.Retries,
+		Backoff: cfg.Backoff,
+		MaxSize: cfg.MaxSize,
+		Headers: make(map[string]string, len(cfg.Headers)),
+	}
+
+	for k, v := range cfg.Headers {
+		result.Headers[k] = v
+	}
+
+	if source, found := cfg.Sources[link]; found {
+		if source.Timeout > 0 {
+			result.Timeout = source.Timeout
+		}
+
+		if source.Retries != 0 {
+			result.Retries = source.Retries
+		}
+
+		if source.Backoff > 0 {
+			result.Backoff = source.Backoff
+		}
+
+		if source.MaxSize > 0 {
+			result.MaxSize = source.MaxSize
+		}
+
+		for k, v := range source.Headers {
+			result.Headers[k] = v
+		}
+	}
+
+	if result.Timeout <= 0 {
+		result.Timeout = timeout
+	}
+
+	switch {
+	case result.Retries == 0:
+		result.Retries = defaultRetries
+	case result.Retries < 0:
+		result.Retries = 0
+	}
+
+	if result.Backoff <= 0 {
+		result.Backoff = defaultBackoff
+	}
+
+	return result
+}
+
+// openSource downloads the link (or opens the local file) and returns the uncompressed content. Gzip, bzip2 and zip
+// content is detected by its magic bytes. Returns errNotModified, if the validators are set and the source wasn't
+// changed
+func openSource(link string, settings config.DownloadConfig, validators sourceValidators) (io.ReadCloser,
+	sourceValidators, error) {
+	var (
+		r   io.ReadCloser
+		err error
+	)
+
+	if isRemote(link) {
+		r, validators, err = downloadFile(link, settings, validators)
+	} else {
+		r, err = readFile(link)
+	}
+
+	if err != nil {
+		return nil, validators, err
+	}
+
+	r, err = decompress(r, settings.MaxSize)
+
+	return r, validators, err
+}
+
+func downloadFile(link string, settings config.DownloadConfig, validators sourceValidators) (io.ReadCloser,
+	sourceValidators, error) {
+	client := http.Client{
+		Timeout: settings.Timeout,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, sourceValidators{}, err
+	}
+
+	for k, v := range settings.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if validators.etag != "" {
+		req.Header.Set("If-None-Match", validators.etag)
+	}
+
+	if validators.lastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.lastModified)
+	}
+
+	logger().WithField("link", link).Info("starting download")
+
+	backoff := settings.Backoff
+
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		if err == nil {
+			switch resp.StatusCode {
+			case http.StatusOK:
+				return limitSize(resp.Body, settings.MaxSize), sourceValidators{
+					etag:         resp.Header.Get("ETag"),
+					lastModified: resp.Header.Get("Last-Modified"),
+				}, nil
+			case http.StatusNotModified:
+				resp.Body.Close()
+
+				return nil, validators, errNotModified
+			default:
+				resp.Body.Close()
+
+				return nil, sourceValidators{}, fmt.Errorf("couldn't download url, got status code %d",
+					resp.StatusCode)
+			}
+		}
+
+		errNet, ok := err.(net.Error)
+		if !ok || !(errNet.Timeout() || errNet.Temporary()) || attempt > settings.Retries {
+			return nil, sourceValidators{}, err
+		}
+
+		logger().WithField("link", link).WithField("attempt",
+			attempt).Warnf("Temporary network error / Timeout occurred, retrying in %s... %s", backoff, errNet)
+		time.Sleep(backoff)
+
+		backoff *= 2
+	}
+}
+
+func readFile(file string) (io.ReadCloser, error) {
+	logger().WithField("file", file).Info("starting processing of file")
+	file = strings.TrimPrefix(file, "file://")
+
+	return os.Open(file)
+}
+
+// readCloser combines the reader of uncompressed content with the closer of the underlying source
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decompress returns the uncompressed content of gzip, bzip2 and zip sources, other sources unchanged. The content
+// of all files of a zip archive is concatenated
+func decompress(r io.ReadCloser, maxSize int64) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	// errors are returned by the following reads
+	magic, _ := br.Peek(len(zipMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			r.Close()
+
+			return nil, err
+		}
+
+		return readCloser{limitSize(gz, maxSize), r}, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return readCloser{limitSize(bzip2.NewReader(br), maxSize), r}, nil
+	case bytes.HasPrefix(magic, zipMagic):
+		defer r.Close()
+
+		return unzip(br, maxSize)
+	default:
+		return readCloser{br, r}, nil
+	}
+}
+
+func unzip(r io.Reader, maxSize int64) (io.ReadCloser, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var content bytes.Buffer
+
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		limit := int64(0)
+		if maxSize > 0 {
+			if limit = maxSize - int64(content.Len()); limit <= 0 {
+				return nil, errTooLarge
+			}
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = io.Copy(&content, limitSize(f, limit))
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("can't read '%s': %w", file.Name, err)
+		}
+
+		content.WriteByte('\n')
+	}
+
+	return ioutil.NopCloser(&content), nil
+}
+
+// sizeLimitReader returns errTooLarge, if more than the limit is read
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+
+	if l.remaining < 0 {
+		return n, errTooLarge
+	}
+
+	return n, err
+}
+
+// limitSize limits the reader to maxSize bytes, if maxSize is set. The closer of a ReadCloser is kept
+func limitSize(r io.Reader, maxSize int64) io.ReadCloser {
+	var closer io.Closer = ioutil.NopCloser(nil)
+	if c, ok := r.(io.Closer); ok {
+		closer = c
+	}
+
+	if maxSize <= 0 {
+		return readCloser{r, closer}
+	}
+
+	return readCloser{&sizeLimitReader{r: r, remaining: maxSize}, closer}
+}
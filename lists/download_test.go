@@ -0,0 +1,224 @@
+package lists
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/stgnet/blocky/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// bzip2 compressed "blocked1.com\nblocked2.com\n"
+const bzip2List = "425a68393141592653594dcb0b1200000359000010000130001e0ea00020aa8340c840d0342511c429b79294b4a65f1772453850" +
+	"904dcb0b12"
+
+var _ = Describe("Download", func() {
+	read := func(link string, settings config.DownloadConfig) (string, error) {
+		r, _, err := openSource(link, downloadSettings(settings, link), sourceValidators{})
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+
+		content, err := ioutil.ReadAll(r)
+
+		return string(content), err
+	}
+
+	serve := func(content []byte) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, _ = rw.Write(content)
+		}))
+	}
+
+	Describe("Settings", func() {
+		It("should merge the settings of the source with the defaults", func() {
+			cfg := config.DownloadConfig{
+				Timeout: 10 * time.Second,
+				Headers: map[string]string{"User-Agent": "blocky", "X-Token": "default"},
+				Sources: map[string]config.DownloadConfig{
+					"http://example.com/list": {
+						Retries: -1,
+						MaxSize: 1000,
+						Headers: map[string]string{"X-Token": "secret"},
+					},
+				},
+			}
+
+			settings := downloadSettings(cfg, "http://example.com/list")
+			Expect(settings.Timeout).Should(Equal(10 * time.Second))
+			Expect(settings.Retries).Should(Equal(0))
+			Expect(settings.Backoff).Should(Equal(defaultBackoff))
+			Expect(settings.MaxSize).Should(BeNumerically("==", 1000))
+			Expect(settings.Headers).Should(Equal(map[string]string{"User-Agent": "blocky", "X-Token": "secret"}))
+
+			settings = downloadSettings(cfg, "http://example.com/other")
+			Expect(settings.Retries).Should(Equal(defaultRetries))
+			Expect(settings.MaxSize).Should(BeNumerically("==", 0))
+			Expect(settings.Headers).Should(HaveKeyWithValue("X-Token", "default"))
+		})
+	})
+
+	Describe("Conditional download", func() {
+		It("should send the validators and return errNotModified", func() {
+			var requests uint64
+
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				atomic.AddUint64(&requests, 1)
+
+				if req.Header.Get("If-None-Match") == `"v1"` &&
+					req.Header.Get("If-Modified-Since") == "Sun, 18 Oct 2026 10:00:00 GMT" {
+					rw.WriteHeader(http.StatusNotModified)
+
+					return
+				}
+
+				rw.Header().Set("ETag", `"v1"`)
+				rw.Header().Set("Last-Modified", "Sun, 18 Oct 2026 10:00:00 GMT")
+				_, _ = rw.Write([]byte("blocked1.com"))
+			}))
+			defer s.Close()
+
+			settings := downloadSettings(config.DownloadConfig{}, s.URL)
+
+			r, validators, err := openSource(s.URL, settings, sourceValidators{})
+			Expect(err).Should(Succeed())
+			r.Close()
+			Expect(validators).Should(Equal(sourceValidators{etag: `"v1"`,
+				lastModified: "Sun, 18 Oct 2026 10:00:00 GMT"}))
+
+			_, _, err = openSource(s.URL, settings, validators)
+			Expect(err).Should(Equal(errNotModified))
+			Expect(atomic.LoadUint64(&requests)).Should(Equal(uint64(2)))
+		})
+
+		It("should keep the entries of unchanged lists on refresh", func() {
+			var requests uint64
+
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				atomic.AddUint64(&requests, 1)
+
+				if req.Header.Get("If-None-Match") == `"v1"` {
+					rw.WriteHeader(http.StatusNotModified)
+
+					return
+				}
+
+				rw.Header().Set("ETag", `"v1"`)
+				_, _ = rw.Write([]byte("blocked1.com"))
+			}))
+			defer s.Close()
+
+			sut := NewListCache(BLACKLIST, map[string][]string{"gr1": {s.URL}}, config.BlockingConfig{RefreshPeriod: -1})
+			cache := sut.sourceCaches[s.URL]
+
+			sut.refresh()
+
+			Expect(atomic.LoadUint64(&requests)).Should(Equal(uint64(2)))
+			Expect(sut.sourceCaches[s.URL]).Should(BeIdenticalTo(cache))
+
+			found, _ := sut.Match("blocked1.com", []string{"gr1"})
+			Expect(found).Should(BeTrue())
+		})
+	})
+
+	Describe("Compressed sources", func() {
+		It("should read gzip content", func() {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			_, _ = w.Write([]byte("blocked1.com\nblocked2.com\n"))
+			Expect(w.Close()).Should(Succeed())
+
+			s := serve(buf.Bytes())
+			defer s.Close()
+
+			Expect(read(s.URL, config.DownloadConfig{})).Should(Equal("blocked1.com\nblocked2.com\n"))
+		})
+
+		It("should read bzip2 content", func() {
+			data, err := hex.DecodeString(bzip2List)
+			Expect(err).Should(Succeed())
+
+			s := serve(data)
+			defer s.Close()
+
+			Expect(read(s.URL, config.DownloadConfig{})).Should(Equal("blocked1.com\nblocked2.com\n"))
+		})
+
+		It("should concatenate the files of zip content", func() {
+			var buf bytes.Buffer
+			w := zip.NewWriter(&buf)
+			for name, content := range map[string]string{"a/list1.txt": "blocked1.com", "b/list2.txt": "blocked2.com"} {
+				f, err := w.Create(name)
+				Expect(err).Should(Succeed())
+				_, _ = f.Write([]byte(content))
+			}
+			Expect(w.Close()).Should(Succeed())
+
+			s := serve(buf.Bytes())
+			defer s.Close()
+
+			content, err := read(s.URL, config.DownloadConfig{})
+			Expect(err).Should(Succeed())
+			Expect(content).Should(ContainSubstring("blocked1.com\n"))
+			Expect(content).Should(ContainSubstring("blocked2.com\n"))
+		})
+
+		It("should read plain content unchanged", func() {
+			s := serve([]byte("blocked1.com"))
+			defer s.Close()
+
+			Expect(read(s.URL, config.DownloadConfig{})).Should(Equal("blocked1.com"))
+		})
+	})
+
+	Describe("Download settings", func() {
+		It("should fail if the list exceeds the maximum size", func() {
+			s := serve([]byte("blocked1.com\nblocked2.com\n"))
+			defer s.Close()
+
+			_, err := read(s.URL, config.DownloadConfig{MaxSize: 10})
+			Expect(err).Should(Equal(errTooLarge))
+
+			Expect(read(s.URL, config.DownloadConfig{MaxSize: 26})).Should(Equal("blocked1.com\nblocked2.com\n"))
+		})
+
+		It("should send the configured headers", func() {
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				_, _ = rw.Write([]byte(req.Header.Get("Authorization")))
+			}))
+			defer s.Close()
+
+			Expect(read(s.URL, config.DownloadConfig{Sources: map[string]config.DownloadConfig{
+				s.URL: {Headers: map[string]string{"Authorization": "Bearer token"}},
+			}})).Should(Equal("Bearer token"))
+		})
+
+		It("should retry temporary errors with the configured count", func() {
+			var requests uint64
+
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				atomic.AddUint64(&requests, 1)
+				time.Sleep(100 * time.Millisecond)
+			}))
+			defer s.Close()
+
+			_, err := read(s.URL, config.DownloadConfig{
+				Timeout: 20 * time.Millisecond,
+				Retries: 1,
+				Backoff: time.Millisecond,
+			})
+			Expect(err).Should(HaveOccurred())
+			Expect(atomic.LoadUint64(&requests)).Should(Equal(uint64(2)))
+		})
+	})
+})
@@ -2,16 +2,17 @@ package lists
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"io"
 	"net"
-	"net/http"
-	"os"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
 	"github.com/stgnet/blocky/log"
 	"github.com/stgnet/blocky/metrics"
 
@@ -50,28 +51,322 @@ type Matcher interface {
 	Configuration() []string
 }
 
-type ListCache struct {
-	groupCaches map[string][]string
-	lock        sync.RWMutex
+const (
+	wildcardPrefix = "*."
+	adblockPrefix  = "||"
+	adblockSuffix  = "^"
+)
+
+// sourceCache contains the entries of one list source: domains and IPs in a trie and compiled regex entries.
+// It is shared by all groups, which reference the source
+type sourceCache struct {
+	domains    *domainTrie
+	regexes    []*regexp.Regexp
+	exceptions *sourceCache
+}
+
+// newSourceCache creates the cache from the entries. "*.example.com" matches only subdomains, "||example.com^"
+// matches the domain and its subdomains, plain domains match their subdomains only in groups with matchSubdomains.
+// Entries with "@@" prefix are exceptions, they are excluded from the matches of all groups with this source
+func newSourceCache(entries []string) *sourceCache {
+	c := &sourceCache{}
+
+	var exceptions []string
+
+	domains := make([]trieEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry, exceptionPrefix):
+			exceptions = append(exceptions, strings.TrimPrefix(entry, exceptionPrefix))
+		case isRegexEntry(entry):
+			re, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				logger().Warnf("invalid regex entry '%s': %v", entry, err)
+
+				continue
+			}
+
+			c.regexes = append(c.regexes, re)
+		case strings.HasPrefix(entry, wildcardPrefix):
+			domains = append(domains, trieEntry{rest: entry[len(wildcardPrefix):], flags: nodeSubdomains})
+		case strings.HasPrefix(entry, adblockPrefix) && strings.HasSuffix(entry, adblockSuffix):
+			domain := strings.TrimSuffix(strings.TrimPrefix(entry, adblockPrefix), adblockSuffix)
+			domains = append(domains, trieEntry{rest: domain, flags: nodeDomain | nodeSubdomains})
+		case isIP(entry):
+			domains = append(domains, trieEntry{rest: entry, flags: nodeDomain})
+		default:
+			domains = append(domains, trieEntry{rest: entry, flags: nodePlain})
+		}
+	}
+
+	c.domains = newDomainTrie(domains)
+
+	if len(exceptions) > 0 {
+		c.exceptions = newSourceCache(exceptions)
+	}
+
+	return c
+}
+
+// isIP returns true, if the entry is an IP address. The last character of a domain is a letter (top-level domain),
+// so the parsing can be skipped for most entries
+func isIP(entry string) bool {
+	if entry == "" {
+		return false
+	}
+
+	if last := entry[len(entry)-1]; (last < '0' || last > '9') && !strings.Contains(entry, ":") {
+		return false
+	}
+
+	return net.ParseIP(entry) != nil
+}
+
+// isRegexEntry returns true for entries wrapped in slashes, for example "/^ad[0-9]+\.example\.com$/"
+func isRegexEntry(entry string) bool {
+	return len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/")
+}
+
+func (c *sourceCache) len() int {
+	if c == nil {
+		return 0
+	}
+
+	return c.domains.len() + len(c.regexes)
+}
+
+func (c *sourceCache) contains(domain string, matchSubdomains bool) bool {
+	return c != nil && c.domains.match(domain, matchSubdomains)
+}
+
+// matchRegex checks the domain against all regex entries, domain must be lower case
+func (c *sourceCache) matchRegex(domain string) bool {
+	if c == nil {
+		return false
+	}
+
+	for _, re := range c.regexes {
+		if re.MatchString(domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// kinds of the rules found by search
+const (
+	matchExact    = "exact"
+	matchWildcard = "wildcard"
+	matchRegex    = "regex"
+)
+
+// sourceMatch is a rule of a source, which matches a domain
+type sourceMatch struct {
+	rule string
+	kind string
+}
+
+// search returns all rules of the source, which match the domain, domain must be lower case
+func (c *sourceCache) search(domain string, matchSubdomains bool) (result []sourceMatch) {
+	if c == nil {
+		return nil
+	}
+
+	for _, m := range c.domains.matches(domain, matchSubdomains) {
+		result = append(result, m.sourceMatches()...)
+	}
+
+	for _, re := range c.regexes {
+		if re.MatchString(domain) {
+			result = append(result, sourceMatch{rule: "/" + re.String() + "/", kind: matchRegex})
+		}
+	}
+
+	return
+}
+
+// sourceMatches restores the list entries of the trie match from the flags of its node. Entries, which share the
+// node, are returned separately, "*.example.com" and "||example.com^" in the same source are returned as the latter
+func (m trieMatch) sourceMatches() (result []sourceMatch) {
+	adblock := adblockPrefix + m.domain + adblockSuffix
+
+	if m.exact {
+		if m.flags&nodePlain != 0 || m.flags&(nodeDomain|nodeSubdomains) == nodeDomain {
+			result = append(result, sourceMatch{rule: m.domain, kind: matchExact})
+		}
+
+		if m.flags&nodeDomain != 0 && m.flags&nodeSubdomains != 0 {
+			result = append(result, sourceMatch{rule: adblock, kind: matchExact})
+		}
+
+		return
+	}
+
+	if m.plainSubdomains {
+		result = append(result, sourceMatch{rule: m.domain, kind: matchWildcard})
+	}
+
+	switch {
+	case m.flags&nodeSubdomains == 0:
+	case m.flags&nodeDomain != 0:
+		result = append(result, sourceMatch{rule: adblock, kind: matchWildcard})
+	default:
+		result = append(result, sourceMatch{rule: wildcardPrefix + m.domain, kind: matchWildcard})
+	}
+
+	return
+}
+
+// groupCache contains the caches of the sources of one group
+type groupCache struct {
+	sources         []*sourceCache
+	matchSubdomains bool
+}
+
+func (g *groupCache) len() (result int) {
+	if g == nil {
+		return 0
+	}
+
+	for _, c := range g.sources {
+		result += c.len()
+	}
+
+	return
+}
+
+// contains checks the domains and IPs of all sources, domain must be lower case
+func (g *groupCache) contains(domain string) bool {
+	if g == nil {
+		return false
+	}
+
+	for _, c := range g.sources {
+		if c.contains(domain, g.matchSubdomains) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchRegex checks the regex entries of all sources, domain must be lower case
+func (g *groupCache) matchRegex(domain string) bool {
+	if g == nil {
+		return false
+	}
+
+	for _, c := range g.sources {
+		if c.matchRegex(domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *groupCache) hasRegexes() bool {
+	if g == nil {
+		return false
+	}
+
+	for _, c := range g.sources {
+		if len(c.regexes) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isException returns true, if the domain matches one of the exceptions of the sources
+func (g *groupCache) isException(domain string) bool {
+	if g == nil {
+		return false
+	}
+
+	for _, c := range g.sources {
+		if c.exceptions.contains(domain, false) || c.exceptions.matchRegex(domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrUnknownGroup is returned, if a group to refresh isn't configured
+var ErrUnknownGroup = errors.New("unknown group")
+
+// sourceStats contains the result of the last import of a list source. refreshed is the time of the last successful
+// import, lastError the error of the last attempt
+type sourceStats struct {
+	format     listFormat
+	entries    int
+	invalid    int
+	validators sourceValidators
+	refreshed  time.Time
+	lastError  string
+}
 
-	groupToLinks  map[string][]string
-	refreshPeriod time.Duration
+// sourceResult is the content of a list source. err is set, if the source couldn't be read, temporaryError, if the
+// error is temporary. notModified is set, if the source wasn't changed since the last download. updated is the time
+// the content was read
+type sourceResult struct {
+	link           string
+	err            error
+	temporaryError bool
+	notModified    bool
+	validators     sourceValidators
+	updated        time.Time
+	parseResult
+}
 
-	counter *prometheus.GaugeVec
+type ListCache struct {
+	groupCaches  map[string]*groupCache
+	sourceCaches map[string]*sourceCache
+	lock         sync.RWMutex
+	refreshLock  sync.Mutex
+
+	listType ListCacheType
+
+	groupToLinks    map[string][]string
+	sources         map[string]sourceStats
+	matchSubdomains map[string]bool
+	store           *listStore
+	download        config.DownloadConfig
+	refreshPeriod   time.Duration
+	stop            chan struct{}
+
+	counter       *prometheus.GaugeVec
+	regexDuration prometheus.Histogram
 }
 
 func (b *ListCache) Configuration() (result []string) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
 	if b.refreshPeriod > 0 {
 		result = append(result, fmt.Sprintf("refresh period: %d minutes", b.refreshPeriod/time.Minute))
 	} else {
 		result = append(result, "refresh: disabled")
 	}
 
+	if b.store != nil {
+		result = append(result, fmt.Sprintf("list cache directory: %s", b.store.dir))
+	}
+
 	result = append(result, "group links:")
 	for group, links := range b.groupToLinks {
 		result = append(result, fmt.Sprintf("  %s:", group))
 		for _, link := range links {
-			result = append(result, fmt.Sprintf("   - %s", link))
+			if stats, found := b.sources[link]; found && stats.format != "" {
+				result = append(result, fmt.Sprintf("   - %s (format %s, %d entries, %d invalid lines)", link,
+					stats.format, stats.entries, stats.invalid))
+			} else {
+				result = append(result, fmt.Sprintf("   - %s", link))
+			}
 		}
 	}
 
@@ -80,8 +375,8 @@ func (b *ListCache) Configuration() (result []string) {
 	var total int
 
 	for group, cache := range b.groupCaches {
-		result = append(result, fmt.Sprintf("  %s: %d entries", group, len(cache)))
-		total += len(cache)
+		result = append(result, fmt.Sprintf("  %s: %d entries", group, cache.len()))
+		total += cache.len()
 	}
 
 	result = append(result, fmt.Sprintf("  TOTAL: %d entries", total))
@@ -89,16 +384,27 @@ func (b *ListCache) Configuration() (result []string) {
 	return
 }
 
-func NewListCache(t ListCacheType, groupToLinks map[string][]string, refreshPeriod int) *ListCache {
-	groupCaches := make(map[string][]string)
+// NewListCache creates the cache and loads the lists of all groups. Refresh period, matchSubdomains, list cache
+// directory and download settings are taken from cfg, its black and white lists are ignored. The entries of groups in
+// matchSubdomains match their subdomains too. If the list cache directory is set, remote lists are stored there after
+// each download. On creation, the groups are loaded from the stored lists and the download runs in background
+func NewListCache(t ListCacheType, groupToLinks map[string][]string, cfg config.BlockingConfig) *ListCache {
+	groupCaches := make(map[string]*groupCache)
+
+	subdomainGroups := make(map[string]bool, len(cfg.MatchSubdomains))
+	for _, g := range cfg.MatchSubdomains {
+		subdomainGroups[g] = true
+	}
 
-	p := time.Duration(refreshPeriod) * time.Minute
-	if refreshPeriod == 0 {
+	p := time.Duration(cfg.RefreshPeriod) * time.Minute
+	if cfg.RefreshPeriod == 0 {
 		p = defaultRefreshPeriod
 	}
 
 	var counter *prometheus.GaugeVec
 
+	var regexDuration prometheus.Histogram
+
 	if metrics.IsEnabled() {
 		counter = prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -107,15 +413,45 @@ func NewListCache(t ListCacheType, groupToLinks map[string][]string, refreshPeri
 			}, []string{"group"},
 		)
 
-		metrics.RegisterMetric(counter)
+		counter = metrics.ReplaceMetric(counter).(*prometheus.GaugeVec)
+
+		regexDuration = prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    fmt.Sprintf("blocky_%s_regex_duration_seconds", t),
+				Help:    "Duration of the matching of a domain against the regex entries",
+				Buckets: prometheus.ExponentialBuckets(0.00001, 4, 8),
+			},
+		)
+
+		regexDuration = metrics.RegisterMetric(regexDuration).(prometheus.Histogram)
 	}
 
 	b := &ListCache{
-		groupToLinks:  groupToLinks,
-		groupCaches:   groupCaches,
-		refreshPeriod: p,
-		counter:       counter,
+		listType:        t,
+		groupToLinks:    groupToLinks,
+		groupCaches:     groupCaches,
+		sourceCaches:    make(map[string]*sourceCache),
+		sources:         make(map[string]sourceStats),
+		matchSubdomains: subdomainGroups,
+		store:           newListStore(cfg.ListCacheDir),
+		download:        cfg.Download,
+		refreshPeriod:   p,
+		counter:         counter,
+		regexDuration:   regexDuration,
+		stop:            make(chan struct{}),
+	}
+
+	if b.store != nil {
+		b.loadStored()
+
+		go func() {
+			b.refresh()
+			periodicUpdate(b)
+		}()
+
+		return b
 	}
+
 	b.refresh()
 
 	go periodicUpdate(b)
@@ -130,216 +466,393 @@ func periodicUpdate(cache *ListCache) {
 		defer ticker.Stop()
 
 		for {
-			<-ticker.C
-			cache.refresh()
+			select {
+			case <-ticker.C:
+				cache.refresh()
+			case <-cache.stop:
+				return
+			}
 		}
 	}
 }
 
+// Stop stops the periodical refresh of list entries
+func (b *ListCache) Stop() {
+	close(b.stop)
+}
+
 func logger() *logrus.Entry {
 	return log.Logger.WithField("prefix", "list_cache")
 }
 
-// downloads and reads files with domain names and creates cache for them
-func createCacheForGroup(links []string) []string {
-	cache := make([]string, 0)
-
-	keys := make(map[string]bool)
-
+// downloads and reads all files with domain names and returns their results
+func (b *ListCache) loadSources(links []string) []*sourceResult {
 	var wg sync.WaitGroup
 
-	c := make(chan []string, len(links))
+	c := make(chan *sourceResult, len(links))
 
 	for _, link := range links {
+		b.lock.RLock()
+		validators := b.sources[link].validators
+		b.lock.RUnlock()
+
 		wg.Add(1)
 
-		go processFile(link, c, &wg)
+		go processFile(link, downloadSettings(b.download, link), validators, c, &wg)
 	}
 
 	wg.Wait()
+	close(c)
 
-Loop:
-	for {
-		select {
-		case res := <-c:
-			if res == nil {
-				return nil
-			}
-			for _, entry := range res {
-				if _, value := keys[entry]; !value {
-					keys[entry] = true
-					cache = append(cache, entry)
-				}
-			}
-		default:
-			close(c)
-			break Loop
-		}
+	result := make([]*sourceResult, 0, len(links))
+	for res := range c {
+		result = append(result, res)
 	}
 
-	sort.Strings(cache)
-
-	return cache
+	return result
 }
 
 func (b *ListCache) Match(domain string, groupsToCheck []string) (found bool, group string) {
 	b.lock.RLock()
 	defer b.lock.RUnlock()
 
+	domain = strings.ToLower(domain)
+
 	for _, g := range groupsToCheck {
-		if contains(domain, b.groupCaches[g]) {
+		if cache := b.groupCaches[g]; cache.contains(domain) && !cache.isException(domain) {
 			return true, g
 		}
 	}
 
-	return false, ""
+	return b.matchRegex(domain, groupsToCheck)
 }
 
-func contains(domain string, cache []string) bool {
-	idx := sort.SearchStrings(cache, domain)
-	if idx < len(cache) {
-		return cache[idx] == strings.ToLower(domain)
+// matchRegex checks the regex entries of the groups, must be called with read lock
+func (b *ListCache) matchRegex(domain string, groupsToCheck []string) (found bool, group string) {
+	var start time.Time
+
+	for _, g := range groupsToCheck {
+		cache := b.groupCaches[g]
+		if !cache.hasRegexes() {
+			continue
+		}
+
+		if start.IsZero() {
+			start = time.Now()
+		}
+
+		if cache.matchRegex(domain) && !cache.isException(domain) {
+			found, group = true, g
+
+			break
+		}
 	}
 
-	return false
+	if b.regexDuration != nil && !start.IsZero() {
+		b.regexDuration.Observe(time.Since(start).Seconds())
+	}
+
+	return
+}
+
+// links returns all links of the groups without duplicates
+func (b *ListCache) links() (result []string) {
+	seen := make(map[string]bool)
+
+	for _, groupLinks := range b.groupToLinks {
+		for _, link := range groupLinks {
+			if !seen[link] {
+				seen[link] = true
+				result = append(result, link)
+			}
+		}
+	}
+
+	return
+}
+
+// loadStored creates the groups from the stored remote lists and the local files
+func (b *ListCache) loadStored() {
+	var local []string
+
+	for _, link := range b.links() {
+		if !isRemote(link) {
+			local = append(local, link)
+		} else if source := b.store.load(link); source != nil {
+			b.setSource(source)
+		}
+	}
+
+	for _, source := range b.loadSources(local) {
+		if !source.temporaryError {
+			b.setSource(source)
+		}
+	}
+
+	b.updateGroups()
+}
+
+// Refresh loads the lists of the group immediately, the lists of all groups if group is empty
+func (b *ListCache) Refresh(group string) error {
+	if group == "" {
+		b.refresh()
+
+		return nil
+	}
+
+	links, found := b.groupToLinks[group]
+	if !found {
+		return fmt.Errorf("%w '%s'", ErrUnknownGroup, group)
+	}
+
+	b.refreshLinks(links)
+
+	return nil
 }
 
+// refresh loads each source once and creates the caches of the groups, which share the caches of their sources
 func (b *ListCache) refresh() {
-	for group, links := range b.groupToLinks {
-		cacheForGroup := createCacheForGroup(links)
-
-		if cacheForGroup != nil {
-			b.lock.Lock()
-			b.groupCaches[group] = cacheForGroup
-			b.lock.Unlock()
-		} else {
-			logger().Warn("Populating of group cache failed, leaving items from last successful download in cache")
+	b.refreshLinks(b.links())
+}
+
+// refreshLinks loads the sources of the links and updates the caches of the groups. Concurrent refreshes are
+// serialized
+func (b *ListCache) refreshLinks(links []string) {
+	b.refreshLock.Lock()
+	defer b.refreshLock.Unlock()
+
+	for _, source := range b.loadSources(links) {
+		if source.notModified {
+			b.updateStats(source.link, func(stats *sourceStats) {
+				stats.refreshed = time.Now()
+				stats.lastError = ""
+			})
+
+			continue
 		}
 
-		if metrics.IsEnabled() {
-			b.counter.WithLabelValues(group).Set(float64(len(b.groupCaches[group])))
+		// with list store, the last successful download of a remote list is kept on each error
+		if source.temporaryError || (source.err != nil && b.store != nil && isRemote(source.link)) {
+			logger().WithField("source", source.link).Warn("Populating of source cache failed, " +
+				"leaving items from last successful download in cache")
+
+			b.updateStats(source.link, func(stats *sourceStats) {
+				stats.lastError = source.err.Error()
+			})
+
+			continue
 		}
 
-		logger().WithFields(logrus.Fields{
-			"group":       group,
-			"total_count": len(b.groupCaches[group]),
-		}).Info("group import finished")
+		b.setSource(source)
+
+		if source.err == nil && isRemote(source.link) {
+			b.store.save(source)
+		}
 	}
+
+	b.updateGroups()
 }
 
-func downloadFile(link string) (io.ReadCloser, error) {
-	client := http.Client{
-		Timeout: timeout,
+// setSource creates the cache of the source
+func (b *ListCache) setSource(source *sourceResult) {
+	cache := newSourceCache(source.entries)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	stats := sourceStats{
+		format:     source.format,
+		entries:    len(source.entries),
+		invalid:    source.invalid,
+		validators: source.validators,
+		refreshed:  source.updated,
+	}
+
+	if source.err != nil {
+		stats.refreshed = b.sources[source.link].refreshed
+		stats.lastError = source.err.Error()
 	}
 
-	var resp *http.Response
+	b.sourceCaches[source.link] = cache
+	b.sources[source.link] = stats
+}
+
+// updateStats changes the stats of the source
+func (b *ListCache) updateStats(link string, update func(stats *sourceStats)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	stats := b.sources[link]
+	update(&stats)
+	b.sources[link] = stats
+}
+
+// Search returns all rules of all groups and sources, which match the domain, sorted by group. Matching exceptions
+// are returned too
+func (b *ListCache) Search(domain string) (result []api.ListMatch) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	domain = strings.ToLower(domain)
+
+	groups := make([]string, 0, len(b.groupToLinks))
+	for group := range b.groupToLinks {
+		groups = append(groups, group)
+	}
 
-	var err error
+	sort.Strings(groups)
 
-	logger().WithField("link", link).Info("starting download")
+	for _, group := range groups {
+		for _, link := range b.groupToLinks[group] {
+			cache := b.sourceCaches[link]
 
-	attempt := 1
+			for _, m := range cache.search(domain, b.matchSubdomains[group]) {
+				result = append(result, api.ListMatch{Type: b.listType.String(), Group: group, Link: link,
+					Rule: m.rule, Kind: m.kind})
+			}
 
-	for attempt <= 3 {
-		//nolint:bodyclose
-		if resp, err = client.Get(link); err == nil {
-			if resp.StatusCode == http.StatusOK {
-				return resp.Body, nil
+			for _, m := range cache.exceptions.search(domain, false) {
+				result = append(result, api.ListMatch{Type: b.listType.String(), Group: group, Link: link,
+					Rule: exceptionPrefix + m.rule, Kind: m.kind, Exception: true})
 			}
+		}
+	}
+
+	return
+}
+
+// Status returns the state of all groups and their sources, sorted by group name
+func (b *ListCache) Status() []api.ListGroupStatus {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
 
-			resp.Body.Close()
+	result := make([]api.ListGroupStatus, 0, len(b.groupToLinks))
 
-			return nil, fmt.Errorf("couldn't download url, got status code %d", resp.StatusCode)
+	for group, links := range b.groupToLinks {
+		status := api.ListGroupStatus{
+			Type:    b.listType.String(),
+			Group:   group,
+			Entries: b.groupCaches[group].len(),
+			Sources: make([]api.ListSourceStatus, 0, len(links)),
 		}
 
-		if errNet, ok := err.(net.Error); ok && (errNet.Timeout() || errNet.Temporary()) {
-			logger().WithField("link", link).WithField("attempt",
-				attempt).Warnf("Temporary network error / Timeout occurred, retrying... %s", errNet)
-			time.Sleep(time.Second)
-			attempt++
-		} else {
-			return nil, err
+		for _, link := range links {
+			stats := b.sources[link]
+			source := api.ListSourceStatus{
+				Link:         link,
+				Format:       string(stats.format),
+				Entries:      stats.entries,
+				InvalidLines: stats.invalid,
+				LastError:    stats.lastError,
+			}
+
+			if !stats.refreshed.IsZero() {
+				refreshed := stats.refreshed
+				source.LastRefresh = &refreshed
+			}
+
+			status.Sources = append(status.Sources, source)
 		}
+
+		result = append(result, status)
 	}
 
-	return nil, err
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Group < result[j].Group
+	})
+
+	return result
 }
 
-func readFile(file string) (io.ReadCloser, error) {
-	logger().WithField("file", file).Info("starting processing of file")
-	file = strings.TrimPrefix(file, "file://")
+// updateGroups creates the caches of all groups from the caches of their sources
+func (b *ListCache) updateGroups() {
+	for group, groupLinks := range b.groupToLinks {
+		cacheForGroup := &groupCache{matchSubdomains: b.matchSubdomains[group]}
+
+		b.lock.Lock()
+		for _, link := range groupLinks {
+			if cache, found := b.sourceCaches[link]; found {
+				cacheForGroup.sources = append(cacheForGroup.sources, cache)
+			}
+		}
+
+		b.groupCaches[group] = cacheForGroup
+		b.lock.Unlock()
+
+		if metrics.IsEnabled() {
+			b.counter.WithLabelValues(group).Set(float64(cacheForGroup.len()))
+		}
 
-	return os.Open(file)
+		logger().WithFields(logrus.Fields{
+			"group":       group,
+			"total_count": cacheForGroup.len(),
+		}).Info("group import finished")
+	}
 }
 
-// downloads file (or reads local file) and writes file content as string array in the channel
-func processFile(link string, ch chan<- []string, wg *sync.WaitGroup) {
+func isRemote(link string) bool {
+	return strings.HasPrefix(link, "http")
+}
+
+// downloads file (or reads local file), parses the lines in the detected format and writes the result in the channel.
+// Remote sources are downloaded conditionally, if validators of the last download are passed
+func processFile(link string, settings config.DownloadConfig, validators sourceValidators, ch chan<- *sourceResult,
+	wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	result := make([]string, 0)
+	r, validators, err := openSource(link, settings, validators)
 
-	var r io.ReadCloser
+	if errors.Is(err, errNotModified) {
+		logger().WithField("link", link).Info("list not modified since last download")
 
-	var err error
+		ch <- &sourceResult{link: link, notModified: true}
 
-	if strings.HasPrefix(link, "http") {
-		r, err = downloadFile(link)
-	} else {
-		r, err = readFile(link)
+		return
 	}
 
 	if err != nil {
 		logger().Warn("error reading "+link+": ", err)
 
 		if errNet, ok := err.(net.Error); ok && (errNet.Timeout() || errNet.Temporary()) {
-			// put nil to indicate the temporary error
-			ch <- nil
+			ch <- &sourceResult{link: link, err: err, temporaryError: true}
 			return
 		}
-		ch <- []string{}
+		ch <- &sourceResult{link: link, err: err}
 
 		return
 	}
 	defer r.Close()
 
-	var count int
+	var lines []string
 
 	scanner := bufio.NewScanner(r)
 
 	for scanner.Scan() {
-		line := scanner.Text()
-		// skip comments
-		if !strings.HasPrefix(line, "#") {
-			result = append(result, processLine(line))
-
-			count++
-		}
+		lines = append(lines, scanner.Text())
 	}
 
 	if err := scanner.Err(); err != nil {
-		logger().Warn("can't parse file: ", err)
-	} else {
-		logger().WithFields(logrus.Fields{
-			"source": link,
-			"count":  count,
-		}).Info("file imported")
+		logger().Warn("can't read "+link+": ", err)
+
+		ch <- &sourceResult{link: link, err: err}
+
+		return
 	}
-	ch <- result
-}
 
-// return only first column (see hosts format)
-func processLine(line string) string {
-	parts := strings.Fields(line)
-	if len(parts) > 0 {
-		host := parts[len(parts)-1]
+	result := &sourceResult{link: link, validators: validators, updated: time.Now(),
+		parseResult: parseLines(lines, isRemote(link))}
 
-		ip := net.ParseIP(host)
-		if ip != nil {
-			return ip.String()
-		}
+	logger().WithFields(logrus.Fields{
+		"source":  link,
+		"format":  result.format,
+		"count":   len(result.entries),
+		"invalid": result.invalid,
+	}).Info("file imported")
 
-		return strings.ToLower(host)
+	if result.invalid > 0 {
+		logger().WithField("source", link).Warnf("%d lines couldn't be parsed as %s format", result.invalid,
+			result.format)
 	}
 
-	return ""
+	ch <- result
 }
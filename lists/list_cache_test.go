@@ -1,9 +1,11 @@
 package lists
 
 import (
+	"github.com/stgnet/blocky/api"
 	"github.com/stgnet/blocky/config"
 	. "github.com/stgnet/blocky/helpertest"
 	"github.com/stgnet/blocky/metrics"
+	"io/ioutil"
 	"net/http"
 	"sync/atomic"
 	"time"
@@ -52,7 +54,7 @@ var _ = Describe("ListCache", func() {
 				lists := map[string][]string{
 					"gr1": {emptyFile.Name()},
 				}
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 
 				found, group := sut.Match("google.com", []string{"gr1"})
 				Expect(found).Should(BeFalse())
@@ -79,7 +81,7 @@ var _ = Describe("ListCache", func() {
 				}
 
 				timeout = 100 * time.Millisecond
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 				time.Sleep(time.Second)
 				found, group := sut.Match("blocked1.com", []string{"gr1"})
 				Expect(found).Should(BeTrue())
@@ -106,7 +108,7 @@ var _ = Describe("ListCache", func() {
 				}
 
 				timeout = 100 * time.Millisecond
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 				time.Sleep(time.Second)
 				By("Lists loaded without timeout", func() {
 					found, group := sut.Match("blocked1.com", []string{"gr1"})
@@ -142,7 +144,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {s.URL},
 				}
 
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 				time.Sleep(time.Second)
 				By("Lists loaded without error", func() {
 					found, group := sut.Match("blocked1.com", []string{"gr1"})
@@ -166,7 +168,7 @@ var _ = Describe("ListCache", func() {
 					"gr2": {server3.URL},
 				}
 
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 
 				found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
 				Expect(found).Should(BeTrue())
@@ -187,7 +189,7 @@ var _ = Describe("ListCache", func() {
 					"withDeadLink": {"http://wrong.host.name"},
 				}
 
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 
 				found, group := sut.Match("blocked1.com", []string{})
 				Expect(found).Should(BeFalse())
@@ -201,7 +203,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {server1.URL},
 				}
 
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 
 				found, group := sut.Match("blocked1.com", []string{})
 				Expect(found).Should(BeFalse())
@@ -216,7 +218,7 @@ var _ = Describe("ListCache", func() {
 					"gr2": {"file://" + file3.Name()},
 				}
 
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 
 				found, group := sut.Match("blocked1.com", []string{"gr1", "gr2"})
 				Expect(found).Should(BeTrue())
@@ -231,6 +233,237 @@ var _ = Describe("ListCache", func() {
 				Expect(group).Should(Equal("gr2"))
 			})
 		})
+		When("list contains wildcard and adblock entries", func() {
+			It("should match subdomains", func() {
+				file := TempFile("*.wildcard.com\n||Adblock.com^\nexact.com")
+				defer os.Remove(file.Name())
+
+				sut := NewListCache(BLACKLIST, map[string][]string{"gr1": {file.Name()}}, config.BlockingConfig{})
+
+				for domain, expected := range map[string]bool{
+					"wildcard.com":        false,
+					"ads.wildcard.com":    true,
+					"a.b.wildcard.com":    true,
+					"otherwildcard.com":   false,
+					"adblock.com":         true,
+					"tracker.Adblock.com": true,
+					"exact.com":           true,
+					"sub.exact.com":       false,
+				} {
+					found, _ := sut.Match(domain, []string{"gr1"})
+					Expect(found).Should(Equal(expected), domain)
+				}
+			})
+		})
+		When("list contains regex entries", func() {
+			It("should match with regex after exact and suffix lookups", func() {
+				file := TempFile("/^[a-z0-9]{8}\\.tracker\\.com$/\n/[/\nexact.com")
+				defer os.Remove(file.Name())
+				server := TestServer("/^ad[0-9]+\\.remote\\.com$/")
+				defer server.Close()
+
+				sut := NewListCache(BLACKLIST, map[string][]string{
+					"gr1": {file.Name()},
+					"gr2": {server.URL},
+				}, config.BlockingConfig{})
+
+				found, group := sut.Match("X7k2p9qa.tracker.com", []string{"gr2", "gr1"})
+				Expect(found).Should(BeTrue())
+				Expect(group).Should(Equal("gr1"))
+
+				found, _ = sut.Match("sub.x7k2p9qa.tracker.com", []string{"gr1"})
+				Expect(found).Should(BeFalse())
+
+				found, _ = sut.Match("exact.com", []string{"gr1"})
+				Expect(found).Should(BeTrue())
+
+				By("regex entries of remote lists are ignored", func() {
+					found, _ = sut.Match("ad1.remote.com", []string{"gr2"})
+					Expect(found).Should(BeFalse())
+				})
+			})
+		})
+		When("list cache directory is configured", func() {
+			It("should load the stored lists on startup and refresh in background", func() {
+				dir, err := ioutil.TempDir("", "blocky-lists")
+				Expect(err).Should(Succeed())
+				defer os.RemoveAll(dir)
+
+				s := TestServer("blocked1.com")
+				lists := map[string][]string{
+					"gr1": {s.URL, file2.Name()},
+				}
+
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{RefreshPeriod: -1, ListCacheDir: dir})
+				Eventually(func() bool {
+					found, _ := sut.Match("blocked1.com", []string{"gr1"})
+
+					return found
+				}).Should(BeTrue())
+				Eventually(func() []os.FileInfo {
+					files, _ := ioutil.ReadDir(dir)
+
+					return files
+				}).Should(HaveLen(1))
+
+				By("server is not reachable", func() {
+					s.Close()
+
+					sut = NewListCache(BLACKLIST, lists, config.BlockingConfig{RefreshPeriod: -1, ListCacheDir: dir})
+
+					found, group := sut.Match("blocked1.com", []string{"gr1"})
+					Expect(found).Should(BeTrue())
+					Expect(group).Should(Equal("gr1"))
+
+					found, _ = sut.Match("blocked2.com", []string{"gr1"})
+					Expect(found).Should(BeTrue())
+
+					sut.refresh()
+
+					found, _ = sut.Match("blocked1.com", []string{"gr1"})
+					Expect(found).Should(BeTrue())
+				})
+			})
+		})
+		When("multiple groups reference the same source", func() {
+			It("should load the source only once and share its entries", func() {
+				var requests uint64
+				s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					atomic.AddUint64(&requests, 1)
+					_, err := rw.Write([]byte("blocked1.com\nblocked2.com"))
+					Expect(err).Should(Succeed())
+				}))
+				defer s.Close()
+
+				sut := NewListCache(BLACKLIST, map[string][]string{
+					"gr1": {s.URL},
+					"gr2": {s.URL, file3.Name()},
+				}, config.BlockingConfig{})
+
+				Expect(atomic.LoadUint64(&requests)).Should(Equal(uint64(1)))
+				Expect(sut.groupCaches["gr1"].sources[0]).Should(BeIdenticalTo(sut.sourceCaches[s.URL]))
+				Expect(sut.groupCaches["gr2"].sources).Should(ContainElement(BeIdenticalTo(sut.sourceCaches[s.URL])))
+
+				found, group := sut.Match("blocked3.com", []string{"gr1", "gr2"})
+				Expect(found).Should(BeTrue())
+				Expect(group).Should(Equal("gr2"))
+			})
+		})
+		When("group matches subdomains", func() {
+			It("should match subdomains of all entries, but not of IPs", func() {
+				file := TempFile("doubleclick.net\n192.168.178.55")
+				defer os.Remove(file.Name())
+
+				sut := NewListCache(BLACKLIST, map[string][]string{
+					"gr1": {file.Name()},
+					"gr2": {file.Name()},
+				}, config.BlockingConfig{MatchSubdomains: []string{"gr1"}})
+
+				found, group := sut.Match("ad.doubleclick.net", []string{"gr2", "gr1"})
+				Expect(found).Should(BeTrue())
+				Expect(group).Should(Equal("gr1"))
+
+				found, _ = sut.Match("doubleclick.net", []string{"gr2"})
+				Expect(found).Should(BeTrue())
+
+				found, _ = sut.Match("1.192.168.178.55", []string{"gr1"})
+				Expect(found).Should(BeFalse())
+			})
+		})
+	})
+	Describe("Search", func() {
+		It("should return all matching rules of all groups and sources", func() {
+			file := TempFile("*.example.com\n||ads.example.com^\nexample.com\n/^ad[0-9]*\\.example\\.com$/")
+			defer os.Remove(file.Name())
+			adblock := TempFile("||example.com^\n@@||good.example.com^")
+			defer os.Remove(adblock.Name())
+
+			sut := NewListCache(WHITELIST, map[string][]string{
+				"gr1": {file.Name(), adblock.Name()},
+				"gr2": {file2.Name(), file.Name()},
+			}, config.BlockingConfig{RefreshPeriod: -1, MatchSubdomains: []string{"gr2"}})
+
+			Expect(sut.Search("AD.example.com")).Should(Equal([]api.ListMatch{
+				{Type: "whitelist", Group: "gr1", Link: file.Name(), Rule: "*.example.com", Kind: "wildcard"},
+				{Type: "whitelist", Group: "gr1", Link: file.Name(), Rule: "/^ad[0-9]*\\.example\\.com$/",
+					Kind: "regex"},
+				{Type: "whitelist", Group: "gr1", Link: adblock.Name(), Rule: "||example.com^", Kind: "wildcard"},
+				{Type: "whitelist", Group: "gr2", Link: file.Name(), Rule: "example.com", Kind: "wildcard"},
+				{Type: "whitelist", Group: "gr2", Link: file.Name(), Rule: "*.example.com", Kind: "wildcard"},
+				{Type: "whitelist", Group: "gr2", Link: file.Name(), Rule: "/^ad[0-9]*\\.example\\.com$/",
+					Kind: "regex"},
+			}))
+
+			Expect(sut.Search("ads.example.com")).Should(ContainElement(api.ListMatch{Type: "whitelist",
+				Group: "gr1", Link: file.Name(), Rule: "||ads.example.com^", Kind: "exact"}))
+			Expect(sut.Search("example.com")).Should(ContainElement(api.ListMatch{Type: "whitelist",
+				Group: "gr1", Link: file.Name(), Rule: "example.com", Kind: "exact"}))
+			Expect(sut.Search("good.example.com")).Should(ContainElement(api.ListMatch{Type: "whitelist",
+				Group: "gr1", Link: adblock.Name(), Rule: "@@||good.example.com^", Kind: "exact", Exception: true}))
+			Expect(sut.Search("other.com")).Should(BeEmpty())
+		})
+	})
+	Describe("Status and refresh", func() {
+		It("should report the state of the sources and refresh single groups", func() {
+			var fail uint64
+
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if atomic.LoadUint64(&fail) == 1 {
+					rw.WriteHeader(http.StatusInternalServerError)
+
+					return
+				}
+				_, _ = rw.Write([]byte("blocked1.com\nblocked2.com\n!invalid"))
+			}))
+			defer s.Close()
+
+			sut := NewListCache(BLACKLIST, map[string][]string{
+				"gr1": {s.URL},
+				"gr2": {file2.Name()},
+			}, config.BlockingConfig{RefreshPeriod: -1})
+
+			By("status after startup", func() {
+				status := sut.Status()
+				Expect(status).Should(HaveLen(2))
+				Expect(status[0].Type).Should(Equal("blacklist"))
+				Expect(status[0].Group).Should(Equal("gr1"))
+				Expect(status[0].Entries).Should(Equal(2))
+				Expect(status[0].Sources).Should(HaveLen(1))
+
+				source := status[0].Sources[0]
+				Expect(source.Link).Should(Equal(s.URL))
+				Expect(source.Format).Should(Equal("hosts"))
+				Expect(source.Entries).Should(Equal(2))
+				Expect(source.InvalidLines).Should(Equal(1))
+				Expect(source.LastRefresh).ShouldNot(BeNil())
+				Expect(source.LastError).Should(BeEmpty())
+			})
+
+			By("refresh of a single group", func() {
+				atomic.StoreUint64(&fail, 1)
+				_, _ = file2.WriteString("\nblocked2a.com")
+
+				Expect(sut.Refresh("gr2")).Should(Succeed())
+
+				status := sut.Status()
+				Expect(status[0].Sources[0].LastError).Should(BeEmpty())
+				Expect(status[1].Entries).Should(Equal(2))
+			})
+
+			By("refresh with error", func() {
+				refreshed := *sut.Status()[0].Sources[0].LastRefresh
+
+				Expect(sut.Refresh("")).Should(Succeed())
+
+				source := sut.Status()[0].Sources[0]
+				Expect(source.LastError).Should(ContainSubstring("status code 500"))
+				Expect(*source.LastRefresh).Should(Equal(refreshed))
+			})
+
+			By("unknown group", func() {
+				Expect(sut.Refresh("unknown")).Should(MatchError(ErrUnknownGroup))
+			})
+		})
 	})
 	Describe("Configuration", func() {
 		When("refresh is enabled", func() {
@@ -239,7 +472,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {server1.URL, server2.URL},
 				}
 
-				sut := NewListCache(BLACKLIST, lists, 0)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{})
 
 				c := sut.Configuration()
 				Expect(c).Should(HaveLen(8))
@@ -251,7 +484,7 @@ var _ = Describe("ListCache", func() {
 					"gr1": {"file1", "file2"},
 				}
 
-				sut := NewListCache(BLACKLIST, lists, -1)
+				sut := NewListCache(BLACKLIST, lists, config.BlockingConfig{RefreshPeriod: -1})
 
 				c := sut.Configuration()
 				Expect(c).Should(ContainElement("refresh: disabled"))
@@ -0,0 +1,158 @@
+package lists
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// listStoreVersion is the version of the file format, files with another version are ignored
+const listStoreVersion = 1
+
+// storedList is the content of a list source in the list store
+type storedList struct {
+	Version      int        `json:"version"`
+	Link         string     `json:"link"`
+	Updated      time.Time  `json:"updated"`
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"lastModified,omitempty"`
+	Format       listFormat `json:"format"`
+	Invalid      int        `json:"invalid"`
+	Entries      []string   `json:"entries"`
+}
+
+// listStore persists the last successfully parsed content of each remote list source in a directory (one gzipped
+// JSON file per source). A nil store does nothing
+type listStore struct {
+	dir string
+}
+
+// newListStore creates the directory, returns nil if dir is empty or can't be created
+func newListStore(dir string) *listStore {
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		logger().Warnf("can't create list cache directory '%s', lists are not stored: %v", dir, err)
+
+		return nil
+	}
+
+	return &listStore{dir: dir}
+}
+
+func (s *listStore) path(link string) string {
+	hash := sha256.Sum256([]byte(link))
+
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:])+".json.gz")
+}
+
+// load returns the stored content of the source, nil if there is none
+func (s *listStore) load(link string) *sourceResult {
+	if s == nil {
+		return nil
+	}
+
+	stored, err := s.read(link)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger().WithField("link", link).Warn("can't read stored list: ", err)
+		}
+
+		return nil
+	}
+
+	if stored.Version != listStoreVersion || stored.Link != link {
+		logger().WithField("link", link).Warnf("ignoring stored list with version %d", stored.Version)
+
+		return nil
+	}
+
+	logger().WithField("link", link).Infof("loaded %d entries from list cache (updated %s)", len(stored.Entries),
+		stored.Updated.Format(time.RFC3339))
+
+	return &sourceResult{link: link, updated: stored.Updated, validators: sourceValidators{
+		etag:         stored.ETag,
+		lastModified: stored.LastModified,
+	}, parseResult: parseResult{
+		format:  stored.Format,
+		entries: stored.Entries,
+		invalid: stored.Invalid,
+	}}
+}
+
+func (s *listStore) read(link string) (*storedList, error) {
+	f, err := os.Open(s.path(link))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var stored storedList
+
+	if err := json.NewDecoder(r).Decode(&stored); err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+// save stores the content of the source. The file is replaced atomically
+func (s *listStore) save(source *sourceResult) {
+	if s == nil {
+		return
+	}
+
+	if err := s.write(source); err != nil {
+		logger().WithField("link", source.link).Warn("can't store list: ", err)
+	}
+}
+
+func (s *listStore) write(source *sourceResult) error {
+	f, err := ioutil.TempFile(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	w := gzip.NewWriter(f)
+
+	err = json.NewEncoder(w).Encode(storedList{
+		Version:      listStoreVersion,
+		Link:         source.link,
+		Updated:      time.Now(),
+		ETag:         source.validators.etag,
+		LastModified: source.validators.lastModified,
+		Format:       source.format,
+		Invalid:      source.invalid,
+		Entries:      source.entries,
+	})
+
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("can't write '%s': %w", f.Name(), err)
+	}
+
+	return os.Rename(f.Name(), s.path(source.link))
+}
@@ -0,0 +1,77 @@
+package lists
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListStore", func() {
+	var (
+		dir string
+		sut *listStore
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "blocky-lists")
+		Expect(err).Should(Succeed())
+
+		sut = newListStore(filepath.Join(dir, "lists"))
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("should create the directory and store the parsed list", func() {
+		Expect(sut).ShouldNot(BeNil())
+
+		sut.save(&sourceResult{link: "http://example.com/list", parseResult: parseResult{
+			format: formatAdblock, entries: []string{"||ads.com^", "@@||good.ads.com^"}, invalid: 2,
+		}})
+
+		files, err := ioutil.ReadDir(sut.dir)
+		Expect(err).Should(Succeed())
+		Expect(files).Should(HaveLen(1))
+
+		result := sut.load("http://example.com/list")
+		Expect(result).ShouldNot(BeNil())
+		Expect(result.link).Should(Equal("http://example.com/list"))
+		Expect(result.format).Should(Equal(formatAdblock))
+		Expect(result.entries).Should(Equal([]string{"||ads.com^", "@@||good.ads.com^"}))
+		Expect(result.invalid).Should(Equal(2))
+	})
+
+	It("should return nil for unknown lists", func() {
+		Expect(sut.load("http://example.com/other")).Should(BeNil())
+	})
+
+	It("should ignore files with another version", func() {
+		f, err := os.Create(sut.path("http://example.com/list"))
+		Expect(err).Should(Succeed())
+
+		w := gzip.NewWriter(f)
+		Expect(json.NewEncoder(w).Encode(storedList{Version: listStoreVersion + 1, Link: "http://example.com/list",
+			Entries: []string{"ads.com"}})).Should(Succeed())
+		Expect(w.Close()).Should(Succeed())
+		Expect(f.Close()).Should(Succeed())
+
+		Expect(sut.load("http://example.com/list")).Should(BeNil())
+	})
+
+	When("no directory is configured", func() {
+		It("should do nothing", func() {
+			sut = newListStore("")
+
+			Expect(sut).Should(BeNil())
+			sut.save(&sourceResult{link: "http://example.com/list"})
+			Expect(sut.load("http://example.com/list")).Should(BeNil())
+		})
+	})
+})
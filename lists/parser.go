@@ -0,0 +1,315 @@
+package lists
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// listFormat is the format of a list source
+type listFormat string
+
+const (
+	// formatHosts contains hosts file lines ("0.0.0.0 example.com") and plain domains, one per line
+	formatHosts listFormat = "hosts"
+	// formatAdblock contains Adblock Plus rules ("||example.com^", "@@||example.com^")
+	formatAdblock listFormat = "adblock"
+	// formatDnsmasq contains dnsmasq rules ("address=/example.com/0.0.0.0", "server=/example.com/")
+	formatDnsmasq listFormat = "dnsmasq"
+	// formatUnbound contains unbound rules ("local-zone: "example.com" always_nxdomain")
+	formatUnbound listFormat = "unbound"
+)
+
+// exceptionPrefix marks entries, which are excluded from the group (Adblock Plus "@@" rules)
+const exceptionPrefix = "@@"
+
+// formatDetectionLines is the number of lines, which are used to detect the format of a source
+const formatDetectionLines = 100
+
+// unboundTransparentZones are the local zone types, which resolve unknown names as usual
+// nolint:gochecknoglobals
+var unboundTransparentZones = map[string]bool{"transparent": true, "always_transparent": true, "typetransparent": true}
+
+// nolint:gochecknoglobals
+var domainPattern = regexp.MustCompile(`^([a-z0-9_]([a-z0-9_-]*[a-z0-9_])?\.)*[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?$`)
+
+// parseResult contains the entries of a source and the number of lines, which couldn't be parsed
+type parseResult struct {
+	format  listFormat
+	entries []string
+	invalid int
+}
+
+// parseLines detects the format of the lines and parses them. Regex entries are only accepted from local sources
+func parseLines(lines []string, remote bool) parseResult {
+	result := parseResult{format: detectFormat(lines), entries: make([]string, 0, len(lines))}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if isRegexEntry(line) {
+			if !remote {
+				result.entries = append(result.entries, line)
+			}
+
+			continue
+		}
+
+		if isComment(line, result.format) {
+			continue
+		}
+
+		entries, ok := parseLine(line, result.format)
+		if !ok {
+			result.invalid++
+
+			continue
+		}
+
+		result.entries = append(result.entries, entries...)
+	}
+
+	return result
+}
+
+// detectFormat returns the format, which matches most of the first lines. Default is the hosts format
+func detectFormat(lines []string) listFormat {
+	counts := make(map[listFormat]int)
+	checked := 0
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "!"), strings.HasPrefix(line, "[Adblock"),
+			strings.HasPrefix(line, adblockPrefix), strings.HasPrefix(line, exceptionPrefix):
+			counts[formatAdblock]++
+		case strings.HasPrefix(line, "address=/"), strings.HasPrefix(line, "server=/"):
+			counts[formatDnsmasq]++
+		case strings.HasPrefix(line, "local-zone:"), strings.HasPrefix(line, "local-data:"), line == "server:":
+			counts[formatUnbound]++
+		default:
+			counts[formatHosts]++
+		}
+
+		if checked++; checked >= formatDetectionLines {
+			break
+		}
+	}
+
+	result := formatHosts
+
+	for _, f := range []listFormat{formatAdblock, formatDnsmasq, formatUnbound} {
+		if counts[f] > counts[result] {
+			result = f
+		}
+	}
+
+	return result
+}
+
+func isComment(line string, format listFormat) bool {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return true
+	}
+
+	return format == formatAdblock && (strings.HasPrefix(line, "!") || strings.HasPrefix(line, "["))
+}
+
+// parseLine returns the entries of the line in the format of the group cache
+func parseLine(line string, format listFormat) ([]string, bool) {
+	switch format {
+	case formatAdblock:
+		return parseAdblockLine(line)
+	case formatDnsmasq:
+		return parseDnsmasqLine(stripDnsmasqComment(line))
+	case formatUnbound:
+		return parseUnboundLine(stripComment(line))
+	default:
+		return parseHostsLine(stripComment(line))
+	}
+}
+
+// stripComment removes an inline comment
+func stripComment(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		return strings.TrimSpace(line[:i])
+	}
+
+	return line
+}
+
+// stripDnsmasqComment removes an inline comment, which must be preceded by whitespace. A "#" inside of a rule is
+// part of it (for example "server=/domain/#" forwards the domain to the standard servers)
+func stripDnsmasqComment(line string) string {
+	for i, r := range line {
+		if r == '#' && i > 0 && (line[i-1] == ' ' || line[i-1] == '\t') {
+			return strings.TrimSpace(line[:i])
+		}
+	}
+
+	return line
+}
+
+// parseHostsLine accepts "ip host..." and single entries (domain, IP, "*.domain" or "||domain^")
+func parseHostsLine(line string) ([]string, bool) {
+	fields := strings.Fields(line)
+
+	switch {
+	case len(fields) == 0:
+		return nil, true
+	case len(fields) == 1:
+		entry, ok := normalizeEntry(fields[0])
+
+		return []string{entry}, ok
+	case net.ParseIP(fields[0]) == nil:
+		return nil, false
+	}
+
+	result := make([]string, 0, len(fields)-1)
+
+	for _, host := range fields[1:] {
+		entry, ok := normalizeEntry(host)
+		if !ok {
+			return nil, false
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, true
+}
+
+// normalizeEntry returns IPs in canonical form and lower case domains (optionally with wildcard or adblock syntax)
+func normalizeEntry(entry string) (string, bool) {
+	if ip := net.ParseIP(entry); ip != nil {
+		return ip.String(), true
+	}
+
+	entry = strings.ToLower(entry)
+
+	domain := entry
+
+	switch {
+	case strings.HasPrefix(entry, wildcardPrefix):
+		domain = entry[len(wildcardPrefix):]
+	case strings.HasPrefix(entry, adblockPrefix) && strings.HasSuffix(entry, adblockSuffix):
+		domain = strings.TrimSuffix(strings.TrimPrefix(entry, adblockPrefix), adblockSuffix)
+	}
+
+	return entry, domainPattern.MatchString(domain)
+}
+
+// parseAdblockLine accepts "||domain^" and "@@||domain^" rules without options or with the option "important"
+func parseAdblockLine(line string) ([]string, bool) {
+	exception := strings.HasPrefix(line, exceptionPrefix)
+	rule := strings.TrimPrefix(line, exceptionPrefix)
+
+	if i := strings.Index(rule, "$"); i >= 0 {
+		if rule[i+1:] != "important" {
+			return nil, false
+		}
+
+		rule = rule[:i]
+	}
+
+	if !strings.HasPrefix(rule, adblockPrefix) || !strings.HasSuffix(rule, adblockSuffix) {
+		return nil, false
+	}
+
+	entry, ok := normalizeEntry(rule)
+	if exception {
+		entry = exceptionPrefix + entry
+	}
+
+	return []string{entry}, ok
+}
+
+// parseDnsmasqLine accepts "address=/domain/.../[ip]" and "server=/domain/.../", dnsmasq matches the subdomains too.
+// A server rule with upstream forwards the domains and doesn't block them, it is ignored
+func parseDnsmasqLine(line string) ([]string, bool) {
+	var (
+		rule   string
+		server bool
+	)
+
+	switch {
+	case line == "":
+		return nil, true
+	case strings.HasPrefix(line, "address=/"):
+		rule = strings.TrimPrefix(line, "address=/")
+	case strings.HasPrefix(line, "server=/"):
+		rule = strings.TrimPrefix(line, "server=/")
+		server = true
+	default:
+		return nil, false
+	}
+
+	parts := strings.Split(rule, "/")
+	if len(parts) < 2 {
+		return nil, false
+	}
+
+	if server && parts[len(parts)-1] != "" {
+		// valid rule, but nothing to block
+		return nil, true
+	}
+
+	result := make([]string, 0, len(parts)-1)
+
+	for _, domain := range parts[:len(parts)-1] {
+		entry, ok := normalizeEntry(adblockPrefix + domain + adblockSuffix)
+		if !ok {
+			return nil, false
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, true
+}
+
+// parseUnboundLine accepts `local-zone: "domain" type` (domain and subdomains) and `local-data: "domain ..."`
+// (only the domain). Local zones of the transparent types answer from upstream and don't block, they are ignored
+func parseUnboundLine(line string) ([]string, bool) {
+	var (
+		rule   string
+		prefix string
+	)
+
+	switch {
+	case line == "" || line == "server:":
+		return nil, true
+	case strings.HasPrefix(line, "local-zone:"):
+		rule = strings.TrimPrefix(line, "local-zone:")
+		prefix = adblockPrefix
+	case strings.HasPrefix(line, "local-data:"):
+		rule = strings.TrimPrefix(line, "local-data:")
+	default:
+		return nil, false
+	}
+
+	fields := strings.Fields(strings.ReplaceAll(rule, `"`, " "))
+	if len(fields) == 0 {
+		return nil, false
+	}
+
+	if prefix != "" && len(fields) > 1 && unboundTransparentZones[fields[1]] {
+		// valid rule, but nothing to block
+		return nil, true
+	}
+
+	domain := strings.TrimSuffix(fields[0], ".")
+
+	entry := domain
+	if prefix != "" {
+		entry = prefix + domain + adblockSuffix
+	}
+
+	entry, ok := normalizeEntry(entry)
+
+	return []string{entry}, ok
+}
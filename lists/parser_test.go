@@ -0,0 +1,82 @@
+package lists
+
+import (
+	"strings"
+
+	"github.com/stgnet/blocky/config"
+	. "github.com/stgnet/blocky/helpertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parser", func() {
+	DescribeTable("should detect the format and parse the lines",
+		func(content string, remote bool, format listFormat, entries []string, invalid int) {
+			result := parseLines(strings.Split(content, "\n"), remote)
+
+			Expect(result.format).Should(Equal(format))
+			Expect(result.entries).Should(Equal(entries))
+			Expect(result.invalid).Should(Equal(invalid))
+		},
+		Entry("hosts file with inline comments and multiple hosts", `# comment
+127.0.0.1 localhost
+0.0.0.0 Ads.example.com tracker.example.com # trackers
+::1 ip6.example.com
+
+plain.example.com
+*.wildcard.com
+192.168.178.55
+0.0.0.0 invalid..domain
+some garbage line`, false, formatHosts,
+			[]string{"localhost", "ads.example.com", "tracker.example.com", "ip6.example.com", "plain.example.com",
+				"*.wildcard.com", "192.168.178.55"}, 2),
+		Entry("adblock plus rules with exceptions", `[Adblock Plus 2.0]
+! Title: test
+||ads.example.com^
+||tracker.example.com^$important
+@@||good.ads.example.com^
+||third.example.com^$third-party
+example.com##.banner`, false, formatAdblock,
+			[]string{"||ads.example.com^", "||tracker.example.com^", "@@||good.ads.example.com^"}, 2),
+		Entry("dnsmasq rules", `# dnsmasq
+address=/ads.example.com/0.0.0.0
+address=/a.example.com/b.example.com/
+server=/tracker.example.com/ # tracker
+server=/forwarded.example.com/192.168.178.1
+server=/local.example.com/#
+address=/bad domain/0.0.0.0
+conf-file=/etc/other.conf`, false, formatDnsmasq,
+			[]string{"||ads.example.com^", "||a.example.com^", "||b.example.com^", "||tracker.example.com^"}, 2),
+		Entry("unbound rules", `server:
+local-zone: "ads.example.com" always_nxdomain
+local-zone: "tracker.example.com." static # tracker
+local-zone: "home.example.com" transparent
+local-zone: "always.example.com" always_transparent
+local-zone: "type.example.com" typetransparent
+local-data: "single.example.com A 0.0.0.0"
+include: other.conf`, false, formatUnbound,
+			[]string{"||ads.example.com^", "||tracker.example.com^", "single.example.com"}, 1),
+		Entry("regex entries only from local sources", "/^ad[0-9]+\\.example\\.com$/\nexample.com", true,
+			formatHosts, []string{"example.com"}, 0),
+	)
+
+	Describe("ListCache with adblock exceptions", func() {
+		It("should not match exceptions", func() {
+			server := TestServer("||example.com^\n@@||good.example.com^")
+			defer server.Close()
+
+			sut := NewListCache(BLACKLIST, map[string][]string{"gr1": {server.URL}}, config.BlockingConfig{})
+
+			found, _ := sut.Match("ads.example.com", []string{"gr1"})
+			Expect(found).Should(BeTrue())
+
+			found, _ = sut.Match("sub.good.example.com", []string{"gr1"})
+			Expect(found).Should(BeFalse())
+
+			Expect(sut.Configuration()).Should(ContainElement(
+				"   - " + server.URL + " (format adblock, 2 entries, 0 invalid lines)"))
+		})
+	})
+})
@@ -0,0 +1,493 @@
+package lists
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stgnet/blocky/config"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+// RPZTrigger defines, which part of the query or response is matched by a rule
+type RPZTrigger string
+
+const (
+	RPZTriggerQName      RPZTrigger = "qname"
+	RPZTriggerClientIP   RPZTrigger = "client-ip"
+	RPZTriggerResponseIP RPZTrigger = "response-ip"
+	RPZTriggerNSDName    RPZTrigger = "nsdname"
+)
+
+// RPZAction defines, how the resolver answers a query, which matches a rule
+type RPZAction string
+
+const (
+	RPZActionNxDomain  RPZAction = "NXDOMAIN"
+	RPZActionNoData    RPZAction = "NODATA"
+	RPZActionPassthru  RPZAction = "PASSTHRU"
+	RPZActionDrop      RPZAction = "DROP"
+	RPZActionLocalData RPZAction = "LOCAL-DATA"
+)
+
+const (
+	rpzClientIPSuffix   = ".rpz-client-ip"
+	rpzResponseIPSuffix = ".rpz-ip"
+	rpzNSDNameSuffix    = ".rpz-nsdname"
+	rpzNSIPSuffix       = ".rpz-nsip"
+)
+
+// RPZRule is a policy rule of a response policy zone
+type RPZRule struct {
+	Zone    string
+	Trigger RPZTrigger
+	// Name is the trigger as written in the zone without the zone name (for example "*.example.com" or
+	// "24.0.2.0.192")
+	Name   string
+	Action RPZAction
+	// Data contains the records of local data rules
+	Data []dns.RR
+}
+
+func (r *RPZRule) String() string {
+	return fmt.Sprintf("%s: %s %s", r.Zone, r.Trigger, r.Name)
+}
+
+type rpzIPRule struct {
+	net  *net.IPNet
+	rule *RPZRule
+}
+
+// rpzNames contains rules for names: exact names and wildcards ("*.example.com" stored as "example.com")
+type rpzNames struct {
+	exact    map[string]*RPZRule
+	wildcard map[string]*RPZRule
+}
+
+func newRPZNames() rpzNames {
+	return rpzNames{exact: make(map[string]*RPZRule), wildcard: make(map[string]*RPZRule)}
+}
+
+// match returns the rule of the name or of the longest wildcard, which covers the name
+func (n rpzNames) match(name string) *RPZRule {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	if rule, found := n.exact[name]; found {
+		return rule
+	}
+
+	for i := 0; i < len(name); i++ {
+		if name[i] == '.' {
+			if rule, found := n.wildcard[name[i+1:]]; found {
+				return rule
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n rpzNames) add(name string, rule *RPZRule) {
+	if strings.HasPrefix(name, wildcardPrefix) {
+		n.wildcard[name[len(wildcardPrefix):]] = rule
+	} else {
+		n.exact[name] = rule
+	}
+}
+
+func (n rpzNames) len() int {
+	return len(n.exact) + len(n.wildcard)
+}
+
+// rpzZone contains the rules of one zone by trigger
+type rpzZone struct {
+	name       string
+	source     string
+	qnames     rpzNames
+	nsdnames   rpzNames
+	clientIPs  []rpzIPRule
+	responseIP []rpzIPRule
+	invalid    int
+}
+
+// RPZCache contains the response policy zones in the configured order
+type RPZCache struct {
+	lock          sync.RWMutex
+	cfg           []config.RPZZoneConfig
+	zones         []*rpzZone
+	refreshPeriod time.Duration
+	stop          chan struct{}
+}
+
+// NewRPZCache loads all zones and refreshes them periodically
+func NewRPZCache(zones []config.RPZZoneConfig, refreshPeriod int) *RPZCache {
+	p := time.Duration(refreshPeriod) * time.Minute
+	if refreshPeriod == 0 {
+		p = defaultRefreshPeriod
+	}
+
+	c := &RPZCache{
+		cfg:           zones,
+		zones:         make([]*rpzZone, len(zones)),
+		refreshPeriod: p,
+		stop:          make(chan struct{}),
+	}
+
+	if len(zones) == 0 {
+		return c
+	}
+
+	c.refresh()
+
+	if p > 0 {
+		go c.periodicUpdate()
+	}
+
+	return c
+}
+
+func (c *RPZCache) periodicUpdate() {
+	ticker := time.NewTicker(c.refreshPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.refresh()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Stop stops the periodical refresh of the zones
+func (c *RPZCache) Stop() {
+	close(c.stop)
+}
+
+func (c *RPZCache) refresh() {
+	for i, zoneCfg := range c.cfg {
+		zone, err := loadRPZZone(zoneCfg)
+		if err != nil {
+			logger().WithField("source", zoneCfg.Source).Warn("can't load rpz zone, keeping the last loaded rules: ", err)
+
+			continue
+		}
+
+		c.lock.Lock()
+		c.zones[i] = zone
+		c.lock.Unlock()
+
+		logger().WithFields(logrus.Fields{
+			"zone":    zone.name,
+			"source":  zone.source,
+			"rules":   zone.len(),
+			"invalid": zone.invalid,
+		}).Info("rpz zone import finished")
+	}
+}
+
+// IsEmpty returns true, if no zones are configured
+func (c *RPZCache) IsEmpty() bool {
+	return len(c.cfg) == 0
+}
+
+// HasNSDNameRules returns true, if one of the zones contains NSDNAME triggers
+func (c *RPZCache) HasNSDNameRules() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for _, z := range c.zones {
+		if z != nil && z.nsdnames.len() > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchQuery returns the first rule, which matches the client IP or the query name. The zones are checked in the
+// configured order, in each zone client IP triggers have precedence over QNAME triggers
+func (c *RPZCache) MatchQuery(clientIP net.IP, qname string) *RPZRule {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for _, z := range c.zones {
+		if z == nil {
+			continue
+		}
+
+		if rule := matchIP(z.clientIPs, clientIP); rule != nil {
+			return rule
+		}
+
+		if rule := z.qnames.match(qname); rule != nil {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// MatchResponse returns the first rule, which matches one of the IP addresses of the answer or one of the name
+// servers of the queried domain
+func (c *RPZCache) MatchResponse(ips []net.IP, nsNames []string) *RPZRule {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for _, z := range c.zones {
+		if z == nil {
+			continue
+		}
+
+		for _, ip := range ips {
+			if rule := matchIP(z.responseIP, ip); rule != nil {
+				return rule
+			}
+		}
+
+		for _, ns := range nsNames {
+			if rule := z.nsdnames.match(ns); rule != nil {
+				return rule
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchIP returns the rule with the longest prefix, which contains the IP
+func matchIP(rules []rpzIPRule, ip net.IP) (result *RPZRule) {
+	if ip == nil {
+		return nil
+	}
+
+	best := -1
+
+	for _, r := range rules {
+		if ones, _ := r.net.Mask.Size(); ones > best && r.net.Contains(ip) {
+			best, result = ones, r.rule
+		}
+	}
+
+	return result
+}
+
+// Configuration returns the zones with the number of rules
+func (c *RPZCache) Configuration() (result []string) {
+	if c.refreshPeriod > 0 {
+		result = append(result, fmt.Sprintf("refresh period: %d minutes", c.refreshPeriod/time.Minute))
+	} else {
+		result = append(result, "refresh: disabled")
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for i, z := range c.zones {
+		if z == nil {
+			result = append(result, fmt.Sprintf("%s: not loaded", c.cfg[i].Source))
+
+			continue
+		}
+
+		result = append(result, fmt.Sprintf("%s (%s): %d rules, %d invalid records", z.name, z.source, z.len(),
+			z.invalid))
+	}
+
+	return
+}
+
+func (z *rpzZone) len() int {
+	return z.qnames.len() + z.nsdnames.len() + len(z.clientIPs) + len(z.responseIP)
+}
+
+// loadRPZZone reads the zone file (optionally compressed) and creates the rules from its records. Without configured
+// name the origin is the owner of the SOA record, this works only for zones with $ORIGIN or absolute owner names
+func loadRPZZone(cfg config.RPZZoneConfig) (*rpzZone, error) {
+	r, _, err := openSource(cfg.Source, downloadSettings(config.DownloadConfig{}, cfg.Source), sourceValidators{})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	origin := ""
+	if cfg.Name != "" {
+		origin = dns.Fqdn(strings.ToLower(cfg.Name))
+	}
+
+	zp := dns.NewZoneParser(r, origin, cfg.Source)
+
+	// records of each owner in the order of the zone file
+	var owners []string
+
+	records := make(map[string][]dns.RR)
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := strings.ToLower(rr.Header().Name)
+
+		if soa, isSOA := rr.(*dns.SOA); isSOA && origin == "" {
+			origin = strings.ToLower(soa.Hdr.Name)
+		}
+
+		if _, found := records[owner]; !found {
+			owners = append(owners, owner)
+		}
+
+		records[owner] = append(records[owner], rr)
+	}
+
+	if err = zp.Err(); err != nil {
+		if origin == "" {
+			// relative owner names can't be parsed before the SOA record is known
+			return nil, fmt.Errorf("%w (zone without $ORIGIN and relative owner names needs 'name' in the config)", err)
+		}
+
+		return nil, err
+	}
+
+	if origin == "" {
+		return nil, fmt.Errorf("zone '%s' has no name and no SOA record", cfg.Source)
+	}
+
+	zone := &rpzZone{
+		name:     strings.TrimSuffix(origin, "."),
+		source:   cfg.Source,
+		qnames:   newRPZNames(),
+		nsdnames: newRPZNames(),
+	}
+
+	for _, owner := range owners {
+		if owner == origin || !strings.HasSuffix(owner, "."+origin) {
+			// records of the zone itself (SOA, NS) are no rules
+			continue
+		}
+
+		if err := zone.addRule(strings.TrimSuffix(owner, "."+origin), records[owner]); err != nil {
+			logger().WithField("zone", zone.name).Debugf("skipping rpz rule '%s': %v", owner, err)
+
+			zone.invalid++
+		}
+	}
+
+	return zone, nil
+}
+
+func (z *rpzZone) addRule(name string, records []dns.RR) error {
+	action, data, err := rpzAction(records)
+	if err != nil {
+		return err
+	}
+
+	rule := &RPZRule{Zone: z.name, Name: name, Action: action, Data: data}
+
+	switch {
+	case strings.HasSuffix(name, rpzClientIPSuffix):
+		rule.Trigger = RPZTriggerClientIP
+
+		ipNet, err := parseRPZIP(strings.TrimSuffix(name, rpzClientIPSuffix))
+		if err != nil {
+			return err
+		}
+
+		z.clientIPs = append(z.clientIPs, rpzIPRule{net: ipNet, rule: rule})
+	case strings.HasSuffix(name, rpzResponseIPSuffix):
+		rule.Trigger = RPZTriggerResponseIP
+
+		ipNet, err := parseRPZIP(strings.TrimSuffix(name, rpzResponseIPSuffix))
+		if err != nil {
+			return err
+		}
+
+		z.responseIP = append(z.responseIP, rpzIPRule{net: ipNet, rule: rule})
+	case strings.HasSuffix(name, rpzNSDNameSuffix):
+		rule.Trigger = RPZTriggerNSDName
+		z.nsdnames.add(strings.TrimSuffix(name, rpzNSDNameSuffix), rule)
+	case strings.HasSuffix(name, rpzNSIPSuffix):
+		return fmt.Errorf("trigger %s is not supported", rpzNSIPSuffix)
+	default:
+		rule.Trigger = RPZTriggerQName
+		z.qnames.add(name, rule)
+	}
+
+	return nil
+}
+
+// rpzAction determines the action from the records of a rule
+func rpzAction(records []dns.RR) (RPZAction, []dns.RR, error) {
+	if cname, ok := records[0].(*dns.CNAME); ok && len(records) == 1 {
+		switch strings.ToLower(cname.Target) {
+		case ".":
+			return RPZActionNxDomain, nil, nil
+		case "*.":
+			return RPZActionNoData, nil, nil
+		case "rpz-passthru.":
+			return RPZActionPassthru, nil, nil
+		case "rpz-drop.":
+			return RPZActionDrop, nil, nil
+		case "rpz-tcp-only.":
+			return "", nil, fmt.Errorf("action %s is not supported", cname.Target)
+		}
+	}
+
+	for _, rr := range records {
+		if _, isCNAME := rr.(*dns.CNAME); isCNAME && len(records) > 1 {
+			return "", nil, fmt.Errorf("local data with CNAME must not contain other records")
+		}
+	}
+
+	return RPZActionLocalData, records, nil
+}
+
+// parseRPZIP parses an IP trigger "prefix.reversed.address" (for example "24.0.2.0.192" or "48.zz.1.db8.2001")
+func parseRPZIP(trigger string) (*net.IPNet, error) {
+	labels := strings.Split(trigger, ".")
+	if len(labels) < 2 {
+		return nil, fmt.Errorf("invalid ip trigger '%s'", trigger)
+	}
+
+	prefix, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix of ip trigger '%s'", trigger)
+	}
+
+	parts := make([]string, 0, len(labels)-1)
+	for i := len(labels) - 1; i > 0; i-- {
+		parts = append(parts, labels[i])
+	}
+
+	var address string
+
+	if len(parts) == 4 && net.ParseIP(strings.Join(parts, ".")).To4() != nil {
+		address = fmt.Sprintf("%s/%d", strings.Join(parts, "."), prefix)
+	} else {
+		for i, p := range parts {
+			if p == "zz" {
+				parts[i] = ""
+			}
+		}
+
+		address = strings.Join(parts, ":")
+		if strings.HasPrefix(address, ":") {
+			address = ":" + address
+		}
+
+		if strings.HasSuffix(address, ":") {
+			address += ":"
+		}
+
+		address = fmt.Sprintf("%s/%d", address, prefix)
+	}
+
+	_, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ip trigger '%s': %w", trigger, err)
+	}
+
+	return ipNet, nil
+}
@@ -0,0 +1,167 @@
+package lists
+
+import (
+	"net"
+	"os"
+
+	"github.com/stgnet/blocky/config"
+	. "github.com/stgnet/blocky/helpertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const testRPZZone = `$ORIGIN rpz.test.
+$TTL 300
+@ IN SOA localhost. admin.localhost. 1 3600 600 86400 60
+@ IN NS localhost.
+evil.com CNAME .
+*.evil.com CNAME .
+ok.evil.com CNAME rpz-passthru.
+empty.com CNAME *.
+drop.com CNAME rpz-drop.
+walled.com CNAME garden.example.
+local.com A 10.0.0.1
+local.com AAAA 2001:db8::1
+32.2.1.168.192.rpz-client-ip CNAME rpz-drop.
+24.0.2.0.192.rpz-ip CNAME .
+48.zz.db8.2001.rpz-ip CNAME rpz-drop.
+ns.bad.net.rpz-nsdname CNAME .
+32.1.0.0.10.rpz-nsip CNAME .
+tcp.com CNAME rpz-tcp-only.
+`
+
+var _ = Describe("RPZCache", func() {
+	var (
+		zoneFile *os.File
+		sut      *RPZCache
+	)
+
+	BeforeEach(func() {
+		zoneFile = TempFile(testRPZZone)
+	})
+
+	AfterEach(func() {
+		sut.Stop()
+		_ = os.Remove(zoneFile.Name())
+	})
+
+	JustBeforeEach(func() {
+		sut = NewRPZCache([]config.RPZZoneConfig{{Source: zoneFile.Name()}}, 0)
+	})
+
+	Describe("Loading of zones", func() {
+		It("should require the zone name for relative owner names without $ORIGIN", func() {
+			file := TempFile("$TTL 300\n@ IN SOA localhost. admin.localhost. 1 3600 600 86400 60\nevil.com CNAME .\n")
+			defer os.Remove(file.Name())
+
+			_, err := loadRPZZone(config.RPZZoneConfig{Source: file.Name()})
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("needs 'name' in the config"))
+
+			zone, err := loadRPZZone(config.RPZZoneConfig{Name: "rpz.test", Source: file.Name()})
+			Expect(err).Should(Succeed())
+			Expect(zone.name).Should(Equal("rpz.test"))
+			Expect(zone.len()).Should(Equal(1))
+		})
+		It("should take the zone name from the SOA record and count unsupported rules", func() {
+			Expect(sut.IsEmpty()).Should(BeFalse())
+			Expect(sut.HasNSDNameRules()).Should(BeTrue())
+			Expect(sut.Configuration()).Should(ContainElement(
+				"rpz.test (" + zoneFile.Name() + "): 11 rules, 2 invalid records"))
+		})
+
+		When("zone source does not exist", func() {
+			JustBeforeEach(func() {
+				sut.Stop()
+				sut = NewRPZCache([]config.RPZZoneConfig{{Name: "rpz.test", Source: "/does/not/exist"}}, 0)
+			})
+			It("should not match any query", func() {
+				Expect(sut.MatchQuery(net.ParseIP("1.1.1.1"), "evil.com")).Should(BeNil())
+				Expect(sut.Configuration()).Should(ContainElement("/does/not/exist: not loaded"))
+			})
+		})
+	})
+
+	Describe("Matching of queries", func() {
+		DescribeTable("should return the matching rule",
+			func(clientIP string, qname string, trigger RPZTrigger, name string, action RPZAction) {
+				rule := sut.MatchQuery(net.ParseIP(clientIP), qname)
+
+				Expect(rule).ShouldNot(BeNil())
+				Expect(rule.Zone).Should(Equal("rpz.test"))
+				Expect(rule.Trigger).Should(Equal(trigger))
+				Expect(rule.Name).Should(Equal(name))
+				Expect(rule.Action).Should(Equal(action))
+			},
+			Entry("exact qname", "1.1.1.1", "evil.com", RPZTriggerQName, "evil.com", RPZActionNxDomain),
+			Entry("wildcard qname", "1.1.1.1", "www.evil.com", RPZTriggerQName, "*.evil.com", RPZActionNxDomain),
+			Entry("exact qname before wildcard", "1.1.1.1", "ok.evil.com", RPZTriggerQName, "ok.evil.com",
+				RPZActionPassthru),
+			Entry("nodata", "1.1.1.1", "EMPTY.com.", RPZTriggerQName, "empty.com", RPZActionNoData),
+			Entry("drop", "1.1.1.1", "drop.com", RPZTriggerQName, "drop.com", RPZActionDrop),
+			Entry("local data", "1.1.1.1", "walled.com", RPZTriggerQName, "walled.com", RPZActionLocalData),
+			Entry("client ip before qname", "192.168.1.2", "evil.com", RPZTriggerClientIP,
+				"32.2.1.168.192.rpz-client-ip", RPZActionDrop),
+		)
+
+		It("should return the records of local data rules", func() {
+			rule := sut.MatchQuery(net.ParseIP("1.1.1.1"), "local.com")
+
+			Expect(rule).ShouldNot(BeNil())
+			Expect(rule.Data).Should(HaveLen(2))
+		})
+
+		It("should not match other queries", func() {
+			Expect(sut.MatchQuery(net.ParseIP("1.1.1.1"), "example.com")).Should(BeNil())
+			Expect(sut.MatchQuery(net.ParseIP("1.1.1.1"), "tcp.com")).Should(BeNil())
+		})
+	})
+
+	Describe("Matching of responses", func() {
+		It("should match response IPs", func() {
+			rule := sut.MatchResponse([]net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("192.0.2.17")}, nil)
+
+			Expect(rule).ShouldNot(BeNil())
+			Expect(rule.Trigger).Should(Equal(RPZTriggerResponseIP))
+			Expect(rule.Action).Should(Equal(RPZActionNxDomain))
+
+			rule = sut.MatchResponse([]net.IP{net.ParseIP("2001:db8:0:1::5")}, nil)
+
+			Expect(rule).ShouldNot(BeNil())
+			Expect(rule.Action).Should(Equal(RPZActionDrop))
+		})
+
+		It("should match name servers", func() {
+			rule := sut.MatchResponse(nil, []string{"ns.good.net.", "NS.bad.net."})
+
+			Expect(rule).ShouldNot(BeNil())
+			Expect(rule.Trigger).Should(Equal(RPZTriggerNSDName))
+			Expect(rule.String()).Should(Equal("rpz.test: nsdname ns.bad.net.rpz-nsdname"))
+		})
+
+		It("should not match other responses", func() {
+			Expect(sut.MatchResponse([]net.IP{net.ParseIP("192.0.3.1")}, []string{"ns.good.net."})).Should(BeNil())
+		})
+	})
+
+	DescribeTable("parseRPZIP",
+		func(trigger string, expected string) {
+			ipNet, err := parseRPZIP(trigger)
+
+			if expected == "" {
+				Expect(err).Should(HaveOccurred())
+			} else {
+				Expect(err).Should(Succeed())
+				Expect(ipNet.String()).Should(Equal(expected))
+			}
+		},
+		Entry("IPv4 host", "32.1.2.0.192", "192.0.2.1/32"),
+		Entry("IPv4 network", "24.0.2.0.192", "192.0.2.0/24"),
+		Entry("IPv6 with zz", "48.zz.db8.2001", "2001:db8::/48"),
+		Entry("IPv6 host", "128.1.zz.db8.2001", "2001:db8::1/128"),
+		Entry("invalid prefix", "x.1.2.0.192", ""),
+		Entry("invalid address", "24.foo.bar", ""),
+	)
+})
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"sync"
+
 	"github.com/stgnet/blocky/config"
 
 	"github.com/go-chi/chi"
@@ -14,8 +16,68 @@ var reg = prometheus.NewRegistry()
 // nolint
 var enabled bool
 
-func RegisterMetric(c prometheus.Collector) {
-	_ = reg.Register(c)
+// nolint
+var (
+	round     map[prometheus.Collector]bool
+	roundLock sync.Mutex
+)
+
+// RegisterMetric registers the collector and returns the collector to use. If a collector with the same descriptor
+// is already registered (for example if resolvers are recreated on config reload), the existing one is returned, so
+// counters and histograms keep their series
+func RegisterMetric(c prometheus.Collector) prometheus.Collector {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+	}
+
+	return c
+}
+
+// ReplaceMetric registers the collector and returns the collector to use. An already registered collector with the
+// same descriptor will be replaced, unless it was registered in the current round (see BeginRound): then the existing
+// one is returned. Use it for gauges, which reflect the state of the instance, which created them
+func ReplaceMetric(c prometheus.Collector) prometheus.Collector {
+	roundLock.Lock()
+	defer roundLock.Unlock()
+
+	if err := reg.Register(c); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return c
+		}
+
+		if round[are.ExistingCollector] {
+			return are.ExistingCollector
+		}
+
+		reg.Unregister(are.ExistingCollector)
+		_ = reg.Register(c)
+	}
+
+	if round != nil {
+		round[c] = true
+	}
+
+	return c
+}
+
+// BeginRound starts a registration round, for example the creation of the resolver pipeline. Collectors replaced in
+// the round are shared by all instances, which are created in the same round
+func BeginRound() {
+	roundLock.Lock()
+	defer roundLock.Unlock()
+
+	round = make(map[prometheus.Collector]bool)
+}
+
+// EndRound ends the registration round, the next call of ReplaceMetric replaces the collector again
+func EndRound() {
+	roundLock.Lock()
+	defer roundLock.Unlock()
+
+	round = nil
 }
 
 func Start(router *chi.Mux, cfg config.PrometheusConfig) {
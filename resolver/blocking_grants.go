@@ -0,0 +1,326 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/log"
+	"github.com/stgnet/blocky/state"
+)
+
+// grantsStateSection is the section of the state file with the active allow grants
+const grantsStateSection = "grants"
+
+// errUnknownGrant is returned, if a grant should be revoked, which does not exist
+var errUnknownGrant = errors.New("unknown grant")
+
+// grantKey identifies a grant by client (registry name, MAC, IP or host name) and domain
+type grantKey struct {
+	Client string `json:"client"`
+	Domain string `json:"domain"`
+}
+
+// grant allows a domain and its subdomains for one client until it expires
+type grant struct {
+	grantKey
+	Until time.Time `json:"until"`
+}
+
+// grants contains all active allow grants, each with its own expiry timer
+type grants struct {
+	lock    sync.RWMutex
+	entries map[grantKey]time.Time
+	timers  map[grantKey]*time.Timer
+	store   *state.Store
+}
+
+func newGrants(store *state.Store) *grants {
+	g := &grants{
+		entries: make(map[grantKey]time.Time),
+		timers:  make(map[grantKey]*time.Timer),
+		store:   store,
+	}
+
+	var saved []grant
+	if _, err := store.Load(grantsStateSection, &saved); err != nil {
+		log.Logger.Error("can't load allow grants from state file: ", err)
+	}
+
+	for _, e := range saved {
+		if e.Until.After(time.Now()) {
+			g.entries[e.grantKey] = e.Until
+			g.scheduleExpiry(e.grantKey, e.Until)
+		}
+	}
+
+	return g
+}
+
+func normalizeGrantDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// add allows the domain for the client for the duration. An existing grant will be replaced
+func (g *grants) add(client, domain string, duration time.Duration) error {
+	key := grantKey{Client: normalizeClientKey(client), Domain: normalizeGrantDomain(domain)}
+	until := time.Now().Add(duration)
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	// the grant is applied only if it was saved
+	entries := g.copyEntries()
+	entries[key] = until
+
+	if err := g.saveEntries(entries); err != nil {
+		return err
+	}
+
+	g.entries = entries
+	g.scheduleExpiry(key, until)
+
+	log.Logger.Infof("allow domain '%s' for client '%s' for %s", key.Domain, key.Client, duration)
+
+	return nil
+}
+
+// remove revokes the grant of the domain for the client
+func (g *grants) remove(client, domain string) error {
+	key := grantKey{Client: normalizeClientKey(client), Domain: normalizeGrantDomain(domain)}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if _, found := g.entries[key]; !found {
+		return fmt.Errorf("%w for domain '%s' and client '%s'", errUnknownGrant, key.Domain, key.Client)
+	}
+
+	// the grant is revoked only if the change was saved
+	entries := g.copyEntries()
+	delete(entries, key)
+
+	if err := g.saveEntries(entries); err != nil {
+		return err
+	}
+
+	if t, found := g.timers[key]; found {
+		t.Stop()
+		delete(g.timers, key)
+	}
+
+	g.entries = entries
+
+	log.Logger.Infof("allow grant of domain '%s' for client '%s' revoked", key.Domain, key.Client)
+
+	return nil
+}
+
+// takeOver continues the active grants of the grants, which are replaced on config reload
+func (g *grants) takeOver(old *grants) {
+	old.lock.RLock()
+	defer old.lock.RUnlock()
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for key, until := range old.entries {
+		if until.After(time.Now()) {
+			g.entries[key] = until
+			g.scheduleExpiry(key, until)
+		}
+	}
+}
+
+// scheduleExpiry must be called with write lock or before the grants are shared
+func (g *grants) scheduleExpiry(key grantKey, until time.Time) {
+	if t, found := g.timers[key]; found {
+		t.Stop()
+	}
+
+	g.timers[key] = time.AfterFunc(time.Until(until), func() {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+
+		if !g.entries[key].Equal(until) {
+			return
+		}
+
+		delete(g.entries, key)
+		delete(g.timers, key)
+
+		if err := g.save(); err != nil {
+			log.Logger.Error("can't save allow grants to state file: ", err)
+		}
+
+		log.Logger.Infof("allow grant of domain '%s' for client '%s' expired", key.Domain, key.Client)
+	})
+}
+
+// save must be called with lock
+func (g *grants) save() error {
+	return g.saveEntries(g.entries)
+}
+
+func (g *grants) saveEntries(entries map[grantKey]time.Time) error {
+	saved := make([]grant, 0, len(entries))
+	for key, until := range entries {
+		saved = append(saved, grant{grantKey: key, Until: until})
+	}
+
+	return g.store.Save(grantsStateSection, saved)
+}
+
+// copyEntries must be called with lock, the copy can be changed without affecting the active grants
+func (g *grants) copyEntries() map[grantKey]time.Time {
+	result := make(map[grantKey]time.Time, len(g.entries)+1)
+	for key, until := range g.entries {
+		result[key] = until
+	}
+
+	return result
+}
+
+// granted returns the grant, which allows the domain (or one of its parent domains) for one of the clients
+func (g *grants) granted(domain string, clients ...string) (grantKey, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	if len(g.entries) == 0 {
+		return grantKey{}, false
+	}
+
+	domain = normalizeGrantDomain(domain)
+
+	for _, client := range clients {
+		for d := domain; d != ""; {
+			key := grantKey{Client: client, Domain: d}
+			if until, found := g.entries[key]; found && until.After(time.Now()) {
+				return key, true
+			}
+
+			i := strings.Index(d, ".")
+			if i < 0 {
+				break
+			}
+
+			d = d[i+1:]
+		}
+	}
+
+	return grantKey{}, false
+}
+
+// status returns all active grants sorted by client and domain
+func (g *grants) status() []api.AllowGrant {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	result := make([]api.AllowGrant, 0, len(g.entries))
+
+	for key, until := range g.entries {
+		result = append(result, api.AllowGrant{
+			Client:       key.Client,
+			Domain:       key.Domain,
+			ExpiresInSec: uint(time.Until(until).Seconds()),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Client != result[j].Client {
+			return result[i].Client < result[j].Client
+		}
+
+		return result[i].Domain < result[j].Domain
+	})
+
+	return result
+}
+
+func (g *grants) stop() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for _, t := range g.timers {
+		t.Stop()
+	}
+}
+
+// apiAllow is the http endpoint to allow a domain temporarily for one client
+// @Summary Allow domain for client
+// @Description allows the domain and its subdomains for the client until the duration is over. The grant is
+// @Description checked before white lists and private DNS
+// @Tags blocking
+// @Param domain query string true "domain (Example: example.com)"
+// @Param client query string true "client (name, MAC, IP or host name)"
+// @Param duration query string true "duration of the grant (Example: 300s, 5m, 1h, 5m30s)" Format(duration)
+// @Success 200   "Domain is allowed"
+// @Failure 400   "Missing parameter or wrong duration format"
+// @Router /blocking/allow [get]
+func (r *BlockingResolver) apiAllow(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	domain := query.Get("domain")
+	client := query.Get("client")
+
+	if domain == "" || client == "" {
+		http.Error(rw, "domain and client are required", http.StatusBadRequest)
+
+		return
+	}
+
+	duration, err := time.ParseDuration(query.Get("duration"))
+	if err != nil || duration <= 0 {
+		http.Error(rw, fmt.Sprintf("wrong duration format '%s'", query.Get("duration")), http.StatusBadRequest)
+
+		return
+	}
+
+	if err = r.grants.add(client, domain, duration); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// apiAllowRevoke is the http endpoint to revoke an allow grant
+// @Summary Revoke allow grant
+// @Description removes the grant of the domain for the client
+// @Tags blocking
+// @Param domain query string true "domain (Example: example.com)"
+// @Param client query string true "client (name, MAC, IP or host name)"
+// @Success 200   "Grant is revoked"
+// @Failure 404   "Unknown grant"
+// @Router /blocking/allow/revoke [get]
+func (r *BlockingResolver) apiAllowRevoke(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	if err := r.grants.remove(query.Get("client"), query.Get("domain")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errUnknownGrant) {
+			status = http.StatusNotFound
+		}
+
+		http.Error(rw, err.Error(), status)
+	}
+}
+
+// apiAllowList is the http endpoint to get all active allow grants
+// @Summary Allow grants
+// @Description returns all active allow grants
+// @Tags blocking
+// @Produce  json
+// @Success 200 {array} api.AllowGrant "grants sorted by client and domain"
+// @Router /blocking/allow/list [get]
+func (r *BlockingResolver) apiAllowList(rw http.ResponseWriter, _ *http.Request) {
+	response, _ := json.Marshal(r.grants.status())
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if _, err := rw.Write(response); err != nil {
+		log.Logger.Error("unable to write response ", err)
+	}
+}
@@ -0,0 +1,211 @@
+package resolver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+	. "github.com/stgnet/blocky/helpertest"
+	"github.com/stgnet/blocky/state"
+
+	"github.com/go-chi/chi"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("Grants", func() {
+	var (
+		dir   string
+		store *state.Store
+		sut   *grants
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "grants")
+		Expect(err).Should(Succeed())
+
+		store = state.NewStore(filepath.Join(dir, "state.json"))
+		sut = newGrants(store)
+	})
+
+	AfterEach(func() {
+		sut.stop()
+		_ = os.RemoveAll(dir)
+	})
+
+	It("should allow the domain and its subdomains only for the client", func() {
+		Expect(sut.add("AA-BB-CC-DD-EE-FF", "Example.com.", time.Hour)).Should(Succeed())
+
+		key, ok := sut.granted("www.example.com", "aa:bb:cc:dd:ee:ff")
+		Expect(ok).Should(BeTrue())
+		Expect(key).Should(Equal(grantKey{Client: "aa:bb:cc:dd:ee:ff", Domain: "example.com"}))
+
+		_, ok = sut.granted("example.org", "aa:bb:cc:dd:ee:ff")
+		Expect(ok).Should(BeFalse())
+
+		_, ok = sut.granted("example.com", "other")
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("should expire and keep active grants after restart", func() {
+		Expect(sut.add("tablet", "example.com", time.Hour)).Should(Succeed())
+		Expect(sut.add("tablet", "short.com", 100*time.Millisecond)).Should(Succeed())
+
+		Eventually(func() bool {
+			_, ok := sut.granted("short.com", "tablet")
+
+			return ok
+		}, "1s").Should(BeFalse())
+
+		restarted := newGrants(store)
+		defer restarted.stop()
+
+		status := restarted.status()
+		Expect(status).Should(HaveLen(1))
+		Expect(status[0].Domain).Should(Equal("example.com"))
+		Expect(status[0].ExpiresInSec).Should(BeNumerically(">", 3500))
+	})
+
+	It("should keep active grants on reload without state file", func() {
+		old := newGrants(state.NewStore(""))
+		defer old.stop()
+
+		Expect(old.add("tablet", "example.com", time.Hour)).Should(Succeed())
+
+		reloaded := newGrants(state.NewStore(""))
+		defer reloaded.stop()
+
+		reloaded.takeOver(old)
+		old.stop()
+
+		_, ok := reloaded.granted("www.example.com", "tablet")
+		Expect(ok).Should(BeTrue())
+	})
+
+	It("should keep the grants unchanged if the change can't be saved", func() {
+		Expect(sut.add("tablet", "example.com", time.Hour)).Should(Succeed())
+
+		// the directory of the state file is missing, save fails
+		Expect(os.RemoveAll(dir)).Should(Succeed())
+
+		Expect(sut.add("tablet", "other.com", time.Hour)).ShouldNot(Succeed())
+		Expect(sut.remove("tablet", "example.com")).ShouldNot(Succeed())
+
+		_, ok := sut.granted("other.com", "tablet")
+		Expect(ok).Should(BeFalse())
+
+		_, ok = sut.granted("example.com", "tablet")
+		Expect(ok).Should(BeTrue())
+		Expect(sut.timers).Should(HaveLen(1))
+	})
+
+	It("should revoke grants", func() {
+		Expect(sut.add("tablet", "example.com", time.Hour)).Should(Succeed())
+		Expect(sut.remove("tablet", "example.com")).Should(Succeed())
+
+		_, ok := sut.granted("example.com", "tablet")
+		Expect(ok).Should(BeFalse())
+
+		err := sut.remove("tablet", "example.com")
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("unknown grant"))
+	})
+
+	When("domain is allowed via API", func() {
+		var (
+			r    *BlockingResolver
+			m    *resolverMock
+			file *os.File
+		)
+
+		BeforeEach(func() {
+			file = TempFile("sub.blocked.com")
+			res, err := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+				BlackLists:        map[string][]string{"kids": {file.Name()}},
+				ClientGroupsBlock: map[string][]string{"default": {"kids"}},
+				Mode:              config.BlockingModeLists,
+			}, nil, store, nil)
+			Expect(err).Should(Succeed())
+
+			r = res.(*BlockingResolver)
+			r.grants.stop()
+			r.grants = sut
+
+			m = &resolverMock{}
+			m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+			r.Next(m)
+		})
+
+		AfterEach(func() {
+			r.Stop()
+			_ = os.Remove(file.Name())
+		})
+
+		It("should resolve the domain only for the client until the grant is revoked", func() {
+			mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+			request := newRequestWithClient("sub.blocked.com.", dns.TypeA, "1.2.1.2", "tablet")
+			request.ClientMAC = mac
+
+			By("blocked without grant", func() {
+				resp, err := r.Resolve(request)
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(BLOCKED))
+			})
+
+			By("allow for the MAC", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/allow?domain=blocked.com&client=AA:BB:CC:DD:EE:FF&duration=30m",
+					r.apiAllow)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				resp, err := r.Resolve(request)
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(RESOLVED))
+
+				resp, err = r.Resolve(newRequestWithClient("sub.blocked.com.", dns.TypeA, "1.2.1.3", "other"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(BLOCKED))
+			})
+
+			By("list grants", func() {
+				httpCode, body := DoGetRequest("/api/blocking/allow/list", r.apiAllowList)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var result []api.AllowGrant
+				Expect(json.NewDecoder(body).Decode(&result)).Should(Succeed())
+				Expect(result).Should(HaveLen(1))
+				Expect(result[0].Client).Should(Equal("aa:bb:cc:dd:ee:ff"))
+			})
+
+			By("revoke grant", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/allow/revoke?domain=blocked.com&client=aa:bb:cc:dd:ee:ff",
+					r.apiAllowRevoke)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				resp, err := r.Resolve(request)
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(BLOCKED))
+
+				httpCode, _ = DoGetRequest("/api/blocking/allow/revoke?domain=blocked.com&client=aa:bb:cc:dd:ee:ff",
+					r.apiAllowRevoke)
+				Expect(httpCode).Should(Equal(http.StatusNotFound))
+			})
+
+			By("wrong parameters", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/allow?domain=blocked.com&client=tablet&duration=xyz", r.apiAllow)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+
+				httpCode, _ = DoGetRequest("/api/blocking/allow?domain=blocked.com&duration=1h", r.apiAllow)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+})
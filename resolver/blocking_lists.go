@@ -0,0 +1,179 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/lists"
+	"github.com/stgnet/blocky/log"
+	"github.com/stgnet/blocky/util"
+
+	"github.com/miekg/dns"
+)
+
+// ListManager is implemented by matchers, which report the state of their lists, refresh and search them on demand
+type ListManager interface {
+	// Status returns the state of all groups and their sources
+	Status() []api.ListGroupStatus
+
+	// Refresh loads the lists of the group immediately, the lists of all groups if group is empty
+	Refresh(group string) error
+
+	// Search returns all rules of all groups and sources, which match the domain
+	Search(domain string) []api.ListMatch
+}
+
+func (r *BlockingResolver) listManagers() (result []ListManager) {
+	for _, m := range []lists.Matcher{r.blacklistMatcher, r.whitelistMatcher} {
+		if lm, ok := m.(ListManager); ok {
+			result = append(result, lm)
+		}
+	}
+
+	return
+}
+
+func (r *BlockingResolver) listsStatus() []api.ListGroupStatus {
+	result := []api.ListGroupStatus{}
+
+	for _, m := range r.listManagers() {
+		result = append(result, m.Status()...)
+	}
+
+	return result
+}
+
+func (r *BlockingResolver) writeListsStatus(rw http.ResponseWriter) {
+	response, _ := json.Marshal(r.listsStatus())
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if _, err := rw.Write(response); err != nil {
+		log.Logger.Error("unable to write response ", err)
+	}
+}
+
+// apiLists is the http endpoint to get the state of the black and white lists
+// @Summary Lists status
+// @Description returns each group of the black and white lists with its sources: entries, invalid lines,
+// @Description time of the last refresh and last error
+// @Tags lists
+// @Produce  json
+// @Success 200 {array} api.ListGroupStatus "blacklist and whitelist groups sorted by group name"
+// @Router /lists [get]
+func (r *BlockingResolver) apiLists(rw http.ResponseWriter, _ *http.Request) {
+	r.writeListsStatus(rw)
+}
+
+// apiListsRefresh is the http endpoint to refresh the lists immediately
+// @Summary Refresh lists
+// @Description downloads the lists of the group (black and white list) or of all groups and returns the new state
+// @Tags lists
+// @Param group query string false "group to refresh, all groups if empty (Example: ads)"
+// @Produce  json
+// @Success 200 {array} api.ListGroupStatus "blacklist and whitelist groups sorted by group name"
+// @Failure 404   "Unknown group"
+// @Router /lists/refresh [get]
+func (r *BlockingResolver) apiListsRefresh(rw http.ResponseWriter, req *http.Request) {
+	group := req.URL.Query().Get("group")
+
+	var (
+		refreshed int
+		lastErr   error
+	)
+
+	for _, m := range r.listManagers() {
+		if err := m.Refresh(group); err != nil {
+			lastErr = err
+
+			continue
+		}
+
+		refreshed++
+	}
+
+	if refreshed == 0 && lastErr != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(lastErr, lists.ErrUnknownGroup) {
+			status = http.StatusNotFound
+		}
+
+		http.Error(rw, lastErr.Error(), status)
+
+		return
+	}
+
+	r.writeListsStatus(rw)
+}
+
+// privateDNSVerdicts asks the private DNS for the verdict of each category, nil if private DNS isn't used
+func (r *BlockingResolver) privateDNSVerdicts(ctx context.Context, domain string) []api.CategoryVerdict {
+	if r.mode == config.BlockingModeLists {
+		return nil
+	}
+
+	result := make([]api.CategoryVerdict, 0, len(r.privateDNS.categories))
+
+	for _, c := range r.privateDNS.categories {
+		verdict := api.CategoryVerdict{Category: c.name, GlobalEnabled: r.globals.enabled(c.name)}
+
+		request := &Request{
+			Req: util.NewMsgWithQuestion(dns.Fqdn(domain), dns.TypeA),
+			Log: logger("lists_search"),
+			Ctx: ctx,
+		}
+
+		rcode, _, err := r.privateVerdict(request, domain, r.privateDNS.port([]string{c.name}))
+		if err != nil {
+			verdict.Error = err.Error()
+		} else {
+			verdict.Blocked = rcode == dns.RcodeNameError
+		}
+
+		result = append(result, verdict)
+	}
+
+	return result
+}
+
+// apiListsSearch is the http endpoint to search a domain in the lists
+// @Summary Search domain
+// @Description returns each group, source and rule of the black and white lists, which match the domain (exact,
+// @Description wildcard or regex). If private DNS is used, the verdict of each category is returned too
+// @Tags lists
+// @Param domain query string true "domain (Example: ads.example.com)"
+// @Produce  json
+// @Success 200 {object} api.ListSearchResult "matching rules sorted by list type and group"
+// @Failure 400   "Domain is missing"
+// @Router /lists/search [get]
+func (r *BlockingResolver) apiListsSearch(rw http.ResponseWriter, req *http.Request) {
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(req.URL.Query().Get("domain")), "."))
+	if domain == "" {
+		http.Error(rw, "domain is required", http.StatusBadRequest)
+
+		return
+	}
+
+	result := api.ListSearchResult{
+		Domain:     domain,
+		Matches:    []api.ListMatch{},
+		PrivateDNS: r.privateDNSVerdicts(req.Context(), domain),
+	}
+
+	for _, m := range r.listManagers() {
+		result.Matches = append(result.Matches, m.Search(domain)...)
+	}
+
+	response, _ := json.Marshal(result)
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if _, err := rw.Write(response); err != nil {
+		log.Logger.Error("unable to write response ", err)
+	}
+}
@@ -0,0 +1,127 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+	. "github.com/stgnet/blocky/helpertest"
+
+	"github.com/go-chi/chi"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lists API", func() {
+	var (
+		sut          *BlockingResolver
+		black, white *os.File
+	)
+
+	decodeResponse := func(body *bytes.Buffer) (result []api.ListGroupStatus) {
+		Expect(json.NewDecoder(body).Decode(&result)).Should(Succeed())
+
+		return
+	}
+
+	BeforeEach(func() {
+		black = TempFile("blocked1.com\nblocked2.com")
+		white = TempFile("allowed.com")
+
+		res, err := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+			BlackLists:        map[string][]string{"ads": {black.Name()}},
+			WhiteLists:        map[string][]string{"ads": {white.Name()}},
+			ClientGroupsBlock: map[string][]string{"default": {"ads"}},
+			Mode:              config.BlockingModeLists,
+		}, nil, nil, nil)
+		Expect(err).Should(Succeed())
+
+		sut = res.(*BlockingResolver)
+	})
+
+	AfterEach(func() {
+		sut.Stop()
+		_ = os.Remove(black.Name())
+		_ = os.Remove(white.Name())
+	})
+
+	It("should return the state of all groups and sources", func() {
+		httpCode, body := DoGetRequest(api.ListsPath, sut.apiLists)
+		Expect(httpCode).Should(Equal(http.StatusOK))
+
+		result := decodeResponse(body)
+		Expect(result).Should(HaveLen(2))
+		Expect(result[0].Type).Should(Equal("blacklist"))
+		Expect(result[0].Group).Should(Equal("ads"))
+		Expect(result[0].Entries).Should(Equal(2))
+		Expect(result[0].Sources).Should(HaveLen(1))
+		Expect(result[0].Sources[0].Link).Should(Equal(black.Name()))
+		Expect(result[0].Sources[0].LastRefresh).ShouldNot(BeNil())
+		Expect(result[1].Type).Should(Equal("whitelist"))
+		Expect(result[1].Entries).Should(Equal(1))
+	})
+
+	It("should refresh the lists of the group", func() {
+		_, err := black.WriteString("\nblocked3.com\n")
+		Expect(err).Should(Succeed())
+
+		httpCode, body := DoGetRequest(api.ListsRefreshPath+"?group=ads", sut.apiListsRefresh)
+		Expect(httpCode).Should(Equal(http.StatusOK))
+		Expect(decodeResponse(body)[0].Entries).Should(Equal(3))
+
+		found, _ := sut.blacklistMatcher.Match("blocked3.com", []string{"ads"})
+		Expect(found).Should(BeTrue())
+	})
+
+	It("should search the domain in all lists", func() {
+		httpCode, body := DoGetRequest(api.ListsSearchPath+"?domain=Blocked1.com.", sut.apiListsSearch)
+		Expect(httpCode).Should(Equal(http.StatusOK))
+
+		var result api.ListSearchResult
+		Expect(json.NewDecoder(body).Decode(&result)).Should(Succeed())
+		Expect(result.Domain).Should(Equal("blocked1.com"))
+		Expect(result.Matches).Should(Equal([]api.ListMatch{{Type: "blacklist", Group: "ads", Link: black.Name(),
+			Rule: "blocked1.com", Kind: "exact"}}))
+		Expect(result.PrivateDNS).Should(BeEmpty())
+
+		httpCode, _ = DoGetRequest(api.ListsSearchPath, sut.apiListsSearch)
+		Expect(httpCode).Should(Equal(http.StatusBadRequest))
+	})
+
+	It("should return the private DNS verdict of each category", func() {
+		sut.mode = config.BlockingModeBoth
+		adblockPort := fmt.Sprintf(":%d", sut.privateDNS.port([]string{"adblock"}))
+		sut.privateDNS.client = &privateDNSClientMock{fn: func(upstreamURL string) (*dns.Msg, error) {
+			msg := new(dns.Msg)
+			if strings.HasSuffix(upstreamURL, adblockPort) {
+				msg.Rcode = dns.RcodeNameError
+			}
+
+			return msg, nil
+		}}
+
+		httpCode, body := DoGetRequest(api.ListsSearchPath+"?domain=example.com", sut.apiListsSearch)
+		Expect(httpCode).Should(Equal(http.StatusOK))
+
+		var result api.ListSearchResult
+		Expect(json.NewDecoder(body).Decode(&result)).Should(Succeed())
+		Expect(result.Matches).Should(BeEmpty())
+		Expect(result.PrivateDNS).Should(HaveLen(len(sut.privateDNS.categories)))
+
+		for _, v := range result.PrivateDNS {
+			Expect(v.Blocked).Should(Equal(v.Category == "adblock"), v.Category)
+			Expect(v.Error).Should(BeEmpty())
+		}
+	})
+
+	It("should return 404 for unknown groups", func() {
+		httpCode, _ := DoGetRequest(api.ListsRefreshPath+"?group=unknown", sut.apiListsRefresh)
+		Expect(httpCode).Should(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,200 @@
+package resolver
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/log"
+)
+
+// pauseScope defines, which part of the blocking is paused
+type pauseScope string
+
+const (
+	pauseScopeGroup    pauseScope = "group"
+	pauseScopeClient   pauseScope = "client"
+	pauseScopeCategory pauseScope = "category"
+)
+
+type pauseKey struct {
+	scope pauseScope
+	name  string
+}
+
+// pause is a temporary deactivation of blocking for one group, client or category. A zero end means, the pause
+// lasts until blocking is enabled again
+type pause struct {
+	end   time.Time
+	timer *time.Timer
+}
+
+// pauses contains all active pauses, each with its own auto enable timer
+type pauses struct {
+	lock    sync.RWMutex
+	entries map[pauseKey]*pause
+}
+
+func newPauses() *pauses {
+	return &pauses{entries: make(map[pauseKey]*pause)}
+}
+
+// add pauses the blocking for the scope and name. An existing pause will be replaced
+func (p *pauses) add(scope pauseScope, name string, duration time.Duration) {
+	key := pauseKey{scope: scope, name: name}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.stopTimer(key)
+
+	entry := &pause{}
+
+	if duration == 0 {
+		log.Logger.Infof("disable blocking for %s '%s'", scope, name)
+	} else {
+		log.Logger.Infof("disable blocking for %s '%s' for %s", scope, name, duration)
+		entry.end = time.Now().Add(duration)
+		entry.timer = time.AfterFunc(duration, func() {
+			p.lock.Lock()
+			if p.entries[key] == entry {
+				delete(p.entries, key)
+			}
+			p.lock.Unlock()
+
+			log.Logger.Infof("blocking for %s '%s' enabled again", scope, name)
+		})
+	}
+
+	p.entries[key] = entry
+}
+
+// remove ends the pause for the scope and name
+func (p *pauses) remove(scope pauseScope, name string) {
+	key := pauseKey{scope: scope, name: name}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.stopTimer(key)
+	delete(p.entries, key)
+}
+
+// stopTimer must be called with write lock
+func (p *pauses) stopTimer(key pauseKey) {
+	if e, found := p.entries[key]; found && e.timer != nil {
+		e.timer.Stop()
+	}
+}
+
+func (p *pauses) isPaused(scope pauseScope, name string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	_, found := p.entries[pauseKey{scope: scope, name: name}]
+
+	return found
+}
+
+// pausedName returns the first of the names, which is paused for the scope
+func (p *pauses) pausedName(scope pauseScope, names ...string) (string, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, name := range names {
+		if _, found := p.entries[pauseKey{scope: scope, name: name}]; found {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// filterGroups returns the groups without paused groups
+func (p *pauses) filterGroups(groups []string) []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if len(p.entries) == 0 {
+		return groups
+	}
+
+	result := make([]string, 0, len(groups))
+
+	for _, g := range groups {
+		if _, found := p.entries[pauseKey{scope: pauseScopeGroup, name: g}]; !found {
+			result = append(result, g)
+		}
+	}
+
+	return result
+}
+
+// status returns all active pauses sorted by scope and name
+func (p *pauses) status() []api.BlockingPause {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	result := make([]api.BlockingPause, 0, len(p.entries))
+
+	for key, e := range p.entries {
+		s := api.BlockingPause{Type: string(key.scope), Name: key.name}
+		if !e.end.IsZero() {
+			s.AutoEnableInSec = uint(time.Until(e.end).Seconds())
+		}
+
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Type != result[j].Type {
+			return result[i].Type < result[j].Type
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// takeOver continues the pauses of old with their remaining duration
+func (p *pauses) takeOver(old *pauses) {
+	old.lock.RLock()
+	defer old.lock.RUnlock()
+
+	for key, e := range old.entries {
+		var duration time.Duration
+
+		if !e.end.IsZero() {
+			if duration = time.Until(e.end); duration <= 0 {
+				continue
+			}
+		}
+
+		p.add(key.scope, key.name, duration)
+	}
+}
+
+func (p *pauses) stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, e := range p.entries {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+	}
+}
+
+// splitParam returns the comma separated values of the query parameter
+func splitParam(value string) (result []string) {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pauses", func() {
+	var sut *pauses
+
+	BeforeEach(func() {
+		sut = newPauses()
+	})
+
+	AfterEach(func() {
+		sut.stop()
+	})
+
+	It("should filter paused groups", func() {
+		sut.add(pauseScopeGroup, "kids", 0)
+
+		Expect(sut.filterGroups([]string{"adults", "kids"})).Should(Equal([]string{"adults"}))
+		Expect(sut.isPaused(pauseScopeClient, "kids")).Should(BeFalse())
+
+		sut.remove(pauseScopeGroup, "kids")
+		Expect(sut.filterGroups([]string{"adults", "kids"})).Should(Equal([]string{"adults", "kids"}))
+	})
+
+	It("should end each pause after its own duration", func() {
+		sut.add(pauseScopeClient, "laptop", 100*time.Millisecond)
+		sut.add(pauseScopeClient, "tablet", time.Hour)
+
+		name, paused := sut.pausedName(pauseScopeClient, "192.168.178.2", "laptop")
+		Expect(paused).Should(BeTrue())
+		Expect(name).Should(Equal("laptop"))
+
+		Eventually(func() bool {
+			return sut.isPaused(pauseScopeClient, "laptop")
+		}, "1s").Should(BeFalse())
+
+		Expect(sut.isPaused(pauseScopeClient, "tablet")).Should(BeTrue())
+		Expect(sut.status()).Should(HaveLen(1))
+	})
+
+	It("should replace an existing pause", func() {
+		sut.add(pauseScopeCategory, "adult", 100*time.Millisecond)
+		sut.add(pauseScopeCategory, "adult", 0)
+
+		Consistently(func() bool {
+			return sut.isPaused(pauseScopeCategory, "adult")
+		}, "300ms").Should(BeTrue())
+		Expect(sut.status()[0].AutoEnableInSec).Should(BeZero())
+	})
+
+	It("should split comma separated parameters", func() {
+		Expect(splitParam(" kids, guests,,")).Should(Equal([]string{"kids", "guests"}))
+		Expect(splitParam("")).Should(BeEmpty())
+	})
+})
@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -12,10 +13,13 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/clients"
 	"github.com/stgnet/blocky/config"
 	"github.com/stgnet/blocky/lists"
 	"github.com/stgnet/blocky/log"
 	"github.com/stgnet/blocky/metrics"
+	"github.com/stgnet/blocky/schedule"
+	"github.com/stgnet/blocky/state"
 	"github.com/stgnet/blocky/util"
 
 	"github.com/go-chi/chi"
@@ -23,14 +27,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func createBlockHandler(cfg config.BlockingConfig) blockHandler {
+func createBlockHandler(cfg config.BlockingConfig) (blockHandler, error) {
 	cfgBlockType := strings.TrimSpace(strings.ToUpper(cfg.BlockType))
 	if cfgBlockType == "" || cfgBlockType == "ZEROIP" {
-		return zeroIPBlockHandler{}
+		return zeroIPBlockHandler{}, nil
 	}
 
 	if cfgBlockType == "NXDOMAIN" {
-		return nxDomainBlockHandler{}
+		return nxDomainBlockHandler{}, nil
 	}
 
 	var ips []net.IP
@@ -45,12 +49,11 @@ func createBlockHandler(cfg config.BlockingConfig) blockHandler {
 		return ipBlockHandler{
 			destinations:    ips,
 			fallbackHandler: zeroIPBlockHandler{},
-		}
+		}, nil
 	}
 
-	log.Logger.Fatalf("unknown blockType, please use one of: ZeroIP, NxDomain or specify destination IP address(es)")
-
-	return zeroIPBlockHandler{}
+	return nil, fmt.Errorf("unknown blockType '%s', please use one of: ZeroIP, NxDomain or specify destination IP "+
+		"address(es)", cfg.BlockType)
 }
 
 type status struct {
@@ -99,24 +102,55 @@ type BlockingResolver struct {
 	blockHandler        blockHandler
 	whitelistOnlyGroups []string
 	status              status
+	privateDNS          *privateDNSClient
+	privateBlocked      *prometheus.CounterVec
+	verdictCache        *verdictCache
+	clients             *clients.Registry
+	mode                string
+	globals             *globalCategories
+	pauses              *pauses
+	schedules           *schedule.Registry
+	budgets             *budgets
+	grants              *grants
 }
 
-func NewBlockingResolver(router *chi.Mux, cfg config.BlockingConfig) ChainedResolver {
-	blockHandler := createBlockHandler(cfg)
-	blacklistMatcher := lists.NewListCache(lists.BLACKLIST, cfg.BlackLists, cfg.RefreshPeriod)
-	whitelistMatcher := lists.NewListCache(lists.WHITELIST, cfg.WhiteLists, cfg.RefreshPeriod)
+func NewBlockingResolver(router *chi.Mux, cfg config.BlockingConfig, registry *clients.Registry,
+	store *state.Store, schedules *schedule.Registry) (ChainedResolver, error) {
+	blockHandler, err := createBlockHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	blacklistMatcher := lists.NewListCache(lists.BLACKLIST, cfg.BlackLists, cfg)
+	whitelistMatcher := lists.NewListCache(lists.WHITELIST, cfg.WhiteLists, cfg)
 	whitelistOnlyGroups := determineWhitelistOnlyGroups(&cfg)
 
 	var enabledGauge prometheus.Gauge
 
+	var privateBlocked *prometheus.CounterVec
+
 	if metrics.IsEnabled() {
+		privateBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "blocky_private_blocked_total",
+			Help: "Number of queries blocked by private DNS per active category",
+		}, []string{"category"})
+
+		privateBlocked = metrics.RegisterMetric(privateBlocked).(*prometheus.CounterVec)
+
 		enabledGauge = prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "blocky_blocking_enabled",
 			Help: "Blockings status",
 		})
 		enabledGauge.Set(1)
 
-		metrics.RegisterMetric(enabledGauge)
+		enabledGauge = metrics.ReplaceMetric(enabledGauge).(prometheus.Gauge)
+	}
+
+	privateDNS := newPrivateDNSClient(cfg.PrivateDNS)
+
+	categories := make([]string, len(privateDNS.categories))
+	for i, c := range privateDNS.categories {
+		categories[i] = c.name
 	}
 
 	res := &BlockingResolver{
@@ -125,6 +159,16 @@ func NewBlockingResolver(router *chi.Mux, cfg config.BlockingConfig) ChainedReso
 		blacklistMatcher:    blacklistMatcher,
 		whitelistMatcher:    whitelistMatcher,
 		whitelistOnlyGroups: whitelistOnlyGroups,
+		privateDNS:          privateDNS,
+		privateBlocked:      privateBlocked,
+		verdictCache:        newVerdictCache(cfg.PrivateDNS.VerdictCache),
+		clients:             registry,
+		mode:                blockingMode(cfg.Mode),
+		globals:             newGlobalCategories(cfg.Global, categories, store),
+		pauses:              newPauses(),
+		schedules:           schedules,
+		budgets:             newBudgets(cfg.Budgets, store),
+		grants:              newGrants(store),
 		status: status{
 			enabledGauge: enabledGauge,
 			enabled:      true,
@@ -132,23 +176,87 @@ func NewBlockingResolver(router *chi.Mux, cfg config.BlockingConfig) ChainedReso
 		},
 	}
 
+	// router is nil for repeated blocking stages of the pipeline, the API endpoints belong to the first one
+	if router == nil {
+		return res, nil
+	}
+
 	// register API endpoints
 	router.Get(api.BlockingEnablePath, res.apiBlockingEnable)
 	router.Get(api.BlockingDisablePath, res.apiBlockingDisable)
 	router.Get(api.BlockingStatusPath, res.apiBlockingStatus)
+	router.Get(api.BlockingVerdictCacheFlushPath, res.apiVerdictCacheFlush)
+	router.Get(api.BlockingGlobalEnablePath, res.apiGlobalEnable)
+	router.Get(api.BlockingGlobalDisablePath, res.apiGlobalDisable)
+	router.Get(api.BlockingBudgetsPath, res.apiBudgets)
+	router.Get(api.BlockingBudgetsResetPath, res.apiBudgetsReset)
+	router.Get(api.BlockingAllowPath, res.apiAllow)
+	router.Get(api.BlockingAllowRevokePath, res.apiAllowRevoke)
+	router.Get(api.BlockingAllowListPath, res.apiAllowList)
+	router.Get(api.ListsPath, res.apiLists)
+	router.Get(api.ListsRefreshPath, res.apiListsRefresh)
+	router.Get(api.ListsSearchPath, res.apiListsSearch)
+
+	return res, nil
+}
+
+// TakeState continues the disabled blocking status, the pauses, the budget usage, the global overrides and the allow
+// grants of the resolver, which is replaced on config reload
+func (r *BlockingResolver) TakeState(old Resolver) {
+	o, ok := old.(*BlockingResolver)
+	if !ok {
+		return
+	}
+
+	if !o.status.enabled {
+		// a zero duration disables blocking until it is enabled again
+		var duration time.Duration
+		if o.status.disableEnd.After(time.Now()) {
+			duration = time.Until(o.status.disableEnd)
+		}
+
+		r.status.disableBlocking(duration)
+	}
 
-	return res
+	r.pauses.takeOver(o.pauses)
+	r.budgets.takeOver(o.budgets)
+	r.globals.takeOver(o.globals)
+	r.grants.takeOver(o.grants)
 }
 
 // apiBlockingEnable is the http endpoint to enable the blocking status
 // @Summary Enable blocking
-// @Description enable the blocking status
+// @Description enable the blocking status. With groups, client or category only the pauses of them are ended
 // @Tags blocking
+// @Param groups query string false "comma separated groups (Example: kids,guests)"
+// @Param client query string false "comma separated clients (name, MAC, IP or host name)"
+// @Param category query string false "comma separated categories (Example: adult)"
 // @Success 200   "Blocking is enabled"
 // @Router /blocking/enable [get]
-func (r *BlockingResolver) apiBlockingEnable(_ http.ResponseWriter, _ *http.Request) {
-	log.Logger.Info("enabling blocking...")
-	r.status.enableBlocking()
+func (r *BlockingResolver) apiBlockingEnable(_ http.ResponseWriter, req *http.Request) {
+	scoped := pauseParams(req)
+	if len(scoped) == 0 {
+		log.Logger.Info("enabling blocking...")
+		r.status.enableBlocking()
+
+		return
+	}
+
+	for _, k := range scoped {
+		log.Logger.Infof("enabling blocking for %s '%s'...", k.scope, k.name)
+		r.pauses.remove(k.scope, k.name)
+	}
+}
+
+// apiVerdictCacheFlush is the http endpoint to flush the cache of private DNS verdicts
+// @Summary Flush verdict cache
+// @Description removes all cached private DNS verdicts
+// @Tags blocking
+// @Success 200   "Verdict cache is flushed"
+// @Router /blocking/verdictcache/flush [get]
+func (r *BlockingResolver) apiVerdictCacheFlush(_ http.ResponseWriter, _ *http.Request) {
+	log.Logger.Info("flushing verdict cache...")
+	r.verdictCache.flush()
 }
 
 // apiBlockingStatus is the http endpoint to get current blocking status
@@ -167,6 +275,8 @@ func (r *BlockingResolver) apiBlockingStatus(rw http.ResponseWriter, _ *http.Req
 	response, _ := json.Marshal(api.BlockingStatus{
 		Enabled:         r.status.enabled,
 		AutoEnableInSec: uint(autoEnableDuration.Seconds()),
+		Global:          r.globals.status(),
+		Pauses:          r.pauses.status(),
 	})
 	_, err := rw.Write(response)
 
@@ -177,11 +287,15 @@ func (r *BlockingResolver) apiBlockingStatus(rw http.ResponseWriter, _ *http.Req
 
 // apiBlockingDisable is the http endpoint to disable the blocking status
 // @Summary Disable blocking
-// @Description disable the blocking status
+// @Description disable the blocking status. With groups, client or category only blocking for them is paused,
+// @Description each with its own auto enable timer
 // @Tags blocking
 // @Param duration query string false "duration of blocking (Example: 300s, 5m, 1h, 5m30s)" Format(duration)
+// @Param groups query string false "comma separated groups (Example: kids,guests)"
+// @Param client query string false "comma separated clients (name, MAC, IP or host name)"
+// @Param category query string false "comma separated categories (Example: adult)"
 // @Success 200   "Blocking is disabled"
-// @Failure 400   "Wrong duration format"
+// @Failure 400   "Wrong duration format or unknown category"
 // @Router /blocking/disable [get]
 func (r *BlockingResolver) apiBlockingDisable(rw http.ResponseWriter, req *http.Request) {
 	var (
@@ -201,7 +315,120 @@ func (r *BlockingResolver) apiBlockingDisable(rw http.ResponseWriter, req *http.
 		}
 	}
 
-	r.status.disableBlocking(duration)
+	scoped := pauseParams(req)
+	if len(scoped) == 0 {
+		r.status.disableBlocking(duration)
+
+		return
+	}
+
+	for _, k := range scoped {
+		if k.scope == pauseScopeCategory && !r.globals.isCategory(k.name) {
+			http.Error(rw, fmt.Sprintf("%v '%s'", errUnknownCategory, k.name), http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	for _, k := range scoped {
+		r.pauses.add(k.scope, k.name, duration)
+	}
+}
+
+// pauseParams returns the groups, clients and categories of the request's query parameters
+func pauseParams(req *http.Request) (result []pauseKey) {
+	query := req.URL.Query()
+
+	for _, p := range []struct {
+		param string
+		scope pauseScope
+	}{
+		{"groups", pauseScopeGroup},
+		{"client", pauseScopeClient},
+		{"category", pauseScopeCategory},
+	} {
+		for _, name := range splitParam(query.Get(p.param)) {
+			if p.scope == pauseScopeClient {
+				name = normalizeClientKey(name)
+			}
+
+			result = append(result, pauseKey{scope: p.scope, name: name})
+		}
+	}
+
+	return
+}
+
+// apiGlobalEnable is the http endpoint to switch a global category on
+// @Summary Enable global category
+// @Description switches the global category on, optionally for a certain duration
+// @Tags blocking
+// @Param category query string true "name of the category (Example: adult)"
+// @Param duration query string false "duration (Example: 300s, 5m, 1h, 5m30s)" Format(duration)
+// @Success 200   "Category is enabled"
+// @Failure 400   "Wrong duration format or unknown category"
+// @Router /blocking/global/enable [get]
+func (r *BlockingResolver) apiGlobalEnable(rw http.ResponseWriter, req *http.Request) {
+	r.apiGlobalSet(rw, req, true)
+}
+
+// apiGlobalDisable is the http endpoint to switch a global category off
+// @Summary Disable global category
+// @Description switches the global category off, optionally for a certain duration
+// @Tags blocking
+// @Param category query string true "name of the category (Example: adult)"
+// @Param duration query string false "duration (Example: 300s, 5m, 1h, 5m30s)" Format(duration)
+// @Success 200   "Category is disabled"
+// @Failure 400   "Wrong duration format or unknown category"
+// @Router /blocking/global/disable [get]
+func (r *BlockingResolver) apiGlobalDisable(rw http.ResponseWriter, req *http.Request) {
+	r.apiGlobalSet(rw, req, false)
+}
+
+func (r *BlockingResolver) apiGlobalSet(rw http.ResponseWriter, req *http.Request, enabled bool) {
+	var (
+		duration time.Duration
+		err      error
+	)
+
+	category := req.URL.Query().Get("category")
+
+	durationParam := req.URL.Query().Get("duration")
+	if len(durationParam) > 0 {
+		duration, err = time.ParseDuration(durationParam)
+		if err != nil {
+			log.Logger.Errorf("wrong duration format '%s'", durationParam)
+			rw.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	log.Logger.Infof("setting global category '%s' to %t (duration %s)...", category, enabled, duration)
+
+	if err = r.globals.set(category, enabled, duration); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errUnknownCategory) {
+			status = http.StatusBadRequest
+		}
+
+		http.Error(rw, err.Error(), status)
+	}
+}
+
+// Stop stops the auto enable timer and the refresh of black and white lists
+func (r *BlockingResolver) Stop() {
+	r.status.enableTimer.Stop()
+	r.globals.stop()
+	r.pauses.stop()
+	r.budgets.stop()
+	r.grants.stop()
+
+	for _, m := range []lists.Matcher{r.blacklistMatcher, r.whitelistMatcher} {
+		if s, ok := m.(Stoppable); ok {
+			s.Stop()
+		}
+	}
 }
 
 // returns groups, which have only whitelist entries
@@ -225,26 +452,52 @@ func (r *BlockingResolver) handleBlocked(logger *logrus.Entry,
 	response := new(dns.Msg)
 	response.SetReply(request.Req)
 
-	r.blockHandler.handleBlock(question, response)
+	blockHandler := r.blockHandler
+	if client, _ := r.clients.Lookup(clientIdentity(request)); client != nil && client.BlockType != "" {
+		if h, err := createBlockHandler(config.BlockingConfig{BlockType: client.BlockType}); err == nil {
+			blockHandler = h
+		} else {
+			logger.Warnf("using default block type for client '%s': %v", client.Name, err)
+		}
+	}
+
+	blockHandler.handleBlock(question, response)
 
 	logger.Debugf("blocking request '%s'", reason)
+	request.trace("BlockingResolver", "blocked", map[string]interface{}{"reason": reason})
 
 	return &Response{Res: response, RType: BLOCKED, Reason: reason}, nil
 }
 
 func (r *BlockingResolver) Configuration() (result []string) {
-	if len(r.cfg.ClientGroupsBlock) > 0 {
+	if len(r.cfg.ClientGroupsBlock) > 0 || len(r.clients.Clients()) > 0 {
 		result = append(result, "clientGroupsBlock")
 		for key, val := range r.cfg.ClientGroupsBlock {
 			result = append(result, fmt.Sprintf("  %s = \"%s\"", key, strings.Join(val, ";")))
 		}
 
+		result = append(result, "clients:")
+		for _, c := range r.clients.Configuration() {
+			result = append(result, fmt.Sprintf("  %s", c))
+		}
+
 		result = append(result, "global:")
-		for key, val := range r.cfg.Global {
+		for key, val := range r.globals.snapshot() {
 			result = append(result, fmt.Sprintf("  %s = \"%t\"", key, val))
 		}
 
+		result = append(result, "schedules:")
+		for _, c := range r.schedules.Configuration() {
+			result = append(result, fmt.Sprintf("  %s", c))
+		}
+
+		result = append(result, "budgets:")
+		for _, c := range r.budgets.Configuration() {
+			result = append(result, fmt.Sprintf("  %s", c))
+		}
+
 		result = append(result, fmt.Sprintf("blockType = \"%s\"", r.cfg.BlockType))
+		result = append(result, fmt.Sprintf("mode = \"%s\"", r.mode))
 
 		result = append(result, "blacklist:")
 		for _, c := range r.blacklistMatcher.Configuration() {
@@ -255,6 +508,16 @@ func (r *BlockingResolver) Configuration() (result []string) {
 		for _, c := range r.whitelistMatcher.Configuration() {
 			result = append(result, fmt.Sprintf("  %s", c))
 		}
+
+		result = append(result, "privateDNS:")
+		for _, c := range r.privateDNS.Configuration() {
+			result = append(result, fmt.Sprintf("  %s", c))
+		}
+
+		result = append(result, "verdictCache:")
+		for _, c := range r.verdictCache.Configuration() {
+			result = append(result, fmt.Sprintf("  %s", c))
+		}
 	} else {
 		result = []string{"deactivated"}
 	}
@@ -262,6 +525,14 @@ func (r *BlockingResolver) Configuration() (result []string) {
 	return
 }
 
+func blockingMode(mode string) string {
+	if mode == "" {
+		return config.BlockingModePrivate
+	}
+
+	return mode
+}
+
 func shouldHandle(question dns.Question) bool {
 	return question.Qtype == dns.TypeA || question.Qtype == dns.TypeAAAA
 }
@@ -279,8 +550,23 @@ func (r *BlockingResolver) handleBlacklist(groupsToCheck []string,
 		domain := util.ExtractDomain(question)
 		logger := logger.WithField("domain", domain)
 
+		if key, granted := r.grants.granted(domain, clientKeys(r.clients, request)...); granted {
+			logger.WithField("client", key.Client).Debugf("domain is allowed by grant")
+			request.trace("BlockingResolver", "domain is allowed by grant", map[string]interface{}{
+				"domain": key.Domain,
+				"client": key.Client,
+			})
+
+			return r.next.Resolve(request)
+		}
+
 		if whitelisted, group := r.matches(groupsToCheck, r.whitelistMatcher, domain); whitelisted {
 			logger.WithField("group", group).Debugf("domain is whitelisted")
+			request.trace("BlockingResolver", "domain is whitelisted", map[string]interface{}{
+				"domain": domain,
+				"group":  group,
+			})
+
 			return r.next.Resolve(request)
 		}
 
@@ -288,14 +574,55 @@ func (r *BlockingResolver) handleBlacklist(groupsToCheck []string,
 			return r.handleBlocked(logger, request, question, "BLOCKED (WHITELIST ONLY)")
 		}
 
-		port := r.getPort(groupsToCheck)
-		resp, err := resolvePrivate(request, port)
+		if exhausted, group := r.checkBudgets(request, groupsToCheck, domain); exhausted {
+			return r.handleBlocked(logger, request, question, fmt.Sprintf("BLOCKED BUDGET (%s)", group))
+		}
+
+		if r.mode != config.BlockingModePrivate {
+			if blocked, group := r.matches(r.budgets.withoutBudgetGroups(groupsToCheck), r.blacklistMatcher,
+				domain); blocked {
+				return r.handleBlocked(logger, request, question, fmt.Sprintf("BLOCKED (%s)", group))
+			}
+
+			if r.mode == config.BlockingModeLists {
+				continue
+			}
+		}
+
+		categories := r.activeCategories(groupsToCheck)
+		port := r.privateDNS.port(categories)
+		request.trace("BlockingResolver", "checking domain with private DNS", map[string]interface{}{
+			"domain":     domain,
+			"port":       port,
+			"categories": categories,
+		})
+
+		rcode, cached, err := r.privateVerdict(request, domain, port)
 		if err != nil {
+			if r.mode == config.BlockingModeBoth && request.Context().Err() == nil {
+				logger.Warnf("private dns is unreachable, using verdict of local lists: %v", err)
+				request.trace("BlockingResolver", "private DNS is unreachable, using verdict of local lists", map[string]interface{}{
+					"domain": domain,
+					"error":  err.Error(),
+				})
+
+				continue
+			}
+
 			return nil, err
 		}
 
-		if resp.Rcode == dns.RcodeNameError {
-			return r.handleBlocked(logger, request, question, fmt.Sprintf("BLOCKED PRIVATE (%d)", port))
+		request.trace("BlockingResolver", "private DNS verdict", map[string]interface{}{
+			"domain":     domain,
+			"returnCode": dns.RcodeToString[rcode],
+			"cached":     cached,
+		})
+
+		if rcode == dns.RcodeNameError {
+			r.countPrivateBlocked(categories)
+
+			return r.handleBlocked(logger.WithField("port", port), request, question,
+				fmt.Sprintf("BLOCKED PRIVATE (%s)", categoriesToString(categories)))
 		}
 
 		// if blocked, group := r.matches(groupsToCheck, r.blacklistMatcher, domain); blocked {
@@ -308,7 +635,12 @@ func (r *BlockingResolver) handleBlacklist(groupsToCheck []string,
 
 func (r *BlockingResolver) Resolve(request *Request) (*Response, error) {
 	logger := withPrefix(request.Log, "blacklist_resolver")
-	groupsToCheck := r.groupsToCheckForClient(request)
+	groupsToCheck := r.activeGroups(request, r.groupsToCheckForClient(request))
+
+	request.trace("BlockingResolver", "determined groups to check", map[string]interface{}{
+		"groups":          groupsToCheck,
+		"blockingEnabled": r.status.enabled,
+	})
 
 	if r.status.enabled && len(groupsToCheck) > 0 {
 		resp, err := r.handleBlacklist(groupsToCheck, request, logger)
@@ -327,7 +659,12 @@ func (r *BlockingResolver) Resolve(request *Request) (*Response, error) {
 
 				if whitelisted, group := r.matches(groupsToCheck, r.whitelistMatcher, entryToCheck); whitelisted {
 					logger.WithField("group", group).Debugf("%s is whitelisted", tName)
-				} else if blocked, group := r.matches(groupsToCheck, r.blacklistMatcher, entryToCheck); blocked {
+					request.trace("BlockingResolver", "response entry is whitelisted", map[string]interface{}{
+						"entry": entryToCheck,
+						"group": group,
+					})
+				} else if blocked, group := r.matches(r.budgets.withoutBudgetGroups(groupsToCheck), r.blacklistMatcher,
+					entryToCheck); blocked {
 					return r.handleBlocked(logger, request, request.Req.Question[0], fmt.Sprintf("BLOCKED %s (%s)", tName, group))
 				}
 			}
@@ -337,6 +674,34 @@ func (r *BlockingResolver) Resolve(request *Request) (*Response, error) {
 	return respFromNext, err
 }
 
+// activeGroups returns the groups without groups outside of their schedules and without paused groups.
+// Returns no groups, if blocking is paused for the client
+func (r *BlockingResolver) activeGroups(request *Request, groups []string) []string {
+	if name, paused := r.pauses.pausedName(pauseScopeClient, clientKeys(r.clients, request)...); paused {
+		request.trace("BlockingResolver", "blocking is paused for client", map[string]interface{}{"client": name})
+
+		return nil
+	}
+
+	scheduled := r.schedules.BlockingGroups(groups)
+	if len(scheduled) != len(groups) {
+		request.trace("BlockingResolver", "groups are outside of their schedules", map[string]interface{}{
+			"groups": groups,
+			"active": scheduled,
+		})
+	}
+
+	filtered := r.pauses.filterGroups(scheduled)
+	if len(filtered) != len(scheduled) {
+		request.trace("BlockingResolver", "blocking is paused for groups", map[string]interface{}{
+			"groups": scheduled,
+			"active": filtered,
+		})
+	}
+
+	return filtered
+}
+
 func extractEntryToCheckFromResponse(rr dns.RR) (entryToCheck string, tName string) {
 	switch v := rr.(type) {
 	case *dns.A:
@@ -353,8 +718,16 @@ func extractEntryToCheckFromResponse(rr dns.RR) (entryToCheck string, tName stri
 	return
 }
 
-// returns groups which should be checked for client's request
+// returns groups which should be checked for client's request. A client from the registry has precedence over
+// the entries of clientGroupsBlock
 func (r *BlockingResolver) groupsToCheckForClient(request *Request) (groups []string) {
+	if client := lookupClient("BlockingResolver", r.clients, request); client != nil {
+		groups = append(groups, client.Groups...)
+		sort.Strings(groups)
+
+		return
+	}
+
 	getEdnsData(request, r.cfg.ClientGroupsBlock, &groups)
 
 	for _, cName := range request.ClientNames {
@@ -387,7 +760,7 @@ func (r *BlockingResolver) matches(groupsToCheck []string, m lists.Matcher,
 	domain string) (blocked bool, group string) {
 	if len(groupsToCheck) > 0 {
 		found, group := m.Match(domain, groupsToCheck)
-		global, ok := r.cfg.Global[domain]
+		global, ok := r.globals.lookup(domain)
 		if !ok {
 			global = found
 		}
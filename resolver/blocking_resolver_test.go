@@ -4,21 +4,28 @@ import (
 	"testing"
 
 	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/clients"
 	"github.com/stgnet/blocky/config"
 	. "github.com/stgnet/blocky/helpertest"
 	"github.com/stgnet/blocky/metrics"
+	"github.com/stgnet/blocky/schedule"
+	"github.com/stgnet/blocky/state"
 	"github.com/stgnet/blocky/util"
 
 	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/miekg/dns"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -66,7 +73,10 @@ badcnamedomain.com`)
 	JustBeforeEach(func() {
 		m = &resolverMock{}
 		m.On("Resolve", mock.Anything).Return(&Response{Res: mockAnswer}, nil)
-		sut = NewBlockingResolver(chi.NewRouter(), sutConfig).(*BlockingResolver)
+		res, e := NewBlockingResolver(chi.NewRouter(), sutConfig, nil, nil, nil)
+		Expect(e).Should(Succeed())
+
+		sut = res.(*BlockingResolver)
 		sut.Next(m)
 	})
 
@@ -432,6 +442,308 @@ badcnamedomain.com`)
 		})
 	})
 
+	Describe("Blocking mode", func() {
+		var privateMock *privateDNSClientMock
+
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlackLists: map[string][]string{"defaultGroup": {defaultGroupFile.Name()}},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"defaultGroup"},
+				},
+			}
+			privateMock = &privateDNSClientMock{fn: func(string) (*dns.Msg, error) {
+				msg := new(dns.Msg)
+				msg.Rcode = dns.RcodeNameError
+
+				return msg, nil
+			}}
+		})
+		JustBeforeEach(func() {
+			sut.privateDNS.client = privateMock
+		})
+
+		When("mode is lists", func() {
+			BeforeEach(func() {
+				sutConfig.Mode = config.BlockingModeLists
+			})
+			It("should block domain from the black list without asking private DNS", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+				Expect(privateMock.calls).Should(BeEmpty())
+			})
+			It("should use the groups of the client's MAC from EDNS0 data", func() {
+				sut.cfg.ClientGroupsBlock = map[string][]string{
+					"aa:bb:cc:dd:ee:ff": {"defaultGroup"},
+				}
+				req := newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown")
+				req.ClientMAC, _ = net.ParseMAC("aa:bb:cc:dd:ee:ff")
+				resp, err = sut.Resolve(req)
+
+				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+			})
+			When("client is defined in client registry", func() {
+				JustBeforeEach(func() {
+					registry, e := clients.NewRegistry(map[string]config.ClientConfig{
+						"tablet": {
+							MAC:       []string{"aa:bb:cc:dd:ee:ff"},
+							Groups:    []string{"defaultGroup"},
+							BlockType: "NxDomain",
+						},
+						"laptop": {
+							IP: []net.IP{net.ParseIP("1.2.1.2")},
+						},
+					}, nil)
+					Expect(e).Should(Succeed())
+					sut.clients = registry
+				})
+				It("should use the groups and block type of the client", func() {
+					req := newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.3", "unknown")
+					req.ClientMAC, _ = net.ParseMAC("aa:bb:cc:dd:ee:ff")
+					resp, err = sut.Resolve(req)
+
+					Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+					expectedReturnCode = dns.RcodeNameError
+				})
+				It("should not use the default group for a client without groups", func() {
+					resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+					Expect(resp.RType).Should(Equal(RESOLVED))
+				})
+			})
+			It("should delegate other domains without asking private DNS", func() {
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(RESOLVED))
+				Expect(privateMock.calls).Should(BeEmpty())
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+
+		When("mode is private", func() {
+			It("should ignore the black list and use the verdict of private DNS", func() {
+				privateMock.fn = func(string) (*dns.Msg, error) {
+					return new(dns.Msg), nil
+				}
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(RESOLVED))
+				Expect(privateMock.calls).Should(HaveLen(1))
+			})
+		})
+
+		When("mode is both", func() {
+			BeforeEach(func() {
+				sutConfig.Mode = config.BlockingModeBoth
+			})
+			It("should block domain from the black list without asking private DNS", func() {
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+				Expect(privateMock.calls).Should(BeEmpty())
+			})
+			It("should ask private DNS for domains which are not on the black list", func() {
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.Reason).Should(Equal("BLOCKED PRIVATE (none)"))
+				Expect(privateMock.calls).Should(HaveLen(1))
+			})
+			It("should use cached verdict of private DNS for repeated queries", func() {
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+				Expect(resp.Reason).Should(Equal("BLOCKED PRIVATE (none)"))
+
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+				Expect(resp.Reason).Should(Equal("BLOCKED PRIVATE (none)"))
+				Expect(privateMock.calls).Should(HaveLen(1))
+
+				By("flushing the verdict cache", func() {
+					sut.apiVerdictCacheFlush(httptest.NewRecorder(), nil)
+
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+					Expect(privateMock.calls).Should(HaveLen(2))
+				})
+			})
+			It("should fall back to the black list if private DNS is unreachable", func() {
+				privateMock.fn = func(string) (*dns.Msg, error) {
+					return nil, errors.New("connection refused")
+				}
+				resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2", "unknown"))
+
+				Expect(resp.RType).Should(Equal(RESOLVED))
+				m.AssertExpectations(GinkgoT())
+			})
+		})
+	})
+
+	Describe("Groups with schedules", func() {
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlackLists: map[string][]string{
+					"gr1":          {group1File.Name()},
+					"defaultGroup": {defaultGroupFile.Name()},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"gr1", "defaultGroup"},
+				},
+				GroupSchedules: map[string][]string{
+					"gr1":          {"today"},
+					"defaultGroup": {"yesterday"},
+				},
+				Mode: config.BlockingModeLists,
+			}
+		})
+		JustBeforeEach(func() {
+			now := time.Now()
+			schedules, e := schedule.NewRegistry(map[string]config.ScheduleConfig{
+				"today":     {Days: []string{now.Weekday().String()}},
+				"yesterday": {Days: []string{now.AddDate(0, 0, -1).Weekday().String()}},
+			}, sutConfig.GroupSchedules, nil)
+			Expect(e).Should(Succeed())
+			sut.schedules = schedules
+		})
+		It("should block only with groups inside of their schedules", func() {
+			resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "unknown"))
+			Expect(resp.RType).Should(Equal(BLOCKED))
+			Expect(resp.Reason).Should(Equal("BLOCKED (gr1)"))
+
+			resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+			Expect(resp.RType).Should(Equal(RESOLVED))
+		})
+	})
+
+	Describe("Groups with budgets", func() {
+		var now time.Time
+
+		BeforeEach(func() {
+			sutConfig = config.BlockingConfig{
+				BlackLists: map[string][]string{
+					"gr1":          {group1File.Name()},
+					"defaultGroup": {defaultGroupFile.Name()},
+				},
+				ClientGroupsBlock: map[string][]string{
+					"default": {"gr1", "defaultGroup"},
+				},
+				Budgets: map[string]config.BudgetConfig{
+					"gr1": {Daily: 10 * time.Minute},
+				},
+				Mode: config.BlockingModeLists,
+			}
+		})
+		JustBeforeEach(func() {
+			now = time.Date(2021, 3, 1, 12, 0, 0, 0, time.Local)
+			sut.budgets.now = func() time.Time { return now }
+		})
+		It("should block the group after the budget is used up until the next reset", func() {
+			By("first activity window", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "kid"))
+				Expect(resp.RType).Should(Equal(RESOLVED))
+			})
+
+			By("query inside of the window counts only the extension", func() {
+				now = now.Add(2 * time.Minute)
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "kid"))
+				Expect(resp.RType).Should(Equal(RESOLVED))
+				Expect(sut.budgets.status("kid")[0].UsedSec).Should(BeNumerically("==", 7*60))
+			})
+
+			By("next window uses up the budget", func() {
+				now = now.Add(time.Hour)
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "kid"))
+				Expect(resp.RType).Should(Equal(RESOLVED))
+
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "kid"))
+				Expect(resp.RType).Should(Equal(BLOCKED))
+				Expect(resp.Reason).Should(Equal("BLOCKED BUDGET (gr1)"))
+			})
+
+			By("other clients and groups are not affected", func() {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.3", "other"))
+				Expect(resp.RType).Should(Equal(RESOLVED))
+
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "kid"))
+				Expect(resp.RType).Should(Equal(BLOCKED))
+				Expect(resp.Reason).Should(Equal("BLOCKED (defaultGroup)"))
+			})
+
+			By("budget is available again after the reset", func() {
+				now = now.Add(12 * time.Hour)
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "kid"))
+				Expect(resp.RType).Should(Equal(RESOLVED))
+			})
+		})
+		It("should return and reset the budgets via API", func() {
+			for i := 0; i < 2; i++ {
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "kid"))
+				now = now.Add(time.Hour)
+			}
+
+			Expect(resp.RType).Should(Equal(RESOLVED))
+
+			By("query the budgets", func() {
+				httpCode, body := DoGetRequest("/api/blocking/budgets?client=kid", sut.apiBudgets)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var result []api.BudgetStatus
+				Expect(json.NewDecoder(body).Decode(&result)).Should(Succeed())
+				Expect(result).Should(Equal([]api.BudgetStatus{{
+					Client: "kid", Group: "gr1", DailySec: 600, UsedSec: 600, RemainingSec: 0, ResetInSec: 10 * 60 * 60,
+				}}))
+			})
+
+			By("reset the budget", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/budgets/reset?group=unknown", sut.apiBudgetsReset)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+
+				httpCode, _ = DoGetRequest("/api/blocking/budgets/reset?client=kid&group=gr1", sut.apiBudgetsReset)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+				Expect(sut.budgets.status("kid")).Should(BeEmpty())
+
+				resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "kid"))
+				Expect(resp.RType).Should(Equal(RESOLVED))
+			})
+		})
+		It("should not change the usage, if the status is returned", func() {
+			resp, err = sut.Resolve(newRequestWithClient("domain1.com.", dns.TypeA, "1.2.1.2", "kid"))
+			Expect(resp.RType).Should(Equal(RESOLVED))
+
+			now = now.AddDate(0, 0, 1)
+			Expect(sut.budgets.status("kid")[0].UsedSec).Should(BeNumerically("==", 0))
+			Expect(sut.budgets.usage["kid"]["gr1"].Used).Should(Equal(5 * time.Minute))
+			Expect(sut.budgets.dirty).Should(BeTrue())
+		})
+		It("should save the usage on stop and continue it after reload", func() {
+			dir, e := ioutil.TempDir("", "budgets")
+			Expect(e).Should(Succeed())
+
+			defer os.RemoveAll(dir)
+
+			store := state.NewStore(filepath.Join(dir, "state.json"))
+			old := newBudgets(sutConfig.Budgets, store)
+			old.now = func() time.Time { return now }
+			old.record("kid", "gr1")
+
+			reloaded := newBudgets(sutConfig.Budgets, store)
+			reloaded.now = old.now
+			reloaded.takeOver(old)
+			old.stop()
+
+			var saved map[string]map[string]*budgetUsage
+			found, e := store.Load(budgetsStateSection, &saved)
+			Expect(e).Should(Succeed())
+			Expect(found).Should(BeFalse())
+
+			reloaded.stop()
+
+			found, e = store.Load(budgetsStateSection, &saved)
+			Expect(e).Should(Succeed())
+			Expect(found).Should(BeTrue())
+			Expect(saved["kid"]["gr1"].Used).Should(Equal(5 * time.Minute))
+
+			Expect(reloaded.stop).ShouldNot(Panic())
+		})
+	})
+
 	Describe("Control status via API", func() {
 		BeforeEach(func() {
 			sutConfig = config.BlockingConfig{
@@ -470,6 +782,94 @@ badcnamedomain.com`)
 			})
 		})
 
+		When("Disable blocking is called for a MAC or an IP in other notation", func() {
+			BeforeEach(func() {
+				sutConfig.Mode = config.BlockingModeLists
+			})
+			It("should pause blocking for the client with this MAC or IP", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/disable?client=AA-BB-CC-DD-EE-FF,2001:DB8:0:0::1",
+					sut.apiBlockingDisable)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				request := newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown")
+				request.ClientMAC, _ = net.ParseMAC("aa:bb:cc:dd:ee:ff")
+
+				resp, err = sut.Resolve(request)
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(RESOLVED))
+
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "2001:db8::1", "unknown"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(RESOLVED))
+
+				resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+				Expect(err).Should(Succeed())
+				Expect(resp.RType).Should(Equal(BLOCKED))
+			})
+		})
+
+		When("Disable blocking is called for groups, clients or categories", func() {
+			BeforeEach(func() {
+				sutConfig.Mode = config.BlockingModeLists
+				sutConfig.Global = map[string]bool{"adult": true}
+			})
+			It("should pause blocking only for them", func() {
+				By("pause blocking for client 1.2.1.2 and category adult", func() {
+					httpCode, _ := DoGetRequest("/api/blocking/disable?client=1.2.1.2&category=adult&duration=1h",
+						sut.apiBlockingDisable)
+					Expect(httpCode).Should(Equal(http.StatusOK))
+				})
+
+				By("query of paused client should not be blocked", func() {
+					resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.2", "unknown"))
+					Expect(resp.RType).Should(Equal(RESOLVED))
+					Expect(sut.activeCategories([]string{"adult"})).Should(BeEmpty())
+				})
+
+				By("query of other client should be blocked", func() {
+					resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.3", "unknown"))
+					Expect(resp.RType).Should(Equal(BLOCKED))
+				})
+
+				By("pause blocking for group defaultGroup", func() {
+					httpCode, _ := DoGetRequest("/api/blocking/disable?groups=defaultGroup", sut.apiBlockingDisable)
+					Expect(httpCode).Should(Equal(http.StatusOK))
+
+					resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.3", "unknown"))
+					Expect(resp.RType).Should(Equal(RESOLVED))
+				})
+
+				By("status should list all pauses", func() {
+					httpCode, body := DoGetRequest("/api/blocking/status", sut.apiBlockingStatus)
+					Expect(httpCode).Should(Equal(http.StatusOK))
+
+					var result api.BlockingStatus
+					Expect(json.NewDecoder(body).Decode(&result)).Should(Succeed())
+
+					Expect(result.Enabled).Should(BeTrue())
+					Expect(result.Pauses).Should(HaveLen(3))
+					Expect(result.Pauses[0].Type).Should(Equal("category"))
+					Expect(result.Pauses[0].AutoEnableInSec).Should(BeNumerically(">", 3500))
+					Expect(result.Pauses[1]).Should(Equal(api.BlockingPause{Type: "client", Name: "1.2.1.2",
+						AutoEnableInSec: result.Pauses[1].AutoEnableInSec}))
+					Expect(result.Pauses[2]).Should(Equal(api.BlockingPause{Type: "group", Name: "defaultGroup"}))
+				})
+
+				By("enable blocking for group defaultGroup again", func() {
+					httpCode, _ := DoGetRequest("/api/blocking/enable?groups=defaultGroup", sut.apiBlockingEnable)
+					Expect(httpCode).Should(Equal(http.StatusOK))
+
+					resp, err = sut.Resolve(newRequestWithClient("blocked3.com.", dns.TypeA, "1.2.1.3", "unknown"))
+					Expect(resp.RType).Should(Equal(BLOCKED))
+				})
+
+				By("unknown category should be rejected", func() {
+					httpCode, _ := DoGetRequest("/api/blocking/disable?category=gambling", sut.apiBlockingDisable)
+					Expect(httpCode).Should(Equal(http.StatusBadRequest))
+				})
+			})
+		})
+
 		When("Disable blocking is called with a wrong parameter", func() {
 			It("Should return http bad request as return code", func() {
 				httpCode, _ := DoGetRequest("/api/blocking/disable?duration=xyz", sut.apiBlockingDisable)
@@ -546,6 +946,27 @@ badcnamedomain.com`)
 				})
 			})
 		})
+
+		When("resolver is replaced on config reload", func() {
+			It("should keep disabled blocking and pauses", func() {
+				sut.status.disableBlocking(time.Hour)
+				sut.pauses.add(pauseScopeGroup, "defaultGroup", time.Hour)
+				sut.pauses.add(pauseScopeClient, "client1", 0)
+
+				res, e := NewBlockingResolver(chi.NewRouter(), sutConfig, nil, nil, nil)
+				Expect(e).Should(Succeed())
+
+				newSut := res.(*BlockingResolver)
+				defer newSut.Stop()
+
+				TransferState(sut, newSut)
+
+				Expect(newSut.status.enabled).Should(BeFalse())
+				Expect(newSut.status.disableEnd).Should(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+				Expect(newSut.pauses.isPaused(pauseScopeGroup, "defaultGroup")).Should(BeTrue())
+				Expect(newSut.pauses.isPaused(pauseScopeClient, "client1")).Should(BeTrue())
+			})
+		})
 	})
 
 	Describe("Configuration output", func() {
@@ -578,17 +999,13 @@ badcnamedomain.com`)
 
 	Describe("Create resolver with wrong parameter", func() {
 		When("Wrong blockType is used", func() {
-			var fatal bool
-			It("should end with fatal exit", func() {
-				defer func() { logrus.StandardLogger().ExitFunc = nil }()
-
-				logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
-
-				_ = NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
+			It("should return error", func() {
+				_, e := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{
 					BlockType: "wrong",
-				})
+				}, nil, nil, nil)
 
-				Expect(fatal).Should(BeTrue())
+				Expect(e).Should(HaveOccurred())
+				Expect(e.Error()).Should(ContainSubstring("unknown blockType 'wrong'"))
 			})
 		})
 	})
@@ -612,10 +1029,12 @@ badcnamedomain.com`)
 			"1.2.1.3": {"adult"},
 		},
 	}
-	sut := NewBlockingResolver(chi.NewRouter(), sutConfig).(*BlockingResolver)
 	m = &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(&Response{Res: mockAnswer}, nil)
-	sut = NewBlockingResolver(chi.NewRouter(), sutConfig).(*BlockingResolver)
+	res, err := NewBlockingResolver(chi.NewRouter(), sutConfig, nil, nil, nil)
+	assert.NoError(t, err)
+
+	sut := res.(*BlockingResolver)
 	sut.Next(m)
 
 	sut.cfg.Global = map[string]bool{"adblock": false, "adult": true, "malware": true}
@@ -0,0 +1,449 @@
+package resolver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/log"
+	"github.com/stgnet/blocky/state"
+)
+
+const (
+	// budgetsStateSection is the section of the state file with the usage of budgets
+	budgetsStateSection = "budgets"
+
+	defaultBudgetWindow = 5 * time.Minute
+	// budgetSaveInterval is the interval of the background writes of the usage to the state file
+	budgetSaveInterval = time.Minute
+)
+
+// budget is the daily limit of a black list group
+type budget struct {
+	daily  time.Duration
+	window time.Duration
+	// reset is the time of the daily reset in minutes after midnight
+	reset int
+}
+
+// budgetUsage is the estimated usage of a group by a client in the current period
+type budgetUsage struct {
+	Used time.Duration `json:"used"`
+	// WindowEnd is the end of the current activity window
+	WindowEnd time.Time `json:"windowEnd"`
+	// Period is the time of the last reset
+	Period time.Time `json:"period"`
+}
+
+// budgets contains the daily budgets per black list group and their usage per client. The usage is saved in the
+// background, queries don't wait for the state file
+type budgets struct {
+	lock    sync.Mutex
+	budgets map[string]budget
+	usage   map[string]map[string]*budgetUsage
+	store   *state.Store
+	dirty   bool
+	now     func() time.Time
+	// saveLock keeps the order of the writes of the state file
+	saveLock sync.Mutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func newBudgets(cfg map[string]config.BudgetConfig, store *state.Store) *budgets {
+	b := &budgets{
+		budgets: make(map[string]budget),
+		usage:   make(map[string]map[string]*budgetUsage),
+		store:   store,
+		now:     time.Now,
+		stopCh:  make(chan struct{}),
+	}
+
+	for group, c := range cfg {
+		window := c.Window
+		if window == 0 {
+			window = defaultBudgetWindow
+		}
+
+		var reset int
+		if c.Reset != "" {
+			reset, _ = config.ParseClock(c.Reset)
+		}
+
+		b.budgets[group] = budget{daily: c.Daily, window: window, reset: reset}
+	}
+
+	if len(b.budgets) == 0 {
+		return b
+	}
+
+	if _, err := store.Load(budgetsStateSection, &b.usage); err != nil {
+		log.Logger.Error("can't load budgets from state file: ", err)
+	}
+
+	if b.usage == nil {
+		b.usage = make(map[string]map[string]*budgetUsage)
+	}
+
+	go b.periodicSave()
+
+	return b
+}
+
+// periodicSave writes the changed usage to the state file until stop is called
+func (b *budgets) periodicSave() {
+	ticker := time.NewTicker(budgetSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.save()
+		case <-b.stopCh:
+			return
+		}
+	}
+}
+
+// withoutBudgetGroups returns the groups without groups with budget, they are handled by record
+func (b *budgets) withoutBudgetGroups(groups []string) []string {
+	if len(b.budgets) == 0 {
+		return groups
+	}
+
+	result := make([]string, 0, len(groups))
+
+	for _, g := range groups {
+		if _, found := b.budgets[g]; !found {
+			result = append(result, g)
+		}
+	}
+
+	return result
+}
+
+// budgetGroups returns the groups with budget
+func (b *budgets) budgetGroups(groups []string) (result []string) {
+	for _, g := range groups {
+		if _, found := b.budgets[g]; found {
+			result = append(result, g)
+		}
+	}
+
+	return
+}
+
+// periodStart returns the time of the last reset before t
+func (bg budget) periodStart(t time.Time) time.Time {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).
+		Add(time.Duration(bg.reset) * time.Minute)
+
+	if start.After(t) {
+		start = start.AddDate(0, 0, -1)
+	}
+
+	return start
+}
+
+// current returns the usage of the current period and creates it if necessary, must be called with lock
+func (b *budgets) current(client, group string, now time.Time) *budgetUsage {
+	period := b.budgets[group].periodStart(now)
+
+	byGroup, found := b.usage[client]
+	if !found {
+		byGroup = make(map[string]*budgetUsage)
+		b.usage[client] = byGroup
+	}
+
+	u, found := byGroup[group]
+	if !found || !u.Period.Equal(period) {
+		u = &budgetUsage{Period: period}
+		byGroup[group] = u
+	}
+
+	return u
+}
+
+// lookup returns the usage of the current period without changing the usage, must be called with lock
+func (b *budgets) lookup(client, group string, now time.Time) budgetUsage {
+	period := b.budgets[group].periodStart(now)
+
+	if u, found := b.usage[client][group]; found && u.Period.Equal(period) {
+		return *u
+	}
+
+	return budgetUsage{Period: period}
+}
+
+// record counts a query of the group's domains by the client. Returns false, if the budget is already used up.
+// The usage is the length of the union of all activity windows
+func (b *budgets) record(client, group string) (allowed bool, remaining time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	bg := b.budgets[group]
+	u := b.current(client, group, now)
+
+	if u.Used >= bg.daily {
+		return false, 0
+	}
+
+	end := now.Add(bg.window)
+
+	if now.After(u.WindowEnd) {
+		u.Used += bg.window
+	} else {
+		u.Used += end.Sub(u.WindowEnd)
+	}
+
+	u.WindowEnd = end
+	b.dirty = true
+
+	return true, bg.daily - u.Used
+}
+
+// save writes the usage to the state file, if it was changed since the last save. Must be called without lock
+func (b *budgets) save() {
+	b.saveLock.Lock()
+	defer b.saveLock.Unlock()
+
+	b.lock.Lock()
+	if !b.dirty {
+		b.lock.Unlock()
+
+		return
+	}
+
+	snapshot := make(map[string]map[string]budgetUsage, len(b.usage))
+
+	for c, byGroup := range b.usage {
+		snapshot[c] = make(map[string]budgetUsage, len(byGroup))
+		for g, u := range byGroup {
+			snapshot[c][g] = *u
+		}
+	}
+
+	b.dirty = false
+	b.lock.Unlock()
+
+	if err := b.store.Save(budgetsStateSection, snapshot); err != nil {
+		log.Logger.Error("can't save budgets to state file: ", err)
+	}
+}
+
+// takeOver continues the usage of old for all groups, which still have a budget
+func (b *budgets) takeOver(old *budgets) {
+	old.lock.Lock()
+	defer old.lock.Unlock()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for c, byGroup := range old.usage {
+		for g, u := range byGroup {
+			if _, found := b.budgets[g]; !found {
+				continue
+			}
+
+			if _, found := b.usage[c]; !found {
+				b.usage[c] = make(map[string]*budgetUsage)
+			}
+
+			copied := *u
+			b.usage[c][g] = &copied
+			b.dirty = true
+		}
+	}
+
+	// the usage is saved by the new budgets from now on
+	old.dirty = false
+}
+
+// reset removes the usage of the client (empty: all clients) for the group (empty: all groups) and saves the usage
+func (b *budgets) reset(client, group string) {
+	defer b.save()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for c, byGroup := range b.usage {
+		if client != "" && c != client {
+			continue
+		}
+
+		for g := range byGroup {
+			if group == "" || g == group {
+				delete(byGroup, g)
+			}
+		}
+
+		if len(byGroup) == 0 {
+			delete(b.usage, c)
+		}
+	}
+
+	b.dirty = true
+}
+
+// status returns the usage of all clients (or only of client, if not empty) sorted by client and group
+func (b *budgets) status(client string) []api.BudgetStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	result := make([]api.BudgetStatus, 0)
+
+	for c, byGroup := range b.usage {
+		if client != "" && c != client {
+			continue
+		}
+
+		for g := range byGroup {
+			bg, found := b.budgets[g]
+			if !found {
+				continue
+			}
+
+			u := b.lookup(c, g, now)
+			remaining := bg.daily - u.Used
+
+			if remaining < 0 {
+				remaining = 0
+			}
+
+			result = append(result, api.BudgetStatus{
+				Client:       c,
+				Group:        g,
+				DailySec:     uint(bg.daily.Seconds()),
+				UsedSec:      uint(u.Used.Seconds()),
+				RemainingSec: uint(remaining.Seconds()),
+				ResetInSec:   uint(u.Period.AddDate(0, 0, 1).Sub(now).Seconds()),
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Client != result[j].Client {
+			return result[i].Client < result[j].Client
+		}
+
+		return result[i].Group < result[j].Group
+	})
+
+	return result
+}
+
+// stop ends the background writes and saves the usage, if it was changed since the last save. It can be called
+// more than once
+func (b *budgets) stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+	})
+
+	b.save()
+}
+
+// budgetClient returns the key of the request's client for budgets, the first one of clientKeys
+func (r *BlockingResolver) budgetClient(request *Request) string {
+	if keys := clientKeys(r.clients, request); len(keys) > 0 {
+		return keys[0]
+	}
+
+	return ""
+}
+
+// checkBudgets records the usage for each budget group of the client, which contains the domain. Returns true
+// with the group, if the budget of the group is used up
+func (r *BlockingResolver) checkBudgets(request *Request, groupsToCheck []string,
+	domain string) (exhausted bool, group string) {
+	groups := r.budgets.budgetGroups(groupsToCheck)
+	if len(groups) == 0 {
+		return false, ""
+	}
+
+	client := r.budgetClient(request)
+
+	for _, g := range groups {
+		if found, _ := r.blacklistMatcher.Match(domain, []string{g}); !found {
+			continue
+		}
+
+		allowed, remaining := r.budgets.record(client, g)
+		request.trace("BlockingResolver", "domain counts against budget", map[string]interface{}{
+			"domain":    domain,
+			"client":    client,
+			"group":     g,
+			"allowed":   allowed,
+			"remaining": remaining.String(),
+		})
+
+		if !allowed {
+			return true, g
+		}
+	}
+
+	return false, ""
+}
+
+// Configuration returns the budgets per group
+func (b *budgets) Configuration() (result []string) {
+	for group, bg := range b.budgets {
+		result = append(result, fmt.Sprintf("%s = %s per day (window %s, reset %02d:%02d)", group, bg.daily,
+			bg.window, bg.reset/60, bg.reset%60))
+	}
+
+	sort.Strings(result)
+
+	if len(result) == 0 {
+		result = []string{"no budgets defined"}
+	}
+
+	return
+}
+
+// apiBudgets is the http endpoint to get the usage of the budgets
+// @Summary Budgets
+// @Description returns the daily budgets and their usage per client
+// @Tags blocking
+// @Produce  json
+// @Param client query string false "only the budgets of this client"
+// @Success 200 {array} api.BudgetStatus "budgets sorted by client and group"
+// @Router /blocking/budgets [get]
+func (r *BlockingResolver) apiBudgets(rw http.ResponseWriter, req *http.Request) {
+	response, _ := json.Marshal(r.budgets.status(normalizeClientKey(req.URL.Query().Get("client"))))
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if _, err := rw.Write(response); err != nil {
+		log.Logger.Error("unable to write response ", err)
+	}
+}
+
+// apiBudgetsReset is the http endpoint to reset the usage of budgets
+// @Summary Reset budgets
+// @Description resets the used time of the budgets. Without client and group all budgets are reset
+// @Tags blocking
+// @Param client query string false "only the budgets of this client"
+// @Param group query string false "only the budget of this group"
+// @Success 200   "Budgets are reset"
+// @Failure 400   "Unknown budget group"
+// @Router /blocking/budgets/reset [get]
+func (r *BlockingResolver) apiBudgetsReset(rw http.ResponseWriter, req *http.Request) {
+	client := normalizeClientKey(req.URL.Query().Get("client"))
+	group := req.URL.Query().Get("group")
+
+	if _, found := r.budgets.budgets[group]; group != "" && !found {
+		http.Error(rw, fmt.Sprintf("no budget for group '%s'", group), http.StatusBadRequest)
+
+		return
+	}
+
+	log.Logger.Infof("reset budgets (client '%s', group '%s')", client, group)
+	r.budgets.reset(client, group)
+}
@@ -75,6 +75,7 @@ func (r *CachingResolver) Resolve(request *Request) (response *Response, err err
 
 			if found {
 				logger.Debug("domain is cached")
+				request.trace("CachingResolver", "domain is cached", map[string]interface{}{"domain": domain})
 
 				// calculate remaining TTL
 				remainingTTL := uint32(time.Until(expiresAt).Seconds())
@@ -96,6 +97,7 @@ func (r *CachingResolver) Resolve(request *Request) (response *Response, err err
 			}
 
 			logger.WithField("next_resolver", Name(r.next)).Debug("not in cache: go to next resolver")
+			request.trace("CachingResolver", "domain is not cached", map[string]interface{}{"domain": domain})
 			response, err = r.next.Resolve(request)
 
 			if err == nil {
@@ -65,6 +65,10 @@ func (r *ClientNamesResolver) Resolve(request *Request) (*Response, error) {
 
 	request.ClientNames = clientNames
 	request.Log = request.Log.WithField("client_names", strings.Join(clientNames, "; "))
+	request.trace("ClientNamesResolver", "determined client names", map[string]interface{}{
+		"clientIP":    request.ClientIP.String(),
+		"clientNames": clientNames,
+	})
 
 	return r.next.Resolve(request)
 }
@@ -80,14 +84,16 @@ func (r *ClientNamesResolver) getClientNames(request *Request) []string {
 		}
 	}
 
-	names := r.resolveClientNames(ip, withPrefix(request.Log, "client_names_resolver"))
+	names := r.resolveClientNames(request, withPrefix(request.Log, "client_names_resolver"))
 	r.cache.Set(ip.String(), names, cache.DefaultExpiration)
 
 	return names
 }
 
 // tries to resolve client name from mapping, performs reverse DNS lookup otherwise
-func (r *ClientNamesResolver) resolveClientNames(ip net.IP, logger *logrus.Entry) (result []string) {
+func (r *ClientNamesResolver) resolveClientNames(request *Request, logger *logrus.Entry) (result []string) {
+	ip := request.ClientIP
+
 	// try client mapping first
 	result = r.getNameFromIPMapping(ip, result)
 
@@ -106,6 +112,7 @@ func (r *ClientNamesResolver) resolveClientNames(ip net.IP, logger *logrus.Entry
 		resp, err := r.externalResolver.Resolve(&Request{
 			Req: util.NewMsgWithQuestion(reverse, dns.TypePTR),
 			Log: logger,
+			Ctx: request.Ctx,
 		})
 
 		if err != nil {
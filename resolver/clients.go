@@ -0,0 +1,71 @@
+package resolver
+
+import (
+	"net"
+
+	"github.com/stgnet/blocky/clients"
+)
+
+// clientIdentity collects the identifiers of the request's client for the lookup in the client registry
+func clientIdentity(request *Request) clients.Identity {
+	return clients.Identity{
+		IP:    request.ClientIP,
+		Names: request.ClientNames,
+		MAC:   request.ClientMAC,
+		CPEID: request.ClientCPEID,
+	}
+}
+
+// lookupClient returns the registry entry of the request's client, nil if the client is unknown
+func lookupClient(resolverName string, registry *clients.Registry, request *Request) *clients.Client {
+	client, selector := registry.Lookup(clientIdentity(request))
+	if client != nil {
+		request.trace(resolverName, "found client in registry", map[string]interface{}{
+			"client":   client.Name,
+			"selector": string(selector),
+			"groups":   client.Groups,
+			"tags":     client.Tags,
+		})
+	}
+
+	return client
+}
+
+// clientKeys returns the keys of the request's client in the order: name from client registry, MAC, client names and
+// IP. Pauses, grants and budgets of a client are stored with one of them (see normalizeClientKey)
+func clientKeys(registry *clients.Registry, request *Request) []string {
+	keys := make([]string, 0, len(request.ClientNames)+3)
+	if client, _ := registry.Lookup(clientIdentity(request)); client != nil {
+		keys = append(keys, client.Name)
+	}
+
+	if request.ClientMAC != nil {
+		keys = append(keys, request.ClientMAC.String())
+	}
+
+	for _, name := range request.ClientNames {
+		if name != "" {
+			keys = append(keys, name)
+		}
+	}
+
+	if request.ClientIP != nil {
+		keys = append(keys, request.ClientIP.String())
+	}
+
+	return keys
+}
+
+// normalizeClientKey returns MAC and IP addresses of a client given via API in their canonical form, other names
+// unchanged
+func normalizeClientKey(client string) string {
+	if mac, err := net.ParseMAC(client); err == nil {
+		return mac.String()
+	}
+
+	if ip := net.ParseIP(client); ip != nil {
+		return ip.String()
+	}
+
+	return client
+}
@@ -7,18 +7,22 @@ import (
 
 	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
+	"github.com/stgnet/blocky/clients"
 	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/schedule"
 	"github.com/stgnet/blocky/util"
 )
 
 type CnameResolver struct {
 	NextResolver
-	cfg config.CnameConfig
+	cfg       config.CnameConfig
+	clients   *clients.Registry
+	schedules *schedule.Registry
 }
 
 // NewCnameResolver resturns a new restriction resolver
-func NewCnameResolver(cfg config.CnameConfig) ChainedResolver {
-	return &CnameResolver{cfg: cfg}
+func NewCnameResolver(cfg config.CnameConfig, registry *clients.Registry, schedules *schedule.Registry) ChainedResolver {
+	return &CnameResolver{cfg: cfg, clients: registry, schedules: schedules}
 }
 
 // Configuration returns the string representation of the configuration
@@ -45,6 +49,16 @@ func (cr *CnameResolver) Resolve(req *Request) (*Response, error) {
 	for _, question := range req.Req.Question {
 		domain := util.ExtractDomain(question)
 		groups := cr.groupsToCheckForClient(req)
+		req.trace("CnameResolver", "determined groups to check", map[string]interface{}{"groups": groups})
+
+		if scheduled := cr.schedules.CnameGroups(groups); len(scheduled) != len(groups) {
+			req.trace("CnameResolver", "groups are outside of their schedules", map[string]interface{}{
+				"groups": groups,
+				"active": scheduled,
+			})
+			groups = scheduled
+		}
+
 		if len(groups) <= 0 {
 			continue
 		}
@@ -53,6 +67,12 @@ func (cr *CnameResolver) Resolve(req *Request) (*Response, error) {
 			for _, g := range groups {
 				for _, d := range cr.cfg.Groups[g].Domains {
 					if d == domain {
+						req.trace("CnameResolver", "domain is restricted", map[string]interface{}{
+							"domain": domain,
+							"group":  g,
+							"cname":  cr.cfg.Groups[g].Cname,
+						})
+
 						response := new(dns.Msg)
 						response.SetReply(req.Req)
 
@@ -71,9 +91,9 @@ func (cr *CnameResolver) Resolve(req *Request) (*Response, error) {
 						rr2.SetQuestion(rr.Target, dns.TypeA)
 						rr2.RecursionDesired = true
 						c := new(dns.Client)
-						resp2, _, err := c.Exchange(rr2, "8.8.8.8:53")
+						resp2, _, err := c.ExchangeContext(req.Context(), rr2, "8.8.8.8:53")
 						if err != nil {
-							return nil, err
+							return nil, wrapCtxErr(req.Context(), err)
 						}
 
 						response.Answer = append(response.Answer, resp2.Answer...)
@@ -92,7 +112,20 @@ func (cr *CnameResolver) Resolve(req *Request) (*Response, error) {
 	return cr.next.Resolve(req)
 }
 
+// returns cname groups of the client. A client from the registry has precedence over the entries of clientGroupsBlock
 func (cr *CnameResolver) groupsToCheckForClient(request *Request) (groups []string) {
+	if client := lookupClient("CnameResolver", cr.clients, request); client != nil {
+		for _, g := range client.Groups {
+			if _, found := cr.cfg.Groups[g]; found {
+				groups = append(groups, g)
+			}
+		}
+
+		sort.Strings(groups)
+
+		return
+	}
+
 	// try client names
 	getEdnsData(request, cr.cfg.ClientGroupsBlock, &groups)
 
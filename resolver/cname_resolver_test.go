@@ -1,11 +1,16 @@
 package resolver
 
 import (
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/miekg/dns"
+	"github.com/stgnet/blocky/clients"
 	"github.com/stgnet/blocky/config"
 	. "github.com/stgnet/blocky/helpertest"
+	"github.com/stgnet/blocky/schedule"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -28,7 +33,7 @@ func TestCnameResolver_Resolve(t *testing.T) {
 		ClientGroupsBlock: map[string][]string{
 			"1.2.1.2": {"youtube"},
 		},
-	})
+	}, nil, nil)
 	m = &resolverMock{}
 	m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
 	sut.Next(m)
@@ -64,3 +69,59 @@ func TestCnameResolver_Resolve(t *testing.T) {
 	// was delegated to the next resolver
 
 }
+
+func TestCnameResolver_groupsToCheckForClient(t *testing.T) {
+	registry, err := clients.NewRegistry(map[string]config.ClientConfig{
+		"tablet": {
+			MAC:    []string{"aa:bb:cc:dd:ee:ff"},
+			Groups: []string{"kids", "music"},
+		},
+	}, nil)
+	assert.Nil(t, err)
+
+	cr := NewCnameResolver(config.CnameConfig{
+		Groups: map[string]config.Groups{
+			"youtube": {Domains: []string{"youtube.com"}, Cname: "restrict.youtube.com."},
+			"music":   {Domains: []string{"music.youtube.com"}, Cname: "restrict.youtube.com."},
+		},
+		ClientGroupsBlock: map[string][]string{
+			"default": {"youtube"},
+		},
+	}, registry, nil).(*CnameResolver)
+
+	// client from registry: only cname groups are used
+	req := newRequestWithClient("youtube.com.", dns.TypeA, "1.2.1.2")
+	req.ClientMAC, _ = net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	assert.Equal(t, []string{"music"}, cr.groupsToCheckForClient(req))
+
+	// unknown client: default of clientGroupsBlock
+	assert.Equal(t, []string{"youtube"}, cr.groupsToCheckForClient(newRequestWithClient("youtube.com.", dns.TypeA, "1.2.1.3")))
+}
+
+func TestCnameResolver_Schedules(t *testing.T) {
+	yesterday := strings.ToLower(time.Now().AddDate(0, 0, -1).Weekday().String())
+	cfg := config.CnameConfig{
+		Groups: map[string]config.Groups{
+			"youtube": {Domains: []string{"youtube.com"}, Cname: "restrict.youtube.com.", Schedules: []string{"past"}},
+		},
+		ClientGroupsBlock: map[string][]string{
+			"default": {"youtube"},
+		},
+	}
+
+	schedules, err := schedule.NewRegistry(map[string]config.ScheduleConfig{
+		"past": {Days: []string{yesterday}},
+	}, nil, cfg.Groups)
+	assert.Nil(t, err)
+
+	cr := NewCnameResolver(cfg, nil, schedules)
+	mockResolver := &resolverMock{}
+	mockResolver.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+	cr.Next(mockResolver)
+
+	// group is outside of its schedule: query is delegated to the next resolver
+	resp, err := cr.Resolve(newRequestWithClient("youtube.com.", dns.TypeA, "1.2.1.2"))
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Res.Answer)
+	mockResolver.AssertNumberOfCalls(t, "Resolve", 1)
+}
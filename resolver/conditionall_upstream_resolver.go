@@ -48,6 +48,11 @@ func (r *ConditionalUpstreamResolver) Resolve(request *Request) (*Response, erro
 			for len(domain) > 0 {
 				r, found := r.mapping[domain]
 				if found {
+					request.trace("ConditionalUpstreamResolver", "found conditional mapping", map[string]interface{}{
+						"domain":   domain,
+						"upstream": fmt.Sprint(r),
+					})
+
 					response, err := r.Resolve(request)
 					if err == nil {
 						response.Reason = "CONDITIONAL"
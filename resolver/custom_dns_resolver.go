@@ -55,6 +55,11 @@ func (r *CustomDNSResolver) Resolve(request *Request) (*Response, error) {
 			for len(domain) > 0 {
 				ip, found := r.mapping[domain]
 				if found {
+					request.trace("CustomDNSResolver", "found custom DNS mapping", map[string]interface{}{
+						"domain": domain,
+						"ip":     ip.String(),
+					})
+
 					response := new(dns.Msg)
 					response.SetReply(request.Req)
 
@@ -0,0 +1,166 @@
+package resolver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/stgnet/blocky/config"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// dnsmasq --add-mac
+	defaultMACOptionCode = 65001
+	// dnsmasq --add-cpe-id
+	defaultCPEIDOptionCode = 65074
+
+	macLength = 6
+)
+
+// EdnsClientIDResolver extracts the client identifiers (MAC, CPE ID, client subnet) from the EDNS0 options. The client
+// subnet is used as client IP only if enabled and its prefix covers a single host, otherwise it's only logged
+type EdnsClientIDResolver struct {
+	NextResolver
+	macOptionCodes   map[uint16]bool
+	cpeIDOptionCodes map[uint16]bool
+	useClientSubnet  bool
+}
+
+func NewEdnsClientIDResolver(cfg config.EdnsClientIDConfig) ChainedResolver {
+	macOptionCodes := cfg.MACOptionCodes
+	if len(macOptionCodes) == 0 {
+		macOptionCodes = []uint16{defaultMACOptionCode}
+	}
+
+	cpeIDOptionCodes := cfg.CPEIDOptionCodes
+	if len(cpeIDOptionCodes) == 0 {
+		cpeIDOptionCodes = []uint16{defaultCPEIDOptionCode}
+	}
+
+	return &EdnsClientIDResolver{
+		macOptionCodes:   toCodeSet(macOptionCodes),
+		cpeIDOptionCodes: toCodeSet(cpeIDOptionCodes),
+		useClientSubnet:  cfg.UseClientSubnet,
+	}
+}
+
+func toCodeSet(codes []uint16) map[uint16]bool {
+	result := make(map[uint16]bool, len(codes))
+	for _, c := range codes {
+		result[c] = true
+	}
+
+	return result
+}
+
+func (r *EdnsClientIDResolver) Configuration() (result []string) {
+	result = append(result, fmt.Sprintf("macOptionCodes = %v", sortedCodes(r.macOptionCodes)))
+	result = append(result, fmt.Sprintf("cpeIdOptionCodes = %v", sortedCodes(r.cpeIDOptionCodes)))
+	result = append(result, fmt.Sprintf("useClientSubnet = %t", r.useClientSubnet))
+
+	return
+}
+
+func sortedCodes(codes map[uint16]bool) (result []int) {
+	for c := range codes {
+		result = append(result, int(c))
+	}
+
+	sort.Ints(result)
+
+	return
+}
+
+func (r *EdnsClientIDResolver) Resolve(request *Request) (*Response, error) {
+	r.extractClientID(request)
+
+	if request.ClientMAC != nil || request.ClientCPEID != "" || request.ClientSubnet != nil {
+		fields := logrus.Fields{}
+		details := make(map[string]interface{})
+
+		if request.ClientMAC != nil {
+			fields["client_mac"] = request.ClientMAC.String()
+			details["mac"] = request.ClientMAC.String()
+		}
+
+		if request.ClientCPEID != "" {
+			fields["client_cpe_id"] = request.ClientCPEID
+			details["cpeId"] = request.ClientCPEID
+		}
+
+		if request.ClientSubnet != nil {
+			fields["client_subnet"] = request.ClientSubnet.String()
+			details["subnet"] = request.ClientSubnet.String()
+		}
+
+		request.Log = request.Log.WithFields(fields)
+		request.trace("EdnsClientIDResolver", "found client identifiers in EDNS0 data", details)
+	}
+
+	return r.next.Resolve(request)
+}
+
+// extractClientID scans all EDNS0 options and fills the client identifiers of the request
+func (r *EdnsClientIDResolver) extractClientID(request *Request) {
+	opt := request.Req.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	logger := withPrefix(request.Log, "edns_client_id_resolver")
+
+	for _, o := range opt.Option {
+		switch v := o.(type) {
+		case *dns.EDNS0_LOCAL:
+			switch {
+			case r.macOptionCodes[v.Code]:
+				if mac := parseMAC(v.Data); mac != nil {
+					request.ClientMAC = mac
+				} else {
+					logger.Debugf("can't parse MAC from EDNS0 option %d", v.Code)
+				}
+			case r.cpeIDOptionCodes[v.Code]:
+				request.ClientCPEID = string(v.Data)
+			}
+		case *dns.EDNS0_SUBNET:
+			bits := 32
+			if v.Family == 2 {
+				bits = 128
+			}
+
+			request.ClientSubnet = &net.IPNet{
+				IP:   v.Address,
+				Mask: net.CIDRMask(int(v.SourceNetmask), bits),
+			}
+
+			// only a single host identifies the client, a shorter prefix covers other clients too
+			if r.useClientSubnet && int(v.SourceNetmask) == bits {
+				request.ClientIP = v.Address
+			}
+		}
+	}
+}
+
+// parseMAC supports the raw (6 bytes), text and base64 format of dnsmasq's --add-mac
+func parseMAC(data []byte) net.HardwareAddr {
+	if len(data) == macLength {
+		mac := make(net.HardwareAddr, len(data))
+		copy(mac, data)
+
+		return mac
+	}
+
+	if mac, err := net.ParseMAC(string(data)); err == nil {
+		return mac
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(string(data)); err == nil && len(decoded) == macLength {
+		return decoded
+	}
+
+	return nil
+}
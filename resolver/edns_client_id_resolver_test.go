@@ -0,0 +1,157 @@
+package resolver
+
+import (
+	"net"
+
+	"github.com/stgnet/blocky/config"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("EdnsClientIDResolver", func() {
+	var (
+		sut     ChainedResolver
+		sutCfg  config.EdnsClientIDConfig
+		m       *resolverMock
+		request *Request
+	)
+
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+
+	withOptions := func(options ...dns.EDNS0) *Request {
+		req := newRequestWithClient("example.com.", dns.TypeA, "127.0.0.1")
+		req.Req.SetEdns0(4096, false)
+		opt := req.Req.IsEdns0()
+		opt.Option = append(opt.Option, options...)
+
+		return req
+	}
+
+	BeforeEach(func() {
+		sutCfg = config.EdnsClientIDConfig{}
+	})
+
+	JustBeforeEach(func() {
+		sut = NewEdnsClientIDResolver(sutCfg)
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
+		sut.Next(m)
+	})
+
+	resolve := func(req *Request) {
+		request = req
+		_, err := sut.Resolve(request)
+		Expect(err).Should(Succeed())
+		m.AssertExpectations(GinkgoT())
+	}
+
+	When("request has no EDNS0 data", func() {
+		It("should not set client identifiers", func() {
+			resolve(newRequestWithClient("example.com.", dns.TypeA, "127.0.0.1"))
+
+			Expect(request.ClientMAC).Should(BeNil())
+			Expect(request.ClientCPEID).Should(BeEmpty())
+			Expect(request.ClientSubnet).Should(BeNil())
+		})
+	})
+
+	When("request contains client subnet, cookie and MAC", func() {
+		It("should extract MAC and subnet regardless of the option order", func() {
+			resolve(withOptions(
+				&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.168.178.0").To4()},
+				&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "24a5ac1223fd3e3f"},
+				&dns.EDNS0_LOCAL{Code: 65001, Data: mac},
+			))
+
+			Expect(request.ClientMAC).Should(Equal(mac))
+			Expect(request.ClientSubnet.String()).Should(Equal("192.168.178.0/24"))
+		})
+	})
+
+	When("MAC is sent in text format", func() {
+		It("should parse the MAC", func() {
+			resolve(withOptions(&dns.EDNS0_LOCAL{Code: 65001, Data: []byte("aa:bb:cc:dd:ee:ff")}))
+
+			Expect(request.ClientMAC).Should(Equal(mac))
+		})
+	})
+
+	When("MAC is sent in base64 format", func() {
+		It("should parse the MAC", func() {
+			resolve(withOptions(&dns.EDNS0_LOCAL{Code: 65001, Data: []byte("qrvM3e7/")}))
+
+			Expect(request.ClientMAC).Should(Equal(mac))
+		})
+	})
+
+	When("request contains CPE ID", func() {
+		It("should extract the CPE ID", func() {
+			resolve(withOptions(&dns.EDNS0_LOCAL{Code: 65074, Data: []byte("cpe-1234")}))
+
+			Expect(request.ClientCPEID).Should(Equal("cpe-1234"))
+			Expect(request.ClientMAC).Should(BeNil())
+		})
+	})
+
+	When("client subnet is used to identify the client", func() {
+		BeforeEach(func() {
+			sutCfg = config.EdnsClientIDConfig{UseClientSubnet: true}
+		})
+		It("should use the address of a single host as client IP", func() {
+			resolve(withOptions(
+				&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 32, Address: net.ParseIP("192.168.178.25").To4()},
+			))
+
+			Expect(request.ClientIP).Should(Equal(net.ParseIP("192.168.178.25").To4()))
+		})
+		It("should keep the client IP for a subnet", func() {
+			resolve(withOptions(
+				&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.168.178.0").To4()},
+			))
+
+			Expect(request.ClientIP.String()).Should(Equal("127.0.0.1"))
+			Expect(request.ClientSubnet.String()).Should(Equal("192.168.178.0/24"))
+		})
+	})
+
+	When("client subnet is not used to identify the client", func() {
+		It("should only extract the subnet", func() {
+			resolve(withOptions(
+				&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 32, Address: net.ParseIP("192.168.178.25").To4()},
+			))
+
+			Expect(request.ClientIP.String()).Should(Equal("127.0.0.1"))
+			Expect(request.ClientSubnet.String()).Should(Equal("192.168.178.25/32"))
+		})
+	})
+
+	When("custom option codes are configured", func() {
+		BeforeEach(func() {
+			sutCfg = config.EdnsClientIDConfig{
+				MACOptionCodes:   []uint16{65100},
+				CPEIDOptionCodes: []uint16{65101},
+			}
+		})
+		It("should use only the configured option codes", func() {
+			resolve(withOptions(
+				&dns.EDNS0_LOCAL{Code: 65001, Data: []byte{1, 2, 3, 4, 5, 6}},
+				&dns.EDNS0_LOCAL{Code: 65100, Data: mac},
+				&dns.EDNS0_LOCAL{Code: 65101, Data: []byte("cpe-1234")},
+			))
+
+			Expect(request.ClientMAC).Should(Equal(mac))
+			Expect(request.ClientCPEID).Should(Equal("cpe-1234"))
+		})
+	})
+
+	When("MAC option contains invalid data", func() {
+		It("should ignore the option", func() {
+			resolve(withOptions(&dns.EDNS0_LOCAL{Code: 65001, Data: []byte{1, 2}}))
+
+			Expect(request.ClientMAC).Should(BeNil())
+		})
+	})
+})
@@ -0,0 +1,279 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/log"
+	"github.com/stgnet/blocky/metrics"
+	"github.com/stgnet/blocky/state"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// globalCategoriesStateSection is the section of the state file with runtime changes of global categories
+const globalCategoriesStateSection = "globalCategories"
+
+// errUnknownCategory is returned, if a category should be switched, which is not defined
+var errUnknownCategory = errors.New("unknown category")
+
+// globalOverride is a runtime change of a global category. A zero Until means, the change has no end
+type globalOverride struct {
+	Enabled bool      `json:"enabled"`
+	Until   time.Time `json:"until,omitempty"`
+}
+
+// globalCategories contains the "global" switches of the configuration with runtime changes via API on top
+type globalCategories struct {
+	lock       sync.RWMutex
+	configured map[string]bool
+	categories []string
+	overrides  map[string]globalOverride
+	timers     map[string]*time.Timer
+	store      *state.Store
+	gauge      *prometheus.GaugeVec
+}
+
+func newGlobalCategories(configured map[string]bool, categories []string, store *state.Store) *globalCategories {
+	g := &globalCategories{
+		configured: configured,
+		categories: categories,
+		overrides:  make(map[string]globalOverride),
+		timers:     make(map[string]*time.Timer),
+		store:      store,
+	}
+
+	if metrics.IsEnabled() {
+		g.gauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "blocky_global_category_enabled",
+			Help: "Global status of the private DNS category",
+		}, []string{"category"})
+
+		g.gauge = metrics.ReplaceMetric(g.gauge).(*prometheus.GaugeVec)
+	}
+
+	var saved map[string]globalOverride
+	if _, err := store.Load(globalCategoriesStateSection, &saved); err != nil {
+		log.Logger.Error("can't load global categories from state file: ", err)
+	}
+
+	g.lock.Lock()
+	for name, o := range saved {
+		if !g.isCategory(name) || (!o.Until.IsZero() && !o.Until.After(time.Now())) {
+			continue
+		}
+
+		g.overrides[name] = o
+		g.scheduleReset(name, o.Until)
+	}
+	g.lock.Unlock()
+
+	for _, name := range categories {
+		g.updateGauge(name)
+	}
+
+	return g
+}
+
+func (g *globalCategories) isCategory(name string) bool {
+	for _, c := range g.categories {
+		if c == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup returns the current value of the switch and false, if it is neither configured nor changed at runtime
+func (g *globalCategories) lookup(name string) (enabled bool, ok bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	if o, found := g.overrides[name]; found {
+		return o.Enabled, true
+	}
+
+	enabled, ok = g.configured[name]
+
+	return
+}
+
+func (g *globalCategories) enabled(name string) bool {
+	enabled, _ := g.lookup(name)
+
+	return enabled
+}
+
+// set switches the category on or off. After duration (if > 0) the configured value is restored
+func (g *globalCategories) set(name string, enabled bool, duration time.Duration) error {
+	if !g.isCategory(name) {
+		return fmt.Errorf("%w '%s', please use one of %v", errUnknownCategory, name, g.categories)
+	}
+
+	o := globalOverride{Enabled: enabled}
+	if duration > 0 {
+		o.Until = time.Now().Add(duration)
+	}
+
+	g.lock.Lock()
+
+	// the change is applied only if it was saved
+	overrides := make(map[string]globalOverride, len(g.overrides)+1)
+	for n, existing := range g.overrides {
+		overrides[n] = existing
+	}
+
+	overrides[name] = o
+
+	if err := g.store.Save(globalCategoriesStateSection, overrides); err != nil {
+		g.lock.Unlock()
+
+		return err
+	}
+
+	g.overrides = overrides
+	g.scheduleReset(name, o.Until)
+	g.lock.Unlock()
+
+	g.updateGauge(name)
+
+	return nil
+}
+
+// takeOver continues the overrides of the global categories, which are replaced on config reload. Overrides of
+// categories, which are not defined anymore, are dropped
+func (g *globalCategories) takeOver(old *globalCategories) {
+	old.lock.RLock()
+	defer old.lock.RUnlock()
+
+	g.lock.Lock()
+	for name, o := range old.overrides {
+		if !g.isCategory(name) || (!o.Until.IsZero() && !o.Until.After(time.Now())) {
+			continue
+		}
+
+		g.overrides[name] = o
+		g.scheduleReset(name, o.Until)
+	}
+	g.lock.Unlock()
+
+	for _, name := range g.categories {
+		g.updateGauge(name)
+	}
+}
+
+// scheduleReset must be called with write lock. The reset is skipped, if the override was replaced in the meantime
+func (g *globalCategories) scheduleReset(name string, until time.Time) {
+	if t, found := g.timers[name]; found {
+		t.Stop()
+		delete(g.timers, name)
+	}
+
+	if until.IsZero() {
+		return
+	}
+
+	var timer *time.Timer
+
+	timer = time.AfterFunc(time.Until(until), func() {
+		g.lock.Lock()
+		if g.timers[name] != timer {
+			// the override was replaced after the timer fired
+			g.lock.Unlock()
+
+			return
+		}
+
+		delete(g.overrides, name)
+		delete(g.timers, name)
+		err := g.save()
+		g.lock.Unlock()
+
+		if err != nil {
+			log.Logger.Error("can't save global categories to state file: ", err)
+		}
+
+		g.updateGauge(name)
+		log.Logger.Infof("global category '%s' reset to configured value", name)
+	})
+
+	g.timers[name] = timer
+}
+
+// save must be called with lock
+func (g *globalCategories) save() error {
+	return g.store.Save(globalCategoriesStateSection, g.overrides)
+}
+
+func (g *globalCategories) updateGauge(name string) {
+	if g.gauge == nil {
+		return
+	}
+
+	value := 0.0
+	if g.enabled(name) {
+		value = 1
+	}
+
+	g.gauge.WithLabelValues(name).Set(value)
+}
+
+// snapshot returns the current value of all switches
+func (g *globalCategories) snapshot() map[string]bool {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	result := make(map[string]bool, len(g.configured)+len(g.overrides))
+	for name, enabled := range g.configured {
+		result[name] = enabled
+	}
+
+	for name, o := range g.overrides {
+		result[name] = o.Enabled
+	}
+
+	return result
+}
+
+// status returns the state of all categories for the API
+func (g *globalCategories) status() []api.GlobalCategoryStatus {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	result := make([]api.GlobalCategoryStatus, 0, len(g.categories))
+
+	for _, name := range g.categories {
+		s := api.GlobalCategoryStatus{Category: name, Enabled: g.configured[name]}
+
+		if o, found := g.overrides[name]; found {
+			s.Enabled = o.Enabled
+			s.Runtime = true
+
+			if !o.Until.IsZero() {
+				s.AutoResetInSec = uint(time.Until(o.Until).Seconds())
+			}
+		}
+
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Category < result[j].Category
+	})
+
+	return result
+}
+
+func (g *globalCategories) stop() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for _, t := range g.timers {
+		t.Stop()
+	}
+}
@@ -0,0 +1,184 @@
+package resolver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+	. "github.com/stgnet/blocky/helpertest"
+	"github.com/stgnet/blocky/state"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GlobalCategories", func() {
+	var (
+		dir   string
+		store *state.Store
+		sut   *globalCategories
+	)
+
+	configured := map[string]bool{"adblock": true, "adult": false}
+	categories := []string{"adblock", "malware", "adult"}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "globals")
+		Expect(err).Should(Succeed())
+
+		store = state.NewStore(filepath.Join(dir, "state.json"))
+		sut = newGlobalCategories(configured, categories, store)
+	})
+
+	AfterEach(func() {
+		sut.stop()
+		_ = os.RemoveAll(dir)
+	})
+
+	It("should use the configured values", func() {
+		Expect(sut.enabled("adblock")).Should(BeTrue())
+		Expect(sut.enabled("adult")).Should(BeFalse())
+
+		_, ok := sut.lookup("malware")
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("should apply changes immediately and keep them after restart", func() {
+		Expect(sut.set("adult", true, 0)).Should(Succeed())
+		Expect(sut.set("adblock", false, 0)).Should(Succeed())
+		Expect(sut.enabled("adult")).Should(BeTrue())
+		Expect(sut.enabled("adblock")).Should(BeFalse())
+
+		restarted := newGlobalCategories(configured, categories, store)
+		defer restarted.stop()
+
+		Expect(restarted.enabled("adult")).Should(BeTrue())
+		Expect(restarted.enabled("adblock")).Should(BeFalse())
+		Expect(restarted.status()).Should(ContainElement(api.GlobalCategoryStatus{
+			Category: "adult", Enabled: true, Runtime: true,
+		}))
+	})
+
+	It("should restore the configured value after the duration", func() {
+		Expect(sut.set("adblock", false, 100*time.Millisecond)).Should(Succeed())
+		Expect(sut.enabled("adblock")).Should(BeFalse())
+
+		Eventually(func() bool {
+			return sut.enabled("adblock")
+		}, "1s").Should(BeTrue())
+
+		restarted := newGlobalCategories(configured, categories, store)
+		defer restarted.stop()
+
+		Expect(restarted.enabled("adblock")).Should(BeTrue())
+	})
+
+	It("should keep a change, which replaced an override while its timer fired", func() {
+		Expect(sut.set("adblock", false, 10*time.Millisecond)).Should(Succeed())
+
+		// the timer fires and waits for the lock, while the override is replaced
+		sut.lock.Lock()
+		time.Sleep(50 * time.Millisecond)
+		sut.overrides["adblock"] = globalOverride{Enabled: false}
+		sut.scheduleReset("adblock", time.Time{})
+		sut.lock.Unlock()
+
+		Consistently(func() bool {
+			return sut.enabled("adblock")
+		}, "100ms").Should(BeFalse())
+	})
+
+	It("should ignore expired changes from the state file", func() {
+		Expect(store.Save(globalCategoriesStateSection, map[string]globalOverride{
+			"adblock": {Enabled: false, Until: time.Now().Add(-time.Minute)},
+			"adult":   {Enabled: true, Until: time.Now().Add(time.Hour)},
+		})).Should(Succeed())
+
+		restarted := newGlobalCategories(configured, categories, store)
+		defer restarted.stop()
+
+		Expect(restarted.enabled("adblock")).Should(BeTrue())
+		Expect(restarted.enabled("adult")).Should(BeTrue())
+	})
+
+	It("should keep the changes on reload without state file", func() {
+		old := newGlobalCategories(configured, categories, state.NewStore(""))
+		defer old.stop()
+
+		Expect(old.set("adult", true, 0)).Should(Succeed())
+		Expect(old.set("adblock", false, 100*time.Millisecond)).Should(Succeed())
+
+		reloaded := newGlobalCategories(configured, categories, state.NewStore(""))
+		defer reloaded.stop()
+
+		reloaded.takeOver(old)
+		old.stop()
+
+		Expect(reloaded.enabled("adult")).Should(BeTrue())
+		Expect(reloaded.enabled("adblock")).Should(BeFalse())
+
+		Eventually(func() bool {
+			return reloaded.enabled("adblock")
+		}, "1s").Should(BeTrue())
+	})
+
+	It("should keep the value unchanged if the change can't be saved", func() {
+		// the directory of the state file is missing, save fails
+		Expect(os.RemoveAll(dir)).Should(Succeed())
+
+		Expect(sut.set("adblock", false, time.Hour)).ShouldNot(Succeed())
+		Expect(sut.enabled("adblock")).Should(BeTrue())
+		Expect(sut.timers).Should(BeEmpty())
+	})
+
+	It("should reject unknown categories", func() {
+		err := sut.set("gambling", true, 0)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("unknown category 'gambling'"))
+	})
+
+	When("category is switched via API", func() {
+		It("should be shown in blocking status", func() {
+			res, err := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{Global: configured},
+				nil, store, nil)
+			Expect(err).Should(Succeed())
+
+			r := res.(*BlockingResolver)
+			defer r.Stop()
+
+			By("disable adblock for 1 hour", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/global/disable?category=adblock&duration=1h", r.apiGlobalDisable)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+			})
+
+			By("Query blocking status", func() {
+				httpCode, body := DoGetRequest("/api/blocking/status", r.apiBlockingStatus)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var result api.BlockingStatus
+				Expect(json.NewDecoder(body).Decode(&result)).Should(Succeed())
+
+				Expect(result.Global).Should(HaveLen(3))
+				Expect(result.Global[0].Category).Should(Equal("adblock"))
+				Expect(result.Global[0].Enabled).Should(BeFalse())
+				Expect(result.Global[0].AutoResetInSec).Should(BeNumerically(">", 3500))
+				Expect(r.activeCategories([]string{"adblock"})).Should(BeEmpty())
+			})
+
+			By("unknown category and wrong duration", func() {
+				httpCode, _ := DoGetRequest("/api/blocking/global/enable?category=gambling", r.apiGlobalEnable)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+
+				httpCode, _ = DoGetRequest("/api/blocking/global/enable?category=adult&duration=xyz", r.apiGlobalEnable)
+				Expect(httpCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+})
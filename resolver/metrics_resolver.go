@@ -19,6 +19,7 @@ type MetricsResolver struct {
 	totalQueries      *prometheus.CounterVec
 	totalResponse     *prometheus.CounterVec
 	totalErrors       prometheus.Counter
+	totalTimeouts     prometheus.Counter
 	durationHistogram *prometheus.HistogramVec
 }
 
@@ -31,7 +32,9 @@ func (m *MetricsResolver) Resolve(request *Request) (*Response, error) {
 			"client": strings.Join(request.ClientNames, ","),
 			"type":   dns.TypeToString[request.Req.Question[0].Qtype]}).Inc()
 
-		if err != nil {
+		if IsTimeout(err) {
+			m.totalTimeouts.Inc()
+		} else if err != nil {
 			m.totalErrors.Inc()
 		} else {
 			m.totalResponse.With(prometheus.Labels{
@@ -61,11 +64,13 @@ func NewMetricsResolver(cfg config.PrometheusConfig) ChainedResolver {
 	totalQueries := totalQueriesMetric()
 	totalResponse := totalResponseMetric()
 	totalErrors := totalErrorMetric()
+	totalTimeouts := totalTimeoutMetric()
 
-	metrics.RegisterMetric(durationHistogram)
-	metrics.RegisterMetric(totalQueries)
-	metrics.RegisterMetric(totalResponse)
-	metrics.RegisterMetric(totalErrors)
+	durationHistogram = metrics.RegisterMetric(durationHistogram).(*prometheus.HistogramVec)
+	totalQueries = metrics.RegisterMetric(totalQueries).(*prometheus.CounterVec)
+	totalResponse = metrics.RegisterMetric(totalResponse).(*prometheus.CounterVec)
+	totalErrors = metrics.RegisterMetric(totalErrors).(prometheus.Counter)
+	totalTimeouts = metrics.RegisterMetric(totalTimeouts).(prometheus.Counter)
 
 	return &MetricsResolver{
 		cfg:               cfg,
@@ -73,6 +78,7 @@ func NewMetricsResolver(cfg config.PrometheusConfig) ChainedResolver {
 		totalQueries:      totalQueries,
 		totalResponse:     totalResponse,
 		totalErrors:       totalErrors,
+		totalTimeouts:     totalTimeouts,
 	}
 }
 
@@ -94,6 +100,15 @@ func totalErrorMetric() prometheus.Counter {
 	)
 }
 
+func totalTimeoutMetric() prometheus.Counter {
+	return prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "blocky_timeout_total",
+			Help: "Number of queries which exceeded the query deadline",
+		},
+	)
+}
+
 func durationHistogram() *prometheus.HistogramVec {
 	return prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
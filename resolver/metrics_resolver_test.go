@@ -1,7 +1,9 @@
 package resolver
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
 	"github.com/stgnet/blocky/config"
 
@@ -19,10 +21,16 @@ var _ = Describe("MetricResolver", func() {
 		m    *resolverMock
 		err  error
 		resp *Response
+
+		// counters are shared by all instances, so the specs check the difference
+		queriesBefore, errorsBefore, timeoutsBefore float64
 	)
 
 	BeforeEach(func() {
 		sut = NewMetricsResolver(config.PrometheusConfig{Enable: true}).(*MetricsResolver)
+		queriesBefore = testutil.ToFloat64(sut.totalQueries.With(prometheus.Labels{"client": "client", "type": "A"}))
+		errorsBefore = testutil.ToFloat64(sut.totalErrors)
+		timeoutsBefore = testutil.ToFloat64(sut.totalTimeouts)
 		m = &resolverMock{}
 		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg)}, nil)
 		sut.Next(m)
@@ -38,7 +46,7 @@ var _ = Describe("MetricResolver", func() {
 					cnt, err := sut.totalQueries.GetMetricWith(prometheus.Labels{"client": "client", "type": "A"})
 					Expect(err).Should(Succeed())
 
-					Expect(testutil.ToFloat64(cnt)).Should(Equal(float64(1)))
+					Expect(testutil.ToFloat64(cnt)).Should(Equal(queriesBefore + 1))
 					Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
 					m.AssertExpectations(GinkgoT())
 				})
@@ -53,7 +61,32 @@ var _ = Describe("MetricResolver", func() {
 					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "", "client"))
 					Expect(err).Should(HaveOccurred())
 
-					Expect(testutil.ToFloat64(sut.totalErrors)).Should(Equal(float64(1)))
+					Expect(testutil.ToFloat64(sut.totalErrors)).Should(Equal(errorsBefore + 1))
+				})
+			})
+			When("Query deadline is exceeded", func() {
+				BeforeEach(func() {
+					m = &resolverMock{}
+					m.On("Resolve", mock.Anything).Return(nil, fmt.Errorf("i/o timeout: %w", context.DeadlineExceeded))
+					sut.Next(m)
+				})
+				It("Timeout should be recorded separately", func() {
+					resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "", "client"))
+					Expect(err).Should(HaveOccurred())
+
+					Expect(testutil.ToFloat64(sut.totalTimeouts)).Should(Equal(timeoutsBefore + 1))
+					Expect(testutil.ToFloat64(sut.totalErrors)).Should(Equal(errorsBefore))
+				})
+			})
+			When("resolver is recreated on config reload", func() {
+				It("should keep the series of the counters", func() {
+					_, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "", "client"))
+					Expect(err).Should(Succeed())
+
+					recreated := NewMetricsResolver(config.PrometheusConfig{Enable: true}).(*MetricsResolver)
+					Expect(recreated.totalQueries).Should(BeIdenticalTo(sut.totalQueries))
+					Expect(testutil.ToFloat64(recreated.totalQueries.With(prometheus.Labels{"client": "client",
+						"type": "A"}))).Should(Equal(queriesBefore + 1))
 				})
 			})
 		})
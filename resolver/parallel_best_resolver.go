@@ -59,6 +59,9 @@ func (r *ParallelBestResolver) Resolve(request *Request) (*Response, error) {
 
 	r1, r2 := r.pickRandom()
 	logger.Debugf("using %s and %s as resolver", r1.resolver, r2.resolver)
+	request.trace("ParallelBestResolver", "picked upstream resolvers", map[string]interface{}{
+		"resolvers": []string{fmt.Sprint(r1.resolver), fmt.Sprint(r2.resolver)},
+	})
 
 	ch := make(chan requestResponse, 2)
 
@@ -72,9 +75,12 @@ func (r *ParallelBestResolver) Resolve(request *Request) (*Response, error) {
 
 	go resolve(request, r2, ch)
 
-	//nolint: gosimple
 	for len(collectedErrors) < 2 {
 		select {
+		case <-request.Context().Done():
+			logger.Debug("query deadline exceeded or request cancelled, stop waiting for resolvers")
+
+			return nil, fmt.Errorf("resolution was not successful, errors: %v: %w", collectedErrors, request.Context().Err())
 		case result := <-ch:
 			if result.err != nil {
 				logger.Debug("resolution failed from resolver, cause: ", result.err)
@@ -84,12 +90,16 @@ func (r *ParallelBestResolver) Resolve(request *Request) (*Response, error) {
 					"resolver": r1,
 					"answer":   util.AnswerToString(result.response.Res.Answer),
 				}).Debug("using response from resolver")
+				request.trace("ParallelBestResolver", "using fastest response", map[string]interface{}{
+					"reason": result.response.Reason,
+				})
+
 				return result.response, nil
 			}
 		}
 	}
 
-	return nil, fmt.Errorf("resolution was not successful, errors: %v", collectedErrors)
+	return nil, wrapCtxErr(request.Context(), fmt.Errorf("resolution was not successful, errors: %v", collectedErrors))
 }
 
 // pick 2 different random resolvers from the resolver pool
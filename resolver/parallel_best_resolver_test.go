@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"context"
 	"strings"
 	"time"
 
@@ -95,6 +96,35 @@ var _ = Describe("ParallelBestResolver", func() {
 					Expect(err).Should(HaveOccurred())
 				})
 			})
+			When("all resolvers are slower than the query deadline", func() {
+				BeforeEach(func() {
+					slowFn := func(request *dns.Msg) *dns.Msg {
+						response, err := util.NewMsgWithAnswer("example.com.", 123, dns.TypeA, "123.124.122.123")
+						time.Sleep(300 * time.Millisecond)
+
+						Expect(err).Should(Succeed())
+						return response
+					}
+
+					sut = NewParallelBestResolver(config.UpstreamConfig{
+						ExternalResolvers: []config.Upstream{TestUDPUpstream(slowFn), TestUDPUpstream(slowFn)},
+					})
+				})
+				It("Should return timeout error", func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+					defer cancel()
+
+					request := newRequest("example.com.", dns.TypeA)
+					request.Ctx = ctx
+
+					start := time.Now()
+					resp, err = sut.Resolve(request)
+
+					Expect(err).Should(HaveOccurred())
+					Expect(IsTimeout(err)).Should(BeTrue())
+					Expect(time.Since(start)).Should(BeNumerically("<", 250*time.Millisecond))
+				})
+			})
 
 		})
 		When("only 1 upstream resolvers is defined", func() {
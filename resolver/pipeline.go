@@ -0,0 +1,208 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/stgnet/blocky/clients"
+	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/metrics"
+	"github.com/stgnet/blocky/schedule"
+	"github.com/stgnet/blocky/state"
+
+	"github.com/go-chi/chi"
+)
+
+// PipelineContext contains all dependencies, which can be used by resolver constructors of the pipeline
+type PipelineContext struct {
+	Cfg    *config.Config
+	Router *chi.Mux
+	// Clients is shared by all resolvers of the pipeline, will be created from the config if nil
+	Clients *clients.Registry
+	// State persists runtime changes, will be created from the config if nil
+	State *state.Store
+	// Schedules is shared by blocking and cname resolvers, will be created from the config if nil
+	Schedules *schedule.Registry
+}
+
+type pipelineStage struct {
+	create func(pc *PipelineContext) (Resolver, error)
+	// terminal stages don't delegate to a next resolver and must be the last stage of the pipeline
+	terminal bool
+}
+
+// nolint:gochecknoglobals
+var pipelineRegistry = map[string]pipelineStage{
+	"ednsClientID": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewEdnsClientIDResolver(pc.Cfg.EdnsClientID), nil
+	}},
+	"clientNames": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewClientNamesResolver(pc.Cfg.ClientLookup), nil
+	}},
+	"queryLogging": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewQueryLoggingResolver(pc.Cfg.QueryLog)
+	}},
+	"stats": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewStatsResolver(), nil
+	}},
+	"metrics": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewMetricsResolver(pc.Cfg.Prometheus), nil
+	}},
+	"conditional": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewConditionalUpstreamResolver(pc.Cfg.Conditional), nil
+	}},
+	"customDNS": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewCustomDNSResolver(pc.Cfg.CustomDNS), nil
+	}},
+	"cname": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewCnameResolver(pc.Cfg.Cname, pc.Clients, pc.Schedules), nil
+	}},
+	"blocking": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewBlockingResolver(pc.Router, pc.Cfg.Blocking, pc.Clients, pc.State, pc.Schedules)
+	}},
+	"rpz": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewRPZResolver(pc.Cfg.RPZ), nil
+	}},
+	"caching": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewCachingResolver(pc.Cfg.Caching), nil
+	}},
+	"parallelBest": {create: func(pc *PipelineContext) (Resolver, error) {
+		return NewParallelBestResolver(pc.Cfg.Upstream), nil
+	}, terminal: true},
+}
+
+// DefaultPipeline is the order of resolvers, which is used if no pipeline is configured
+// nolint:gochecknoglobals
+var DefaultPipeline = []string{
+	"ednsClientID",
+	"clientNames",
+	"queryLogging",
+	"stats",
+	"metrics",
+	"conditional",
+	"customDNS",
+	"cname",
+	"blocking",
+	"rpz",
+	"caching",
+	"parallelBest",
+}
+
+// PipelineStages returns the sorted names of all known resolver stages
+func PipelineStages() (result []string) {
+	for name := range pipelineRegistry {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+
+	return
+}
+
+// ValidatePipeline checks if the pipeline contains only known stages and ends with exactly one terminal stage.
+// Stages can be repeated.
+// If the private DNS is used (blocking mode private or both), ednsClientID must run before blocking, otherwise the
+// groups of MAC and CPE ID clients are unknown to the private DNS lookups
+func ValidatePipeline(pipeline []string, blockingMode string) error {
+	if len(pipeline) == 0 {
+		return errors.New("pipeline is empty")
+	}
+
+	seen := make(map[string]bool, len(pipeline))
+
+	for i, name := range pipeline {
+		stage, found := pipelineRegistry[name]
+		if !found {
+			return fmt.Errorf("unknown pipeline stage '%s', please use one of %v", name, PipelineStages())
+		}
+
+		seen[name] = true
+
+		last := i == len(pipeline)-1
+
+		if stage.terminal && !last {
+			return fmt.Errorf("pipeline stage '%s' does not delegate to other resolvers and must be the last stage", name)
+		}
+
+		if !stage.terminal && last {
+			return fmt.Errorf("last pipeline stage must resolve queries itself (for example 'parallelBest'), but was '%s'", name)
+		}
+
+		if name == "blocking" && blockingMode != config.BlockingModeLists && !seen["ednsClientID"] {
+			return errors.New("pipeline stage 'ednsClientID' must be defined before 'blocking', if the private DNS is used")
+		}
+	}
+
+	return nil
+}
+
+// NewPipeline validates the pipeline, creates a resolver for each stage and chains them in the defined order
+func NewPipeline(pipeline []string, pc *PipelineContext) (Resolver, error) {
+	if err := ValidatePipeline(pipeline, pc.Cfg.Blocking.Mode); err != nil {
+		return nil, err
+	}
+
+	if pc.State == nil {
+		pc.State = state.NewStore(pc.Cfg.StateFile)
+	}
+
+	if pc.Clients == nil {
+		registry, err := clients.NewRegistry(pc.Cfg.Clients, pc.State)
+		if err != nil {
+			return nil, err
+		}
+
+		pc.Clients = registry
+	}
+
+	if pc.Schedules == nil {
+		schedules, err := schedule.NewRegistry(pc.Cfg.Schedules, pc.Cfg.Blocking.GroupSchedules, pc.Cfg.Cname.Groups)
+		if err != nil {
+			return nil, err
+		}
+
+		pc.Schedules = schedules
+	}
+
+	if pc.Router != nil {
+		pc.Clients.RegisterAPIEndpoints(pc.Router)
+		pc.Schedules.RegisterAPIEndpoints(pc.Router)
+	}
+
+	resolvers := make([]Resolver, 0, len(pipeline))
+	created := make(map[string]bool, len(pipeline))
+
+	// repeated stages share the gauges of the first instance
+	metrics.BeginRound()
+	defer metrics.EndRound()
+
+	for _, name := range pipeline {
+		stagePC := pc
+
+		if created[name] {
+			// API endpoints are registered by the first instance of the stage only
+			repeated := *pc
+			repeated.Router = nil
+			stagePC = &repeated
+		}
+
+		created[name] = true
+
+		r, err := pipelineRegistry[name].create(stagePC)
+		if err != nil {
+			// stop the background work of the already created resolvers
+			for _, created := range resolvers {
+				if s, ok := created.(Stoppable); ok {
+					s.Stop()
+				}
+			}
+
+			return nil, fmt.Errorf("can't create pipeline stage '%s': %w", name, err)
+		}
+
+		resolvers = append(resolvers, r)
+	}
+
+	return Chain(resolvers...), nil
+}
@@ -0,0 +1,178 @@
+package resolver
+
+import (
+	"net/http"
+
+	"github.com/stgnet/blocky/config"
+	. "github.com/stgnet/blocky/helpertest"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pipeline", func() {
+	var pc *PipelineContext
+
+	BeforeEach(func() {
+		pc = &PipelineContext{
+			Cfg:    &config.Config{},
+			Router: chi.NewRouter(),
+		}
+	})
+
+	resolverNames := func(res Resolver) (result []string) {
+		for res != nil {
+			result = append(result, Name(res))
+
+			if c, ok := res.(ChainedResolver); ok {
+				res = c.GetNext()
+			} else {
+				break
+			}
+		}
+
+		return
+	}
+
+	Describe("Creating pipeline", func() {
+		When("default pipeline is used", func() {
+			It("should create resolvers in the default order", func() {
+				res, err := NewPipeline(DefaultPipeline, pc)
+				Expect(err).Should(Succeed())
+
+				Expect(resolverNames(res)).Should(Equal([]string{
+					"EdnsClientIDResolver",
+					"ClientNamesResolver",
+					"QueryLoggingResolver",
+					"StatsResolver",
+					"MetricsResolver",
+					"ConditionalUpstreamResolver",
+					"CustomDNSResolver",
+					"CnameResolver",
+					"BlockingResolver",
+					"RPZResolver",
+					"CachingResolver",
+					"ParallelBestResolver",
+				}))
+			})
+		})
+		When("stages are reordered, dropped and repeated", func() {
+			It("should create resolvers in the configured order", func() {
+				pc.Cfg.Blocking.Mode = config.BlockingModeLists
+
+				res, err := NewPipeline([]string{"caching", "blocking", "customDNS", "caching", "parallelBest"}, pc)
+				Expect(err).Should(Succeed())
+
+				Expect(resolverNames(res)).Should(Equal([]string{
+					"CachingResolver",
+					"BlockingResolver",
+					"CustomDNSResolver",
+					"CachingResolver",
+					"ParallelBestResolver",
+				}))
+			})
+		})
+		When("blocking stage is repeated", func() {
+			blockingResolvers := func(res Resolver) (result []*BlockingResolver) {
+				for ; res != nil; res = next(res) {
+					if b, ok := res.(*BlockingResolver); ok {
+						result = append(result, b)
+					}
+				}
+
+				return
+			}
+
+			It("should use the API endpoints of the first instance and keep the state of each instance on reload",
+				func() {
+					pipeline := []string{"blocking", "caching", "blocking", "parallelBest"}
+					pc.Cfg.Blocking.Mode = config.BlockingModeLists
+
+					res, err := NewPipeline(pipeline, pc)
+					Expect(err).Should(Succeed())
+
+					old := blockingResolvers(res)
+					Expect(old).Should(HaveLen(2))
+
+					httpCode, _ := DoGetRequest("/api/blocking/disable", pc.Router.ServeHTTP)
+					Expect(httpCode).Should(Equal(http.StatusOK))
+
+					Expect(old[0].status.enabled).Should(BeFalse())
+					Expect(old[1].status.enabled).Should(BeTrue())
+
+					reloaded, err := NewPipeline(pipeline, &PipelineContext{
+						Cfg:    pc.Cfg,
+						Router: chi.NewRouter(),
+					})
+					Expect(err).Should(Succeed())
+
+					TransferState(res, reloaded)
+
+					created := blockingResolvers(reloaded)
+					Expect(created[0].status.enabled).Should(BeFalse())
+					Expect(created[1].status.enabled).Should(BeTrue())
+				})
+		})
+		When("stage can't be created", func() {
+			It("should return error", func() {
+				pc.Cfg.Blocking.BlockType = "wrong"
+
+				_, err := NewPipeline([]string{"ednsClientID", "blocking", "parallelBest"}, pc)
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("can't create pipeline stage 'blocking'"))
+			})
+		})
+	})
+
+	Describe("Validation of pipeline", func() {
+		When("pipeline is empty", func() {
+			It("should return error", func() {
+				Expect(ValidatePipeline(nil, config.BlockingModeLists)).Should(HaveOccurred())
+			})
+		})
+		When("pipeline contains unknown stage", func() {
+			It("should return error", func() {
+				err := ValidatePipeline([]string{"blocking", "unknown", "parallelBest"}, config.BlockingModeLists)
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("unknown pipeline stage 'unknown'"))
+			})
+		})
+		When("terminal stage is not the last one", func() {
+			It("should return error", func() {
+				err := ValidatePipeline([]string{"parallelBest", "blocking"}, config.BlockingModeLists)
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("must be the last stage"))
+			})
+		})
+		When("last stage does not resolve queries", func() {
+			It("should return error", func() {
+				err := ValidatePipeline([]string{"blocking", "caching"}, config.BlockingModeLists)
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("last pipeline stage"))
+			})
+		})
+		When("private DNS is used and ednsClientID is missing or after blocking", func() {
+			It("should return error", func() {
+				for _, mode := range []string{"", config.BlockingModePrivate, config.BlockingModeBoth} {
+					err := ValidatePipeline([]string{"blocking", "parallelBest"}, mode)
+					Expect(err).Should(HaveOccurred())
+					Expect(err.Error()).Should(ContainSubstring("'ednsClientID' must be defined before 'blocking'"))
+
+					err = ValidatePipeline([]string{"blocking", "ednsClientID", "parallelBest"}, mode)
+					Expect(err).Should(HaveOccurred())
+				}
+			})
+		})
+		When("only lists are used for blocking", func() {
+			It("should not require ednsClientID", func() {
+				Expect(ValidatePipeline([]string{"blocking", "parallelBest"}, config.BlockingModeLists)).Should(Succeed())
+			})
+		})
+		When("pipeline is valid", func() {
+			It("should return no error", func() {
+				Expect(ValidatePipeline(DefaultPipeline, config.BlockingModePrivate)).Should(Succeed())
+			})
+		})
+	})
+})
@@ -6,45 +6,250 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
+	"github.com/stgnet/blocky/config"
 	"github.com/stgnet/blocky/util"
 )
 
-func callExternal(msg *dns.Msg, upstreamURL string) (*dns.Msg, time.Duration, error) {
+const (
+	defaultPrivateDNSHost = "10.255.0.1"
+	defaultPrivateDNSNet  = "udp"
+	// a backend with an error is tried last during this period
+	privateDNSBackendPenalty = time.Minute
+)
+
+type privateDNSBackend struct {
+	host string
+
+	lock          sync.RWMutex
+	lastErrorTime time.Time
+	lastError     error
+}
+
+func (b *privateDNSBackend) healthy() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return time.Since(b.lastErrorTime) >= privateDNSBackendPenalty
+}
+
+func (b *privateDNSBackend) markError(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.lastErrorTime = time.Now()
+	b.lastError = err
+}
+
+func (b *privateDNSBackend) markSuccess() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.lastErrorTime = time.Unix(0, 0)
+	b.lastError = nil
+}
+
+func (b *privateDNSBackend) String() string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	if b.lastError != nil && time.Since(b.lastErrorTime) < privateDNSBackendPenalty {
+		return fmt.Sprintf("%s (unhealthy since %s: %v)", b.host, b.lastErrorTime.Format(time.RFC3339), b.lastError)
+	}
+
+	return fmt.Sprintf("%s (healthy)", b.host)
+}
+
+// privateDNSClient asks the private category DNS backends, if a query should be blocked.
+// Backends are tried in the configured order, backends with recent errors are tried last.
+type privateDNSClient struct {
+	client     upstreamClient
+	net        string
+	retries    int
+	basePort   int
+	categories []privateDNSCategory
+	backends   []*privateDNSBackend
+}
+
+type privateDNSCategory struct {
+	name string
+	bit  int
+}
+
+func newPrivateDNSClient(cfg config.PrivateDNSConfig) *privateDNSClient {
+	hosts := cfg.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{defaultPrivateDNSHost}
+	}
+
+	backends := make([]*privateDNSBackend, len(hosts))
+	for i, h := range hosts {
+		backends[i] = &privateDNSBackend{host: strings.TrimSpace(h), lastErrorTime: time.Unix(0, 0)}
+	}
 
-	dnsClient := &dnsUpstreamClient{
-		client: &dns.Client{
-			Net:     "udp",
-			Timeout: defaultTimeout,
+	netName := cfg.Net
+	if netName == "" {
+		netName = defaultPrivateDNSNet
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	basePort, _ := cfg.PortRange()
+
+	var categories []privateDNSCategory
+	for name, bit := range cfg.CategoryBits() {
+		categories = append(categories, privateDNSCategory{name: name, bit: int(bit)})
+	}
+
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].bit < categories[j].bit
+	})
+
+	return &privateDNSClient{
+		client: &dnsUpstreamClient{
+			client: &dns.Client{
+				Net:     netName,
+				Timeout: timeout,
+			},
 		},
+		net:        netName,
+		retries:    cfg.Retries,
+		basePort:   basePort,
+		categories: categories,
+		backends:   backends,
+	}
+}
+
+// port returns the base port plus the bits of the passed categories
+func (c *privateDNSClient) port(categories []string) int {
+	port := c.basePort
+
+	for _, name := range categories {
+		for _, category := range c.categories {
+			if category.name == name {
+				port += category.bit
+			}
+		}
+	}
+
+	return port
+}
+
+// categoryNames decodes the port into the names of the active categories
+func (c *privateDNSClient) categoryNames(port int) (result []string) {
+	mask := port - c.basePort
+
+	for _, category := range c.categories {
+		if mask&category.bit != 0 {
+			result = append(result, category.name)
+		}
+	}
+
+	return
+}
+
+func (c *privateDNSClient) Configuration() (result []string) {
+	result = append(result, fmt.Sprintf("net = \"%s\"", c.net))
+	result = append(result, fmt.Sprintf("retries = %d", c.retries))
+	result = append(result, fmt.Sprintf("basePort = %d", c.basePort))
+
+	result = append(result, "categories:")
+	for _, category := range c.categories {
+		result = append(result, fmt.Sprintf("  %s = %d (port %d)", category.name, category.bit, c.basePort+category.bit))
+	}
+
+	result = append(result, "backends:")
+	for _, b := range c.backends {
+		result = append(result, fmt.Sprintf("  %s", b))
 	}
-	return dnsClient.callExternal(msg, upstreamURL)
 
+	return
 }
 
-func resolvePrivate(request *Request, port int) (*dns.Msg, error) {
-	logger := withPrefix(request.Log, "private_resolver")
-	host := "10.255.0.1"
-	url := net.JoinHostPort(host, strconv.Itoa(port))
+// orderedBackends returns healthy backends first, each group in the configured order
+func (c *privateDNSClient) orderedBackends() []*privateDNSBackend {
+	result := make([]*privateDNSBackend, 0, len(c.backends))
+
+	var unhealthy []*privateDNSBackend
+
+	for _, b := range c.backends {
+		if b.healthy() {
+			result = append(result, b)
+		} else {
+			unhealthy = append(unhealthy, b)
+		}
+	}
+
+	return append(result, unhealthy...)
+}
+
+// resolve sends the request to the private DNS backends with the port of the active categories
+func (c *privateDNSClient) resolve(request *Request, port int) (*dns.Msg, error) {
+	logger := withPrefix(request.Log, "private_resolver").
+		WithField("categories", categoriesToString(c.categoryNames(port)))
+	ctx := request.Context()
 
-	var rtt time.Duration
-	var resp *dns.Msg
 	var err error
-	if resp, rtt, err = callExternal(request.Req, url); err == nil {
-		logger.WithFields(logrus.Fields{
-			"answer":           util.AnswerToString(resp.Answer),
-			"return_code":      dns.RcodeToString[resp.Rcode],
-			"upstream":         url,
-			"response_time_ms": rtt.Milliseconds(),
-		}).Debugf("received response from private dns")
 
-		return resp, nil
+	for _, backend := range c.orderedBackends() {
+		url := net.JoinHostPort(backend.host, strconv.Itoa(port))
+
+		for attempt := 1; attempt <= c.retries+1; attempt++ {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				if err == nil {
+					err = ctxErr
+				}
+
+				return nil, fmt.Errorf("could not resolve using private dns %w", wrapCtxErr(ctx, err))
+			}
+
+			var resp *dns.Msg
+
+			var rtt time.Duration
+
+			if resp, rtt, err = c.client.callExternal(ctx, request.Req, url); err == nil {
+				backend.markSuccess()
+
+				logger.WithFields(logrus.Fields{
+					"answer":           util.AnswerToString(resp.Answer),
+					"return_code":      dns.RcodeToString[resp.Rcode],
+					"upstream":         url,
+					"response_time_ms": rtt.Milliseconds(),
+				}).Debugf("received response from private dns")
+				request.trace("PrivateDNS", "received response", map[string]interface{}{
+					"upstream":       url,
+					"returnCode":     dns.RcodeToString[resp.Rcode],
+					"responseTimeMs": rtt.Milliseconds(),
+				})
+
+				return resp, nil
+			}
+
+			logger.WithFields(logrus.Fields{
+				"upstream": url,
+				"attempt":  attempt,
+			}).Debugf("private dns request failed: %v", err)
+			request.trace("PrivateDNS", "request failed", map[string]interface{}{
+				"upstream": url,
+				"attempt":  attempt,
+				"error":    err.Error(),
+			})
+		}
+
+		if ctx.Err() == nil {
+			logger.WithField("upstream", url).Warnf("private dns backend failed, trying next backend: %v", err)
+			backend.markError(err)
+		}
 	}
 
-	return nil, fmt.Errorf("could not resolve using private dns %w", err)
+	return nil, fmt.Errorf("could not resolve using private dns %w", wrapCtxErr(ctx, err))
 }
 
 func contains(domain string, cache []string) bool {
@@ -56,52 +261,71 @@ func contains(domain string, cache []string) bool {
 	return false
 }
 
-func (r *BlockingResolver) getPort(groupsToCheck []string) int {
-	toggles := map[string]bool{"adblock": false, "malware": false, "adult": false}
+// activeCategories returns the sorted categories, which are enabled globally and for one of the client's groups
+func (r *BlockingResolver) activeCategories(groupsToCheck []string) (result []string) {
 	uniqueGroups := buildGroupsMap(groupsToCheck)
-	for k, v := range r.cfg.Global {
-		toggles[k] = v
-	}
 
-	logger("private_resolver").Debugf("global: %v, toggles: %v, groupsToCheck: %v ***!", r.cfg.Global, toggles, uniqueGroups)
 	// Global State	| Device State	| Result for Device
 	// -----------------------------------------------
 	// OFF (False)	| ON (True)		| OFF |
 	// OFF (False)	| OFF (False)	| OFF |
 	// ON (True)	| ON (True)		| ON  |
 	// ON (True)	| OFF (False)	| OFF |
+	for _, c := range r.privateDNS.categories {
+		if r.globals.enabled(c.name) && uniqueGroups[c.name] && !r.pauses.isPaused(pauseScopeCategory, c.name) {
+			result = append(result, c.name)
+		}
+	}
 
-	for k, v := range toggles {
-		v2, _ := uniqueGroups[k]
+	logger("private_resolver").Debugf("global: %v, groupsToCheck: %v, active categories: %v",
+		r.globals.snapshot(), groupsToCheck, result)
 
-		if v && v2 {
-			toggles[k] = true
-			continue
-		}
-		toggles[k] = false
-		continue
+	return
+}
 
+// privateVerdict returns the return code of the private DNS for domain and port, from cache if possible
+func (r *BlockingResolver) privateVerdict(request *Request, domain string, port int) (rcode int, cached bool, err error) {
+	if rcode, found := r.verdictCache.get(domain, port); found {
+		return rcode, true, nil
 	}
 
-	logger("private_resolver").Debugf("final toggles %v", toggles)
-	// calculate result
-	values := map[string]int{"adblock": 1, "malware": 2, "adult": 4}
-	port := 1024
-	for k, v := range toggles {
-		if v {
-			if i, ok := values[k]; ok {
-				port += i
-			}
-		}
+	resp, err := r.privateDNS.resolve(request, port)
+	if err != nil {
+		return 0, false, err
 	}
-	if port > 1031 {
-		logger("private_resolver").Error("port returned a value greater than the maximum of 1031. Setting to 1024", port)
-		port = 1024
+
+	r.verdictCache.put(domain, port, resp)
+
+	return resp.Rcode, false, nil
+}
+
+// countPrivateBlocked increments the blocked counter of each active category
+func (r *BlockingResolver) countPrivateBlocked(categories []string) {
+	if r.privateBlocked == nil {
+		return
 	}
 
-	return port
+	if len(categories) == 0 {
+		r.privateBlocked.WithLabelValues("none").Inc()
+	}
 
+	for _, c := range categories {
+		r.privateBlocked.WithLabelValues(c).Inc()
+	}
 }
+
+func categoriesToString(categories []string) string {
+	if len(categories) == 0 {
+		return "none"
+	}
+
+	return strings.Join(categories, ", ")
+}
+
+func (r *BlockingResolver) getPort(groupsToCheck []string) int {
+	return r.privateDNS.port(r.activeCategories(groupsToCheck))
+}
+
 func buildGroupsMap(slice []string) map[string]bool {
 	m := map[string]bool{}
 	for _, entry := range slice {
@@ -111,16 +335,24 @@ func buildGroupsMap(slice []string) map[string]bool {
 	return m
 }
 
+// getEdnsData appends the groups of the client's MAC and CPE ID from EDNS0 data
 func getEdnsData(request *Request, cfg map[string][]string, groups *[]string) {
-	opt := request.Req.IsEdns0()
-	if opt != nil {
-		data := (opt.Option[0].(*dns.EDNS0_LOCAL)).Data
-		macStr := net.HardwareAddr(data).String()
-		groupsByName, found := cfg[macStr]
+	var ids []string
+
+	if request.ClientMAC != nil {
+		ids = append(ids, request.ClientMAC.String())
+	}
+
+	if request.ClientCPEID != "" {
+		ids = append(ids, request.ClientCPEID)
+	}
+
+	for _, id := range ids {
+		groupsByID, found := cfg[id]
 		if found {
-			*groups = append(*groups, groupsByName...)
+			*groups = append(*groups, groupsByID...)
 		}
 
-		logger("groups_to_check").Debugf("macstr: %s, groups: %v", macStr, groups)
+		logger("groups_to_check").Debugf("client id: %s, groups: %v", id, groupsByID)
 	}
 }
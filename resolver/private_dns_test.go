@@ -1,9 +1,16 @@
 package resolver
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 	"github.com/stgnet/blocky/config"
 )
 
@@ -167,6 +174,32 @@ func TestBlockingResolver_getPort(t *testing.T) {
 			groupsToCheck: []string{"adblock", "adult"},
 			want:          1029,
 		},
+		{
+			name: "custom base port",
+			blockingCfg: config.BlockingConfig{
+				ClientGroupsBlock: map[string][]string{
+					"1.2.1.2": {"adblock", "adult"},
+				},
+				Global:     map[string]bool{"adblock": true, "adult": true},
+				PrivateDNS: config.PrivateDNSConfig{BasePort: 2048},
+			},
+			groupsToCheck: []string{"adblock", "adult"},
+			want:          2053,
+		},
+		{
+			name: "custom categories",
+			blockingCfg: config.BlockingConfig{
+				ClientGroupsBlock: map[string][]string{
+					"1.2.1.2": {"adblock", "gambling", "crypto"},
+				},
+				Global: map[string]bool{"adblock": true, "gambling": true, "crypto": true},
+				PrivateDNS: config.PrivateDNSConfig{
+					Categories: map[string]uint16{"adblock": 1, "malware": 2, "adult": 4, "gambling": 8, "crypto": 32},
+				},
+			},
+			groupsToCheck: []string{"adblock", "gambling", "crypto"},
+			want:          1065,
+		},
 		{
 			name: "multiple client to check",
 			blockingCfg: config.BlockingConfig{
@@ -185,10 +218,141 @@ func TestBlockingResolver_getPort(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := NewBlockingResolver(chi.NewRouter(), tt.blockingCfg).(*BlockingResolver)
+			res, err := NewBlockingResolver(chi.NewRouter(), tt.blockingCfg, nil, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := res.(*BlockingResolver)
 			if got := r.getPort(tt.groupsToCheck); got != tt.want {
 				t.Errorf("BlockingResolver.getPort() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+type privateDNSClientMock struct {
+	lock  sync.Mutex
+	calls []string
+	fn    func(upstreamURL string) (*dns.Msg, error)
+}
+
+func (m *privateDNSClientMock) callExternal(_ context.Context, _ *dns.Msg,
+	upstreamURL string) (*dns.Msg, time.Duration, error) {
+	m.lock.Lock()
+	m.calls = append(m.calls, upstreamURL)
+	m.lock.Unlock()
+
+	resp, err := m.fn(upstreamURL)
+
+	return resp, time.Millisecond, err
+}
+
+var _ = Describe("PrivateDNSClient", func() {
+	var (
+		sut        *privateDNSClient
+		clientMock *privateDNSClientMock
+	)
+
+	nxDomain := func() *dns.Msg {
+		msg := new(dns.Msg)
+		msg.Rcode = dns.RcodeNameError
+
+		return msg
+	}
+
+	BeforeEach(func() {
+		sut = newPrivateDNSClient(config.PrivateDNSConfig{
+			Hosts:   []string{"10.0.0.1", "10.0.0.2"},
+			Retries: 1,
+		})
+		clientMock = &privateDNSClientMock{fn: func(string) (*dns.Msg, error) {
+			return nxDomain(), nil
+		}}
+		sut.client = clientMock
+	})
+
+	When("no backend is configured", func() {
+		It("should use default values", func() {
+			sut = newPrivateDNSClient(config.PrivateDNSConfig{})
+
+			Expect(sut.backends).Should(HaveLen(1))
+			Expect(sut.backends[0].host).Should(Equal("10.255.0.1"))
+			Expect(sut.net).Should(Equal("udp"))
+			Expect(sut.basePort).Should(Equal(1024))
+		})
+	})
+
+	When("categories are configured", func() {
+		BeforeEach(func() {
+			sut = newPrivateDNSClient(config.PrivateDNSConfig{
+				BasePort:   2000,
+				Categories: map[string]uint16{"social": 16, "adblock": 1, "gambling": 8},
+			})
+		})
+		It("should calculate the port with the bits of the categories", func() {
+			Expect(sut.port([]string{"gambling", "social"})).Should(Equal(2024))
+			Expect(sut.port(nil)).Should(Equal(2000))
+		})
+		It("should decode the port into category names", func() {
+			Expect(sut.categoryNames(2009)).Should(Equal([]string{"adblock", "gambling"}))
+			Expect(sut.categoryNames(2000)).Should(BeEmpty())
+		})
+	})
+
+	When("first backend is healthy", func() {
+		It("should use the first backend", func() {
+			resp, err := sut.resolve(newRequest("example.com.", dns.TypeA), 1025)
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Rcode).Should(Equal(dns.RcodeNameError))
+			Expect(clientMock.calls).Should(Equal([]string{"10.0.0.1:1025"}))
+		})
+	})
+
+	When("first backend fails", func() {
+		BeforeEach(func() {
+			clientMock.fn = func(upstreamURL string) (*dns.Msg, error) {
+				if upstreamURL == "10.0.0.1:1025" {
+					return nil, errors.New("connection refused")
+				}
+
+				return nxDomain(), nil
+			}
+		})
+		It("should retry and fail over to the next backend", func() {
+			resp, err := sut.resolve(newRequest("example.com.", dns.TypeA), 1025)
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Rcode).Should(Equal(dns.RcodeNameError))
+			Expect(clientMock.calls).Should(Equal([]string{"10.0.0.1:1025", "10.0.0.1:1025", "10.0.0.2:1025"}))
+		})
+		It("should try the failed backend last for the next queries", func() {
+			_, _ = sut.resolve(newRequest("example.com.", dns.TypeA), 1025)
+			clientMock.calls = nil
+
+			_, err := sut.resolve(newRequest("example.com.", dns.TypeA), 1025)
+
+			Expect(err).Should(Succeed())
+			Expect(clientMock.calls).Should(Equal([]string{"10.0.0.2:1025"}))
+			Expect(sut.backends[0].healthy()).Should(BeFalse())
+			Expect(sut.backends[1].healthy()).Should(BeTrue())
+			Expect(sut.Configuration()).Should(ContainElement(ContainSubstring("10.0.0.1 (unhealthy since")))
+		})
+	})
+
+	When("all backends fail", func() {
+		BeforeEach(func() {
+			clientMock.fn = func(string) (*dns.Msg, error) {
+				return nil, errors.New("connection refused")
+			}
+		})
+		It("should return error", func() {
+			_, err := sut.resolve(newRequest("example.com.", dns.TypeA), 1025)
+
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("connection refused"))
+			Expect(clientMock.calls).Should(HaveLen(4))
+		})
+	})
+})
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -33,6 +32,7 @@ type QueryLoggingResolver struct {
 	perClient        bool
 	logRetentionDays uint64
 	logChan          chan *queryLogEntry
+	stop             chan struct{}
 }
 
 type queryLogEntry struct {
@@ -43,9 +43,9 @@ type queryLogEntry struct {
 	logger     *logrus.Entry
 }
 
-func NewQueryLoggingResolver(cfg config.QueryLogConfig) ChainedResolver {
+func NewQueryLoggingResolver(cfg config.QueryLogConfig) (ChainedResolver, error) {
 	if _, err := os.Stat(cfg.Dir); cfg.Dir != "" && err != nil && os.IsNotExist(err) {
-		logger(queryLoggingResolverPrefix).Fatalf("query log directory '%s' does not exist or is not writable", cfg.Dir)
+		return nil, fmt.Errorf("query log directory '%s' does not exist or is not writable", cfg.Dir)
 	}
 
 	logChan := make(chan *queryLogEntry, logChanCap)
@@ -55,6 +55,7 @@ func NewQueryLoggingResolver(cfg config.QueryLogConfig) ChainedResolver {
 		perClient:        cfg.PerClient,
 		logRetentionDays: cfg.LogRetentionDays,
 		logChan:          logChan,
+		stop:             make(chan struct{}),
 	}
 
 	go resolver.writeLog()
@@ -63,7 +64,7 @@ func NewQueryLoggingResolver(cfg config.QueryLogConfig) ChainedResolver {
 		go resolver.periodicCleanUp()
 	}
 
-	return &resolver
+	return &resolver, nil
 }
 
 // triggers periodically cleanup of old log files
@@ -72,11 +73,20 @@ func (r *QueryLoggingResolver) periodicCleanUp() {
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
-		r.doCleanUp()
+		select {
+		case <-ticker.C:
+			r.doCleanUp()
+		case <-r.stop:
+			return
+		}
 	}
 }
 
+// Stop ends the log writer and the periodical clean up, pending log entries will be dropped
+func (r *QueryLoggingResolver) Stop() {
+	close(r.stop)
+}
+
 // deletes old log files
 func (r *QueryLoggingResolver) doCleanUp() {
 	logger := logger(queryLoggingResolverPrefix)
@@ -136,58 +146,68 @@ func (r *QueryLoggingResolver) Resolve(request *Request) (*Response, error) {
 	return resp, err
 }
 
-// write entry: if log directory is configured, write to log file
+// writes log entries until the resolver is stopped
 func (r *QueryLoggingResolver) writeLog() {
-	for logEntry := range r.logChan {
-		if r.logDir != "" {
-			var clientPrefix string
+	for {
+		select {
+		case logEntry := <-r.logChan:
+			r.writeLogEntry(logEntry)
+		case <-r.stop:
+			return
+		}
+	}
+}
 
-			start := time.Now()
+// write entry: if log directory is configured, write to log file
+func (r *QueryLoggingResolver) writeLogEntry(logEntry *queryLogEntry) {
+	if r.logDir != "" {
+		var clientPrefix string
 
-			dateString := logEntry.start.Format("2006-01-02")
+		start := time.Now()
 
-			if r.perClient {
-				clientPrefix = strings.Join(logEntry.request.ClientNames, "-")
-			} else {
-				clientPrefix = "ALL"
-			}
+		dateString := logEntry.start.Format("2006-01-02")
 
-			fileName := fmt.Sprintf("%s_%s.log", dateString, escape(clientPrefix))
-			writePath := filepath.Join(r.logDir, fileName)
+		if r.perClient {
+			clientPrefix = strings.Join(logEntry.request.ClientNames, "-")
+		} else {
+			clientPrefix = "ALL"
+		}
 
-			file, err := os.OpenFile(writePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+		fileName := fmt.Sprintf("%s_%s.log", dateString, escape(clientPrefix))
+		writePath := filepath.Join(r.logDir, fileName)
 
-			if err != nil {
-				logEntry.logger.WithField("file_name", writePath).Error("can't create/open file", err)
-			} else {
-				writer := createCsvWriter(file)
+		file, err := os.OpenFile(writePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
 
-				err := writer.Write(createQueryLogRow(logEntry))
-				if err != nil {
-					logEntry.logger.WithField("file_name", writePath).Error("can't write to file", err)
-				}
-				writer.Flush()
+		if err != nil {
+			logEntry.logger.WithField("file_name", writePath).Error("can't create/open file", err)
+		} else {
+			writer := createCsvWriter(file)
 
-				_ = file.Close()
+			err := writer.Write(createQueryLogRow(logEntry))
+			if err != nil {
+				logEntry.logger.WithField("file_name", writePath).Error("can't write to file", err)
 			}
+			writer.Flush()
 
-			halfCap := cap(r.logChan) / 2
+			_ = file.Close()
+		}
 
-			// if log channel is > 50% full, this could be a problem with slow writer (external storage over network etc.)
-			if len(r.logChan) > halfCap {
-				logEntry.logger.WithField("channel_len",
-					len(r.logChan)).Warnf("query log writer is too slow, write duration: %d ms", time.Since(start).Milliseconds())
-			}
-		} else {
-			logEntry.logger.WithFields(
-				logrus.Fields{
-					"response_reason": logEntry.response.Reason,
-					"response_code":   dns.RcodeToString[logEntry.response.Res.Rcode],
-					"answer":          util.AnswerToString(logEntry.response.Res.Answer),
-					"duration_ms":     logEntry.durationMs,
-				},
-			).Infof("query resolved")
+		halfCap := cap(r.logChan) / 2
+
+		// if log channel is > 50% full, this could be a problem with slow writer (external storage over network etc.)
+		if len(r.logChan) > halfCap {
+			logEntry.logger.WithField("channel_len",
+				len(r.logChan)).Warnf("query log writer is too slow, write duration: %d ms", time.Since(start).Milliseconds())
 		}
+	} else {
+		logEntry.logger.WithFields(
+			logrus.Fields{
+				"response_reason": logEntry.response.Reason,
+				"response_code":   dns.RcodeToString[logEntry.response.Res.Rcode],
+				"answer":          util.AnswerToString(logEntry.response.Res.Answer),
+				"duration_ms":     logEntry.durationMs,
+			},
+		).Infof("query resolved")
 	}
 }
 
@@ -208,12 +228,8 @@ func createQueryLogRow(logEntry *queryLogEntry) []string {
 	response := logEntry.response
 	clientID := request.ClientIP.String()
 
-	if request.ClientIP.String() == "127.0.0.1" {
-		opt := request.Req.IsEdns0()
-		if opt != nil {
-			data := (opt.Option[0].(*dns.EDNS0_LOCAL)).Data
-			clientID = net.HardwareAddr(data).String()
-		}
+	if request.ClientIP.String() == "127.0.0.1" && request.ClientMAC != nil {
+		clientID = request.ClientMAC.String()
 	}
 
 	return []string{
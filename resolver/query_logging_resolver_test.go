@@ -38,7 +38,10 @@ var _ = Describe("QueryLoggingResolver", func() {
 	})
 
 	JustBeforeEach(func() {
-		sut = NewQueryLoggingResolver(sutConfig).(*QueryLoggingResolver)
+		res, e := NewQueryLoggingResolver(sutConfig)
+		Expect(e).Should(Succeed())
+
+		sut = res.(*QueryLoggingResolver)
 		m = &resolverMock{}
 		m.On("Resolve", mock.Anything).Return(&Response{Res: mockAnswer, Reason: "reason"}, nil)
 		sut.Next(m)
@@ -178,32 +181,21 @@ var _ = Describe("QueryLoggingResolver", func() {
 	Describe("Clean up of query log directory", func() {
 		When("Log directory does not exist", func() {
 
-			It("should exit with error", func() {
-				defer func() { log.Logger.ExitFunc = nil }()
-
-				var fatal bool
+			It("should return error", func() {
+				_, e := NewQueryLoggingResolver(config.QueryLogConfig{Dir: "notExists"})
 
-				log.Logger.ExitFunc = func(int) { fatal = true }
-				_ = NewQueryLoggingResolver(config.QueryLogConfig{Dir: "notExists"})
-
-				Expect(fatal).Should(BeTrue())
+				Expect(e).Should(HaveOccurred())
+				Expect(e.Error()).Should(ContainSubstring("query log directory 'notExists' does not exist"))
 			})
 		})
 		When("not existing log directory is configured, log retention is enabled", func() {
-			It("should exit with error", func() {
-				defer func() { log.Logger.ExitFunc = nil }()
-
-				var fatal bool
-
-				log.Logger.ExitFunc = func(int) { fatal = true }
-
-				sut := NewQueryLoggingResolver(config.QueryLogConfig{
+			It("should return error", func() {
+				_, e := NewQueryLoggingResolver(config.QueryLogConfig{
 					Dir:              "wrongDir",
 					LogRetentionDays: 7,
-				}).(*QueryLoggingResolver)
+				})
 
-				sut.doCleanUp()
-				Expect(fatal).Should(BeTrue())
+				Expect(e).Should(HaveOccurred())
 			})
 		})
 		When("log directory contains old files", func() {
@@ -219,10 +211,11 @@ var _ = Describe("QueryLoggingResolver", func() {
 				f2, err := os.Create(filepath.Join(tmpDir, fmt.Sprintf("%s-test.log", dateBefore8Days.Format("2006-01-02"))))
 				Expect(err).Should(Succeed())
 
-				sut := NewQueryLoggingResolver(config.QueryLogConfig{
+				sut, err := NewQueryLoggingResolver(config.QueryLogConfig{
 					Dir:              tmpDir,
 					LogRetentionDays: 7,
 				})
+				Expect(err).Should(Succeed())
 
 				sut.(*QueryLoggingResolver).doCleanUp()
 
@@ -1,12 +1,14 @@
 package resolver
 
 import (
-	"github.com/stgnet/blocky/log"
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"time"
 
+	"github.com/stgnet/blocky/log"
 	"github.com/stgnet/blocky/util"
 
 	"github.com/miekg/dns"
@@ -19,6 +21,39 @@ type Request struct {
 	Req         *dns.Msg
 	Log         *logrus.Entry
 	RequestTS   time.Time
+	// Ctx carries the per-query deadline and cancellation, nil means no deadline
+	Ctx context.Context
+	// Trace collects the decisions of all resolvers, nil if explain mode is not active
+	Trace *Trace
+	// ClientMAC is the MAC address of the client from EDNS0 data, nil if not present
+	ClientMAC net.HardwareAddr
+	// ClientCPEID is the CPE identifier of the client from EDNS0 data, empty if not present
+	ClientCPEID string
+	// ClientSubnet is the subnet of the client from EDNS0 client subnet (ECS), nil if not present
+	ClientSubnet *net.IPNet
+}
+
+// Context returns the request's context, never nil
+func (r *Request) Context() context.Context {
+	if r.Ctx != nil {
+		return r.Ctx
+	}
+
+	return context.Background()
+}
+
+// IsTimeout returns true, if the error was caused by an exceeded query deadline
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// wrapCtxErr attaches the context error (deadline or cancellation) to err, if the context is done
+func wrapCtxErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%v: %w", err, ctxErr)
+	}
+
+	return err
 }
 
 func newRequest(question string, rType uint16) *Request {
@@ -63,6 +98,8 @@ type Response struct {
 	Res    *dns.Msg
 	Reason string
 	RType  ResponseType
+	// Drop is set, if the DNS server should not answer the query at all
+	Drop bool
 }
 type Resolver interface {
 	Resolve(req *Request) (*Response, error)
@@ -75,6 +112,12 @@ type ChainedResolver interface {
 	GetNext() Resolver
 }
 
+// Stoppable is implemented by resolvers with background work (goroutines, timers, list refresh)
+type Stoppable interface {
+	// Stop ends the background work. In-flight queries can still be finished
+	Stop()
+}
+
 type NextResolver struct {
 	next Resolver
 }
@@ -107,6 +150,69 @@ func Chain(resolvers ...Resolver) Resolver {
 	return resolvers[0]
 }
 
+// StateKeeper is implemented by resolvers with runtime state, which isn't part of the configuration (for example
+// disabled blocking)
+type StateKeeper interface {
+	// TakeState continues the runtime state of the old resolver, which will be replaced
+	TakeState(old Resolver)
+}
+
+// TransferState passes the runtime state of the resolvers of the old chain to the resolvers of the same type in the
+// new chain, for example on config reload
+func TransferState(oldChain, newChain Resolver) {
+	// repeated stages: the n-th resolver of a type takes the state of the n-th old resolver of the same type
+	occurrences := make(map[string]int)
+
+	for r := newChain; r != nil; r = next(r) {
+		name := Name(r)
+		occurrence := occurrences[name]
+		occurrences[name]++
+
+		keeper, ok := r.(StateKeeper)
+		if !ok {
+			continue
+		}
+
+		for old := oldChain; old != nil; old = next(old) {
+			if Name(old) != name {
+				continue
+			}
+
+			if occurrence == 0 {
+				keeper.TakeState(old)
+
+				break
+			}
+
+			occurrence--
+		}
+	}
+}
+
+// next returns the next resolver of a chained resolver, nil for the last one
+func next(resolver Resolver) Resolver {
+	if c, ok := resolver.(ChainedResolver); ok {
+		return c.GetNext()
+	}
+
+	return nil
+}
+
+// StopChain stops all resolvers of the chain, which implement Stoppable
+func StopChain(resolver Resolver) {
+	for resolver != nil {
+		if s, ok := resolver.(Stoppable); ok {
+			s.Stop()
+		}
+
+		if c, ok := resolver.(ChainedResolver); ok {
+			resolver = c.GetNext()
+		} else {
+			break
+		}
+	}
+}
+
 func Name(resolver Resolver) string {
 	return strings.Split(fmt.Sprintf("%T", resolver), ".")[1]
 }
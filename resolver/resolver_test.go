@@ -12,8 +12,10 @@ var _ = Describe("Resolver", func() {
 	Describe("Creating resolver chain", func() {
 		When("A chain of resolvers will be created", func() {
 			It("should be iterable by calling 'GetNext'", func() {
-				ch := Chain(NewBlockingResolver(chi.NewRouter(),
-					config.BlockingConfig{}), NewClientNamesResolver(config.ClientLookupConfig{}))
+				blocking, err := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{}, nil, nil, nil)
+				Expect(err).Should(Succeed())
+
+				ch := Chain(blocking, NewClientNamesResolver(config.ClientLookupConfig{}))
 				c, ok := ch.(ChainedResolver)
 				Expect(ok).Should(BeTrue())
 
@@ -23,7 +25,10 @@ var _ = Describe("Resolver", func() {
 		})
 		When("'Name' will be called", func() {
 			It("should return resolver name", func() {
-				name := Name(NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{}))
+				blocking, err := NewBlockingResolver(chi.NewRouter(), config.BlockingConfig{}, nil, nil, nil)
+				Expect(err).Should(Succeed())
+
+				name := Name(blocking)
 				Expect(name).Should(Equal("BlockingResolver"))
 			})
 		})
@@ -0,0 +1,195 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/lists"
+	"github.com/stgnet/blocky/util"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+// maxNSLookups limits the lookups of name servers for NSDNAME triggers (the domain and its parent domains)
+const maxNSLookups = 4
+
+// RPZResolver applies the rules of response policy zones. Client IP and QNAME triggers are checked before the query
+// is resolved, response IP and NSDNAME triggers after it
+type RPZResolver struct {
+	NextResolver
+	zones *lists.RPZCache
+}
+
+func NewRPZResolver(cfg config.RPZConfig) ChainedResolver {
+	return &RPZResolver{zones: lists.NewRPZCache(cfg.Zones, cfg.RefreshPeriod)}
+}
+
+func (r *RPZResolver) Configuration() (result []string) {
+	if r.zones.IsEmpty() {
+		return []string{"deactivated"}
+	}
+
+	return r.zones.Configuration()
+}
+
+// Stop stops the refresh of the zones
+func (r *RPZResolver) Stop() {
+	r.zones.Stop()
+}
+
+func (r *RPZResolver) Resolve(request *Request) (*Response, error) {
+	logger := withPrefix(request.Log, "rpz_resolver")
+
+	if r.zones.IsEmpty() || len(request.Req.Question) == 0 {
+		return r.next.Resolve(request)
+	}
+
+	question := request.Req.Question[0]
+	qname := util.ExtractDomain(question)
+
+	if rule := r.zones.MatchQuery(request.ClientIP, qname); rule != nil {
+		return r.apply(logger, request, rule, nil)
+	}
+
+	response, err := r.next.Resolve(request)
+	if err != nil || response == nil || response.Res == nil {
+		return response, err
+	}
+
+	var nsNames []string
+	if r.zones.HasNSDNameRules() {
+		nsNames = r.nameServers(request, qname)
+	}
+
+	if rule := r.zones.MatchResponse(answerIPs(response.Res), nsNames); rule != nil {
+		return r.apply(logger, request, rule, response)
+	}
+
+	return response, nil
+}
+
+// apply creates the response for the rule. Response is the already resolved response (nil for triggers, which are
+// checked before resolution)
+func (r *RPZResolver) apply(logger *logrus.Entry, request *Request, rule *lists.RPZRule,
+	response *Response) (*Response, error) {
+	reason := fmt.Sprintf("RPZ %s (%s)", rule.Action, rule)
+
+	logger.WithField("rule", rule.String()).Debugf("policy hit '%s'", reason)
+	request.trace("RPZResolver", "policy hit", map[string]interface{}{
+		"zone":    rule.Zone,
+		"trigger": string(rule.Trigger),
+		"rule":    rule.Name,
+		"action":  string(rule.Action),
+	})
+
+	reply := new(dns.Msg)
+	reply.SetReply(request.Req)
+
+	switch rule.Action {
+	case lists.RPZActionPassthru:
+		if response == nil {
+			var err error
+			if response, err = r.next.Resolve(request); err != nil {
+				return nil, err
+			}
+		}
+
+		response.Reason = reason
+
+		return response, nil
+	case lists.RPZActionNxDomain:
+		reply.Rcode = dns.RcodeNameError
+	case lists.RPZActionNoData:
+	case lists.RPZActionDrop:
+		reply.Rcode = dns.RcodeServerFailure
+
+		return &Response{Res: reply, RType: BLOCKED, Reason: reason, Drop: true}, nil
+	case lists.RPZActionLocalData:
+		answer, err := r.localData(request, rule)
+		if err != nil {
+			return nil, err
+		}
+
+		reply.Answer = answer
+
+		return &Response{Res: reply, RType: CUSTOMDNS, Reason: reason}, nil
+	}
+
+	return &Response{Res: reply, RType: BLOCKED, Reason: reason}, nil
+}
+
+// localData returns the records of the rule for the question. A CNAME is resolved with the next resolver
+func (r *RPZResolver) localData(request *Request, rule *lists.RPZRule) ([]dns.RR, error) {
+	question := request.Req.Question[0]
+
+	var result []dns.RR
+
+	for _, rr := range rule.Data {
+		cname, isCNAME := rr.(*dns.CNAME)
+		if !isCNAME && rr.Header().Rrtype != question.Qtype {
+			continue
+		}
+
+		answer := dns.Copy(rr)
+		answer.Header().Name = question.Name
+		result = append(result, answer)
+
+		if isCNAME {
+			targetResponse, err := r.next.Resolve(newSubRequest(request, cname.Target, question.Qtype))
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, targetResponse.Res.Answer...)
+		}
+	}
+
+	return result, nil
+}
+
+// nameServers returns the name servers of the domain or of its nearest parent domain
+func (r *RPZResolver) nameServers(request *Request, domain string) (result []string) {
+	for i := 0; i < maxNSLookups && strings.Contains(domain, "."); i++ {
+		response, err := r.next.Resolve(newSubRequest(request, dns.Fqdn(domain), dns.TypeNS))
+		if err == nil && response.Res != nil {
+			for _, rr := range response.Res.Answer {
+				if ns, ok := rr.(*dns.NS); ok {
+					result = append(result, ns.Ns)
+				}
+			}
+		}
+
+		if len(result) > 0 {
+			return result
+		}
+
+		domain = domain[strings.Index(domain, ".")+1:]
+	}
+
+	return nil
+}
+
+// newSubRequest creates a request of the resolver for the same client
+func newSubRequest(request *Request, name string, qType uint16) *Request {
+	sub := *request
+	sub.Req = util.NewMsgWithQuestion(name, qType)
+	sub.Trace = nil
+
+	return &sub
+}
+
+func answerIPs(msg *dns.Msg) (result []net.IP) {
+	for _, rr := range msg.Answer {
+		switch v := rr.(type) {
+		case *dns.A:
+			result = append(result, v.A)
+		case *dns.AAAA:
+			result = append(result, v.AAAA)
+		}
+	}
+
+	return
+}
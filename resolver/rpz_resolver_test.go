@@ -0,0 +1,184 @@
+package resolver
+
+import (
+	"os"
+
+	"github.com/stgnet/blocky/config"
+	. "github.com/stgnet/blocky/helpertest"
+	"github.com/stgnet/blocky/util"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("RPZResolver", func() {
+	var (
+		sut      *RPZResolver
+		m        *resolverMock
+		zoneFile *os.File
+		err      error
+		resp     *Response
+	)
+
+	answer := func(domain string, dnsType uint16, address string) *Response {
+		msg, _ := util.NewMsgWithAnswer(domain, 300, dnsType, address)
+
+		return &Response{Res: msg, RType: RESOLVED, Reason: "UPSTREAM"}
+	}
+
+	question := func(domain string, dnsType uint16) interface{} {
+		return mock.MatchedBy(func(req *Request) bool {
+			return req.Req.Question[0].Name == domain && req.Req.Question[0].Qtype == dnsType
+		})
+	}
+
+	BeforeEach(func() {
+		zoneFile = TempFile(`$ORIGIN threats.rpz.
+$TTL 300
+@ IN SOA localhost. admin.localhost. 1 3600 600 86400 60
+@ IN NS localhost.
+evil.com CNAME .
+empty.com CNAME *.
+drop.com CNAME rpz-drop.
+ok.evil.com CNAME rpz-passthru.
+walled.com CNAME garden.example.
+local.com A 10.0.0.1
+32.2.1.168.192.rpz-client-ip CNAME .
+24.0.2.0.192.rpz-ip CNAME .
+ns.bad.net.rpz-nsdname CNAME rpz-drop.
+`)
+
+		m = &resolverMock{}
+		m.On("Resolve", question("garden.example.", dns.TypeA)).Return(
+			answer("garden.example.", dns.TypeA, "10.0.0.2"), nil)
+		m.On("Resolve", question("bad-ip.com.", dns.TypeA)).Return(
+			answer("bad-ip.com.", dns.TypeA, "192.0.2.17"), nil)
+		m.On("Resolve", question("bad-ns.com.", dns.TypeNS)).Return(
+			answer("bad-ns.com.", dns.TypeNS, "ns.bad.net."), nil)
+		m.On("Resolve", question("www.bad-ns.com.", dns.TypeA)).Return(
+			answer("www.bad-ns.com.", dns.TypeA, "8.8.8.8"), nil)
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "UPSTREAM"}, nil)
+	})
+
+	JustBeforeEach(func() {
+		sut = NewRPZResolver(config.RPZConfig{
+			Zones: []config.RPZZoneConfig{{Source: zoneFile.Name()}},
+		}).(*RPZResolver)
+		sut.Next(m)
+	})
+
+	AfterEach(func() {
+		sut.Stop()
+		_ = os.Remove(zoneFile.Name())
+	})
+
+	Describe("Triggers before resolution", func() {
+		It("should answer with NXDOMAIN for a QNAME rule", func() {
+			resp, err = sut.Resolve(newRequestWithClient("evil.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(BLOCKED))
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+			Expect(resp.Reason).Should(Equal("RPZ NXDOMAIN (threats.rpz: qname evil.com)"))
+			m.AssertNotCalled(GinkgoT(), "Resolve", mock.Anything)
+		})
+
+		It("should answer without records for a NODATA rule", func() {
+			resp, err = sut.Resolve(newRequestWithClient("empty.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeSuccess))
+			Expect(resp.Res.Answer).Should(BeEmpty())
+			Expect(resp.Reason).Should(Equal("RPZ NODATA (threats.rpz: qname empty.com)"))
+		})
+
+		It("should mark the response of a DROP rule", func() {
+			resp, err = sut.Resolve(newRequestWithClient("drop.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Drop).Should(BeTrue())
+			Expect(resp.Reason).Should(Equal("RPZ DROP (threats.rpz: qname drop.com)"))
+		})
+
+		It("should apply client IP rules", func() {
+			resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "192.168.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+			Expect(resp.Reason).Should(Equal("RPZ NXDOMAIN (threats.rpz: client-ip 32.2.1.168.192.rpz-client-ip)"))
+		})
+
+		It("should delegate PASSTHRU rules to the next resolver", func() {
+			resp, err = sut.Resolve(newRequestWithClient("ok.evil.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RPZ PASSTHRU (threats.rpz: qname ok.evil.com)"))
+			m.AssertCalled(GinkgoT(), "Resolve", question("ok.evil.com.", dns.TypeA))
+		})
+	})
+
+	Describe("Local data", func() {
+		It("should answer with the records of the rule", func() {
+			resp, err = sut.Resolve(newRequestWithClient("local.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.RType).Should(Equal(CUSTOMDNS))
+			Expect(resp.Res.Answer).Should(BeDNSRecord("local.com.", dns.TypeA, 300, "10.0.0.1"))
+		})
+
+		It("should resolve the target of a CNAME", func() {
+			resp, err = sut.Resolve(newRequestWithClient("walled.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RPZ LOCAL-DATA (threats.rpz: qname walled.com)"))
+			Expect(resp.Res.Answer).Should(HaveLen(2))
+			Expect(resp.Res.Answer[0].(*dns.CNAME).Target).Should(Equal("garden.example."))
+			Expect(resp.Res.Answer[1]).Should(BeDNSRecord("garden.example.", dns.TypeA, 300, "10.0.0.2"))
+		})
+	})
+
+	Describe("Triggers after resolution", func() {
+		It("should apply response IP rules", func() {
+			resp, err = sut.Resolve(newRequestWithClient("bad-ip.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Res.Rcode).Should(Equal(dns.RcodeNameError))
+			Expect(resp.Res.Answer).Should(BeEmpty())
+			Expect(resp.Reason).Should(Equal("RPZ NXDOMAIN (threats.rpz: response-ip 24.0.2.0.192.rpz-ip)"))
+		})
+
+		It("should apply NSDNAME rules to the name servers of the parent domain", func() {
+			resp, err = sut.Resolve(newRequestWithClient("www.bad-ns.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Drop).Should(BeTrue())
+			Expect(resp.Reason).Should(Equal("RPZ DROP (threats.rpz: nsdname ns.bad.net.rpz-nsdname)"))
+		})
+
+		It("should return the response of the next resolver if no rule matches", func() {
+			resp, err = sut.Resolve(newRequestWithClient("example.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("UPSTREAM"))
+		})
+	})
+
+	When("no zones are configured", func() {
+		JustBeforeEach(func() {
+			sut.Stop()
+			sut = NewRPZResolver(config.RPZConfig{}).(*RPZResolver)
+			sut.Next(m)
+		})
+
+		It("should be deactivated", func() {
+			Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+
+			resp, err = sut.Resolve(newRequestWithClient("evil.com.", dns.TypeA, "1.2.1.2"))
+
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("UPSTREAM"))
+		})
+	})
+})
@@ -13,8 +13,10 @@ import (
 
 type StatsResolver struct {
 	NextResolver
-	recorders []*resolverStatRecorder
-	statsChan chan *statsEntry
+	recorders   []*resolverStatRecorder
+	statsChan   chan *statsEntry
+	stop        chan struct{}
+	stopTrigger func()
 }
 
 type statsEntry struct {
@@ -42,20 +44,34 @@ func newRecorderWithMax(name string, max uint, fn func(*statsEntry) string) *res
 }
 
 func (r *StatsResolver) collectStats() {
-	for statsEntry := range r.statsChan {
-		for _, rec := range r.recorders {
-			rec.recordStats(statsEntry)
+	for {
+		select {
+		case statsEntry := <-r.statsChan:
+			for _, rec := range r.recorders {
+				rec.recordStats(statsEntry)
+			}
+		case <-r.stop:
+			return
 		}
 	}
 }
 
+// Stop ends the stats collection and the stats print trigger
+func (r *StatsResolver) Stop() {
+	r.stopTrigger()
+	close(r.stop)
+}
+
 func (r *StatsResolver) Resolve(request *Request) (*Response, error) {
 	resp, err := r.next.Resolve(request)
 
 	if err == nil {
-		r.statsChan <- &statsEntry{
+		select {
+		case r.statsChan <- &statsEntry{
 			request:  request,
 			response: resp,
+		}:
+		case <-r.stop:
 		}
 	}
 
@@ -79,11 +95,12 @@ func NewStatsResolver() ChainedResolver {
 	resolver := &StatsResolver{
 		statsChan: make(chan *statsEntry, 20),
 		recorders: createRecorders(),
+		stop:      make(chan struct{}),
 	}
 
 	go resolver.collectStats()
 
-	registerStatsTrigger(resolver)
+	resolver.stopTrigger = registerStatsTrigger(resolver)
 
 	return resolver
 }
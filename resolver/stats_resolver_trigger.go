@@ -8,14 +8,25 @@ import (
 	"syscall"
 )
 
-func registerStatsTrigger(resolver *StatsResolver) {
-	signals := make(chan os.Signal)
+func registerStatsTrigger(resolver *StatsResolver) (stop func()) {
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGUSR2)
 
+	done := make(chan struct{})
+
 	go func() {
 		for {
-			<-signals
-			resolver.printStats()
+			select {
+			case <-signals:
+				resolver.printStats()
+			case <-done:
+				return
+			}
 		}
 	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
 }
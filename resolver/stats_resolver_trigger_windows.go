@@ -1,4 +1,5 @@
 package resolver
 
-func registerStatsTrigger(resolver *StatsResolver) {
+func registerStatsTrigger(resolver *StatsResolver) (stop func()) {
+	return func() {}
 }
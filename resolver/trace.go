@@ -0,0 +1,47 @@
+package resolver
+
+import (
+	"sync"
+
+	"github.com/stgnet/blocky/api"
+)
+
+// Trace records the decisions of all resolvers for a query (explain mode)
+type Trace struct {
+	lock  sync.Mutex
+	steps []api.TraceStep
+}
+
+// NewTrace creates an empty trace
+func NewTrace() *Trace {
+	return &Trace{}
+}
+
+func (t *Trace) add(resolver, message string, details map[string]interface{}) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.steps = append(t.steps, api.TraceStep{
+		Resolver: resolver,
+		Message:  message,
+		Details:  details,
+	})
+}
+
+// Steps returns all recorded steps in order of their occurrence
+func (t *Trace) Steps() []api.TraceStep {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	result := make([]api.TraceStep, len(t.steps))
+	copy(result, t.steps)
+
+	return result
+}
+
+// trace records a step, if explain mode is active for the request
+func (r *Request) trace(resolver, message string, details map[string]interface{}) {
+	if r.Trace != nil {
+		r.Trace.add(resolver, message, details)
+	}
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"net"
+
+	"github.com/stgnet/blocky/config"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("Trace", func() {
+	var (
+		sut Resolver
+		m   *resolverMock
+	)
+
+	BeforeEach(func() {
+		m = &resolverMock{}
+		m.On("Resolve", mock.Anything).Return(&Response{Res: new(dns.Msg), Reason: "RESOLVED"}, nil)
+
+		sut = Chain(
+			NewClientNamesResolver(config.ClientLookupConfig{
+				ClientnameIPMapping: map[string][]net.IP{"laptop": {net.ParseIP("192.168.178.29")}},
+			}),
+			NewCustomDNSResolver(config.CustomDNSConfig{
+				Mapping: map[string]net.IP{"custom.domain": net.ParseIP("192.168.143.123")},
+			}),
+			m)
+	})
+
+	When("explain mode is active", func() {
+		It("should record the decisions of all resolvers in order", func() {
+			req := newRequestWithClient("custom.domain.", dns.TypeA, "192.168.178.29")
+			req.Trace = NewTrace()
+
+			_, err := sut.Resolve(req)
+			Expect(err).Should(Succeed())
+
+			steps := req.Trace.Steps()
+			Expect(steps).Should(HaveLen(2))
+			Expect(steps[0].Resolver).Should(Equal("ClientNamesResolver"))
+			Expect(steps[0].Details).Should(HaveKeyWithValue("clientNames", []string{"laptop"}))
+			Expect(steps[1].Resolver).Should(Equal("CustomDNSResolver"))
+			Expect(steps[1].Details).Should(HaveKeyWithValue("ip", "192.168.143.123"))
+		})
+	})
+
+	When("explain mode is not active", func() {
+		It("should resolve without trace", func() {
+			req := newRequestWithClient("example.com.", dns.TypeA, "192.168.178.29")
+
+			resp, err := sut.Resolve(req)
+			Expect(err).Should(Succeed())
+			Expect(resp.Reason).Should(Equal("RESOLVED"))
+			Expect(req.Trace).Should(BeNil())
+		})
+	})
+})
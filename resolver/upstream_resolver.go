@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -30,7 +31,8 @@ type UpstreamResolver struct {
 }
 
 type upstreamClient interface {
-	callExternal(msg *dns.Msg, upstreamURL string) (response *dns.Msg, rtt time.Duration, err error)
+	callExternal(ctx context.Context, msg *dns.Msg,
+		upstreamURL string) (response *dns.Msg, rtt time.Duration, err error)
 }
 
 type dnsUpstreamClient struct {
@@ -58,7 +60,7 @@ func createUpstreamClient(cfg config.Upstream) (client upstreamClient, upstreamU
 	}, net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
 }
 
-func (r *httpUpstreamClient) callExternal(msg *dns.Msg,
+func (r *httpUpstreamClient) callExternal(ctx context.Context, msg *dns.Msg,
 	upstreamURL string) (*dns.Msg, time.Duration, error) {
 	start := time.Now()
 
@@ -68,10 +70,17 @@ func (r *httpUpstreamClient) callExternal(msg *dns.Msg,
 		return nil, 0, fmt.Errorf("can't pack message: %v", err)
 	}
 
-	httpResponse, err := r.client.Post(upstreamURL, dnsContentType, bytes.NewReader(rawDNSMessage))
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, upstreamURL, bytes.NewReader(rawDNSMessage))
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't create https request: %v", err)
+	}
+
+	httpRequest.Header.Set("content-type", dnsContentType)
+
+	httpResponse, err := r.client.Do(httpRequest)
 
 	if err != nil {
-		return nil, 0, fmt.Errorf("can't perform https request: %v", err)
+		return nil, 0, fmt.Errorf("can't perform https request: %w", err)
 	}
 	defer httpResponse.Body.Close()
 
@@ -100,9 +109,9 @@ func (r *httpUpstreamClient) callExternal(msg *dns.Msg,
 	return &response, time.Since(start), nil
 }
 
-func (r *dnsUpstreamClient) callExternal(msg *dns.Msg,
+func (r *dnsUpstreamClient) callExternal(ctx context.Context, msg *dns.Msg,
 	upstreamURL string) (response *dns.Msg, rtt time.Duration, err error) {
-	return r.client.Exchange(msg, upstreamURL)
+	return r.client.ExchangeContext(ctx, msg, upstreamURL)
 }
 
 func NewUpstreamResolver(upstream config.Upstream) Resolver {
@@ -123,6 +132,7 @@ func (r UpstreamResolver) String() string {
 
 func (r *UpstreamResolver) Resolve(request *Request) (response *Response, err error) {
 	logger := withPrefix(request.Log, "upstream_resolver")
+	ctx := request.Context()
 
 	attempt := 1
 
@@ -131,24 +141,47 @@ func (r *UpstreamResolver) Resolve(request *Request) (response *Response, err er
 	var resp *dns.Msg
 
 	for attempt <= 3 {
-		if resp, rtt, err = r.upstreamClient.callExternal(request.Req, r.upstreamURL); err == nil {
+		// no (further) attempt, if the query deadline is exceeded or the request was cancelled
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			logger.WithField("attempt", attempt).Debug("query deadline exceeded or request cancelled")
+
+			if err == nil {
+				return nil, ctxErr
+			}
+
+			return nil, wrapCtxErr(ctx, err)
+		}
+
+		if resp, rtt, err = r.upstreamClient.callExternal(ctx, request.Req, r.upstreamURL); err == nil {
 			logger.WithFields(logrus.Fields{
 				"answer":           util.AnswerToString(resp.Answer),
 				"return_code":      dns.RcodeToString[resp.Rcode],
 				"upstream":         r.upstreamURL,
 				"response_time_ms": rtt.Milliseconds(),
 			}).Debugf("received response from upstream")
+			request.trace("UpstreamResolver", "received response", map[string]interface{}{
+				"upstream":       r.upstreamURL,
+				"returnCode":     dns.RcodeToString[resp.Rcode],
+				"answer":         util.AnswerToString(resp.Answer),
+				"responseTimeMs": rtt.Milliseconds(),
+				"attempt":        attempt,
+			})
 
 			return &Response{Res: resp, Reason: fmt.Sprintf("RESOLVED (%s)", r.upstreamURL)}, err
 		}
 
 		if errNet, ok := err.(net.Error); ok && (errNet.Timeout() || errNet.Temporary()) {
 			logger.WithField("attempt", attempt).Debugf("Temporary network error / Timeout occurred, retrying...")
+			request.trace("UpstreamResolver", "temporary error, retrying", map[string]interface{}{
+				"upstream": r.upstreamURL,
+				"attempt":  attempt,
+				"error":    err.Error(),
+			})
 			attempt++
 		} else {
-			return nil, err
+			return nil, wrapCtxErr(ctx, err)
 		}
 	}
 
-	return
+	return nil, wrapCtxErr(ctx, err)
 }
@@ -1,9 +1,11 @@
 package resolver
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/stgnet/blocky/config"
@@ -67,12 +69,11 @@ var _ = Describe("UpstreamResolver", func() {
 			})
 		})
 		When("Timeout occurs", func() {
-			counter := 0
-			attemptsWithTimeout := 2
+			var counter int32
+			attemptsWithTimeout := int32(2)
 			upstream := TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
-				counter++
 				// timeout on first x attempts
-				if counter <= attemptsWithTimeout {
+				if atomic.AddInt32(&counter, 1) <= atomic.LoadInt32(&attemptsWithTimeout) {
 					time.Sleep(110 * time.Millisecond)
 				}
 				response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
@@ -85,8 +86,8 @@ var _ = Describe("UpstreamResolver", func() {
 
 			It("should perform a retry with 3 attempts", func() {
 				By("2 attempts with timeout -> should resolve with third attempt", func() {
-					counter = 0
-					attemptsWithTimeout = 2
+					atomic.StoreInt32(&counter, 0)
+					atomic.StoreInt32(&attemptsWithTimeout, 2)
 
 					resp, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
 					Expect(err).Should(Succeed())
@@ -96,8 +97,8 @@ var _ = Describe("UpstreamResolver", func() {
 				})
 
 				By("3 attempts with timeout -> should return error", func() {
-					attemptsWithTimeout = 3
-					counter = 0
+					atomic.StoreInt32(&attemptsWithTimeout, 3)
+					atomic.StoreInt32(&counter, 0)
 					_, err := sut.Resolve(newRequest("example.com.", dns.TypeA))
 					Expect(err).Should(HaveOccurred())
 					Expect(err.Error()).Should(ContainSubstring("i/o timeout"))
@@ -107,6 +108,60 @@ var _ = Describe("UpstreamResolver", func() {
 		})
 	})
 
+	Describe("Query deadline", func() {
+		When("query deadline is exceeded", func() {
+			It("should return timeout error without retry", func() {
+				var counter int32
+				upstream := TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+					atomic.AddInt32(&counter, 1)
+					time.Sleep(200 * time.Millisecond)
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+					Expect(err).Should(Succeed())
+
+					return response
+				})
+				sut := NewUpstreamResolver(upstream)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+
+				request := newRequest("example.com.", dns.TypeA)
+				request.Ctx = ctx
+
+				_, err := sut.Resolve(request)
+				Expect(err).Should(HaveOccurred())
+				Expect(IsTimeout(err)).Should(BeTrue())
+				Eventually(func() int32 {
+					return atomic.LoadInt32(&counter)
+				}).Should(Equal(int32(1)))
+			})
+		})
+		When("request is cancelled", func() {
+			It("should return error without calling upstream", func() {
+				var counter int32
+				upstream := TestUDPUpstream(func(request *dns.Msg) (response *dns.Msg) {
+					atomic.AddInt32(&counter, 1)
+					response, err := util.NewMsgWithAnswer("example.com", 123, dns.TypeA, "123.124.122.122")
+					Expect(err).Should(Succeed())
+
+					return response
+				})
+				sut := NewUpstreamResolver(upstream)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				request := newRequest("example.com.", dns.TypeA)
+				request.Ctx = ctx
+
+				_, err := sut.Resolve(request)
+				Expect(err).Should(HaveOccurred())
+				Expect(IsTimeout(err)).Should(BeFalse())
+				Expect(atomic.LoadInt32(&counter)).Should(Equal(int32(0)))
+			})
+		})
+	})
+
 	Describe("Using Dns over HTTP (DOH) upstream", func() {
 		var (
 			sut              *UpstreamResolver
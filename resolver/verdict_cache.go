@@ -0,0 +1,221 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/metrics"
+
+	"github.com/miekg/dns"
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultVerdictCacheMaxEntries = 10000
+	defaultVerdictCacheMaxTime    = time.Hour
+	// is used if the response of the private DNS contains neither answer nor SOA record
+	verdictCacheFallbackTTL = time.Minute
+	// a full cache evicts 1/divisor of maxEntries at once
+	verdictCacheEvictDivisor = 10
+)
+
+// verdictCache caches the return code of private DNS lookups per domain and category port
+type verdictCache struct {
+	cache      *cache.Cache
+	maxEntries int
+	maxTime    time.Duration
+
+	hits, misses       uint64
+	hitsTotal          prometheus.Counter
+	missesTotal        prometheus.Counter
+	entryCountGaugeFnc prometheus.GaugeFunc
+}
+
+func newVerdictCache(cfg config.VerdictCacheConfig) *verdictCache {
+	maxEntries := cfg.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = defaultVerdictCacheMaxEntries
+	}
+
+	maxTime := cfg.MaxTime
+	if maxTime == 0 {
+		maxTime = defaultVerdictCacheMaxTime
+	}
+
+	c := &verdictCache{
+		cache:      cache.New(maxTime, 5*time.Minute),
+		maxEntries: maxEntries,
+		maxTime:    maxTime,
+	}
+
+	if metrics.IsEnabled() && c.enabled() {
+		c.hitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "blocky_private_verdict_cache_hit_total",
+			Help: "Number of private DNS verdicts served from cache",
+		})
+		c.missesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "blocky_private_verdict_cache_miss_total",
+			Help: "Number of private DNS verdicts not found in cache",
+		})
+		c.entryCountGaugeFnc = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "blocky_private_verdict_cache_entry_count",
+			Help: "Number of cached private DNS verdicts",
+		}, func() float64 {
+			return float64(c.cache.ItemCount())
+		})
+
+		c.hitsTotal = metrics.RegisterMetric(c.hitsTotal).(prometheus.Counter)
+		c.missesTotal = metrics.RegisterMetric(c.missesTotal).(prometheus.Counter)
+		c.entryCountGaugeFnc = metrics.ReplaceMetric(c.entryCountGaugeFnc).(prometheus.GaugeFunc)
+	}
+
+	return c
+}
+
+func (c *verdictCache) enabled() bool {
+	return c.maxEntries > 0
+}
+
+func verdictCacheKey(domain string, port int) string {
+	return fmt.Sprintf("%s:%d", domain, port)
+}
+
+// get returns the cached return code for domain and port
+func (c *verdictCache) get(domain string, port int) (rcode int, found bool) {
+	if !c.enabled() {
+		return 0, false
+	}
+
+	val, found := c.cache.Get(verdictCacheKey(domain, port))
+	if found {
+		atomic.AddUint64(&c.hits, 1)
+
+		if c.hitsTotal != nil {
+			c.hitsTotal.Inc()
+		}
+
+		return val.(int), true
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+
+	if c.missesTotal != nil {
+		c.missesTotal.Inc()
+	}
+
+	return 0, false
+}
+
+// put caches the return code of the response with the TTL of the answer or the SOA minimum. Only NOERROR and
+// NXDOMAIN are verdicts, other return codes (SERVFAIL, REFUSED, ...) are temporary failures and won't be cached
+func (c *verdictCache) put(domain string, port int, resp *dns.Msg) {
+	if !c.enabled() || (resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError) {
+		return
+	}
+
+	ttl := verdictTTL(resp)
+	if ttl > c.maxTime {
+		ttl = c.maxTime
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	key := verdictCacheKey(domain, port)
+
+	if _, found := c.cache.Get(key); !found && c.cache.ItemCount() >= c.maxEntries {
+		c.cache.DeleteExpired()
+
+		if c.cache.ItemCount() >= c.maxEntries {
+			c.evict(c.maxEntries / verdictCacheEvictDivisor)
+		}
+	}
+
+	c.cache.Set(key, resp.Rcode, ttl)
+}
+
+// evict removes the count (at least one) verdicts, which expire first. The cache is full again only after count new
+// verdicts, so the scan of all verdicts isn't needed for each new verdict
+func (c *verdictCache) evict(count int) {
+	type entry struct {
+		key        string
+		expiration int64
+	}
+
+	items := c.cache.Items()
+	entries := make([]entry, 0, len(items))
+
+	for key, item := range items {
+		entries = append(entries, entry{key: key, expiration: item.Expiration})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].expiration < entries[j].expiration
+	})
+
+	if count < 1 {
+		count = 1
+	}
+
+	for i := 0; i < count && i < len(entries); i++ {
+		c.cache.Delete(entries[i].key)
+	}
+}
+
+func (c *verdictCache) flush() {
+	c.cache.Flush()
+}
+
+func (c *verdictCache) Configuration() (result []string) {
+	if !c.enabled() {
+		return []string{"deactivated"}
+	}
+
+	hits := atomic.LoadUint64(&c.hits)
+	misses := atomic.LoadUint64(&c.misses)
+
+	var hitRate float64
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses) * 100
+	}
+
+	result = append(result, fmt.Sprintf("maxEntries = %d", c.maxEntries))
+	result = append(result, fmt.Sprintf("maxTime = %s", c.maxTime))
+	result = append(result, fmt.Sprintf("items count = %d", c.cache.ItemCount()))
+	result = append(result, fmt.Sprintf("hit rate = %.1f%% (%d hits, %d misses)", hitRate, hits, misses))
+
+	return
+}
+
+// verdictTTL returns the smallest TTL of the answer, the SOA minimum for responses without answer
+// or a fallback, if the response contains neither
+func verdictTTL(resp *dns.Msg) time.Duration {
+	if len(resp.Answer) > 0 {
+		ttl := resp.Answer[0].Header().Ttl
+		for _, rr := range resp.Answer {
+			if rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+
+		return time.Duration(ttl) * time.Second
+	}
+
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := soa.Minttl
+			if soa.Hdr.Ttl < ttl {
+				ttl = soa.Hdr.Ttl
+			}
+
+			return time.Duration(ttl) * time.Second
+		}
+	}
+
+	return verdictCacheFallbackTTL
+}
@@ -0,0 +1,162 @@
+package resolver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stgnet/blocky/config"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VerdictCache", func() {
+	var sut *verdictCache
+
+	nxDomainWithSOA := func(ttl, minTTL uint32) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.Rcode = dns.RcodeNameError
+		msg.Ns = []dns.RR{&dns.SOA{
+			Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+			Minttl: minTTL,
+		}}
+
+		return msg
+	}
+
+	BeforeEach(func() {
+		sut = newVerdictCache(config.VerdictCacheConfig{})
+	})
+
+	Describe("TTL of verdict", func() {
+		When("response contains answers", func() {
+			It("should use the smallest TTL", func() {
+				msg := new(dns.Msg)
+				rr1, _ := dns.NewRR("example.com. 300 IN A 1.2.3.4")
+				rr2, _ := dns.NewRR("example.com. 60 IN A 1.2.3.5")
+				msg.Answer = []dns.RR{rr1, rr2}
+
+				Expect(verdictTTL(msg)).Should(Equal(60 * time.Second))
+			})
+		})
+		When("response contains SOA record", func() {
+			It("should use the SOA minimum", func() {
+				Expect(verdictTTL(nxDomainWithSOA(3600, 120))).Should(Equal(120 * time.Second))
+			})
+			It("should use the TTL of SOA if it is smaller", func() {
+				Expect(verdictTTL(nxDomainWithSOA(30, 120))).Should(Equal(30 * time.Second))
+			})
+		})
+		When("response contains neither answer nor SOA record", func() {
+			It("should use the fallback", func() {
+				Expect(verdictTTL(new(dns.Msg))).Should(Equal(verdictCacheFallbackTTL))
+			})
+		})
+	})
+
+	When("verdict is cached", func() {
+		It("should return the return code per domain and port", func() {
+			sut.put("example.com", 1025, nxDomainWithSOA(3600, 120))
+
+			rcode, found := sut.get("example.com", 1025)
+			Expect(found).Should(BeTrue())
+			Expect(rcode).Should(Equal(dns.RcodeNameError))
+
+			_, found = sut.get("example.com", 1024)
+			Expect(found).Should(BeFalse())
+
+			Expect(sut.Configuration()).Should(ContainElement("hit rate = 50.0% (1 hits, 1 misses)"))
+		})
+		It("should be removed on flush", func() {
+			sut.put("example.com", 1025, nxDomainWithSOA(3600, 120))
+			sut.flush()
+
+			_, found := sut.get("example.com", 1025)
+			Expect(found).Should(BeFalse())
+		})
+	})
+
+	When("TTL is 0", func() {
+		It("should not cache the verdict", func() {
+			sut.put("example.com", 1025, nxDomainWithSOA(0, 0))
+
+			_, found := sut.get("example.com", 1025)
+			Expect(found).Should(BeFalse())
+		})
+	})
+
+	When("cache is full", func() {
+		BeforeEach(func() {
+			sut = newVerdictCache(config.VerdictCacheConfig{MaxEntries: 1})
+		})
+		It("should evict the verdict, which expires first", func() {
+			sut = newVerdictCache(config.VerdictCacheConfig{MaxEntries: 2})
+			sut.put("example.com", 1025, nxDomainWithSOA(3600, 120))
+			sut.put("first.com", 1025, nxDomainWithSOA(3600, 60))
+			sut.put("other.com", 1025, nxDomainWithSOA(3600, 120))
+
+			_, found := sut.get("first.com", 1025)
+			Expect(found).Should(BeFalse())
+			_, found = sut.get("example.com", 1025)
+			Expect(found).Should(BeTrue())
+			_, found = sut.get("other.com", 1025)
+			Expect(found).Should(BeTrue())
+			Expect(sut.cache.ItemCount()).Should(Equal(2))
+		})
+		It("should evict a tenth of the verdicts at once", func() {
+			sut = newVerdictCache(config.VerdictCacheConfig{MaxEntries: 20})
+			for i := 0; i < 20; i++ {
+				sut.put(fmt.Sprintf("domain%d.com", i), 1025, nxDomainWithSOA(3600, uint32(60+i)))
+			}
+
+			sut.put("other.com", 1025, nxDomainWithSOA(3600, 120))
+			Expect(sut.cache.ItemCount()).Should(Equal(19))
+
+			for _, domain := range []string{"domain0.com", "domain1.com"} {
+				_, found := sut.get(domain, 1025)
+				Expect(found).Should(BeFalse())
+			}
+
+			_, found := sut.get("domain2.com", 1025)
+			Expect(found).Should(BeTrue())
+
+			sut.put("next.com", 1025, nxDomainWithSOA(3600, 120))
+			Expect(sut.cache.ItemCount()).Should(Equal(20))
+		})
+		It("should replace an existing verdict without eviction", func() {
+			sut.put("example.com", 1025, nxDomainWithSOA(3600, 120))
+			sut.put("example.com", 1025, new(dns.Msg))
+
+			rcode, found := sut.get("example.com", 1025)
+			Expect(found).Should(BeTrue())
+			Expect(rcode).Should(Equal(dns.RcodeSuccess))
+		})
+	})
+
+	When("response is a failure", func() {
+		It("should not cache SERVFAIL and REFUSED", func() {
+			for _, rcode := range []int{dns.RcodeServerFailure, dns.RcodeRefused} {
+				msg := nxDomainWithSOA(3600, 120)
+				msg.Rcode = rcode
+				sut.put("example.com", 1025, msg)
+
+				_, found := sut.get("example.com", 1025)
+				Expect(found).Should(BeFalse())
+			}
+		})
+	})
+
+	When("cache is disabled", func() {
+		BeforeEach(func() {
+			sut = newVerdictCache(config.VerdictCacheConfig{MaxEntries: -1})
+		})
+		It("should not cache verdicts", func() {
+			sut.put("example.com", 1025, nxDomainWithSOA(3600, 120))
+
+			_, found := sut.get("example.com", 1025)
+			Expect(found).Should(BeFalse())
+			Expect(sut.Configuration()).Should(Equal([]string{"deactivated"}))
+		})
+	})
+})
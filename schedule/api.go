@@ -0,0 +1,25 @@
+package schedule
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/stgnet/blocky/log"
+)
+
+// apiSchedules is the http endpoint to get the state of all schedules
+// @Summary Schedules
+// @Description returns all schedules with their current state and the attached blocking and cname groups
+// @Tags blocking
+// @Produce  json
+// @Success 200 {array} api.ScheduleStatus "all schedules sorted by name"
+// @Router /schedules [get]
+func (r *Registry) apiSchedules(rw http.ResponseWriter, _ *http.Request) {
+	response, _ := json.Marshal(r.Status())
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if _, err := rw.Write(response); err != nil {
+		log.Logger.Error("unable to write response ", err)
+	}
+}
@@ -0,0 +1,259 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+
+	"github.com/go-chi/chi"
+)
+
+// Schedule is active on certain days of week during certain time ranges
+type Schedule struct {
+	Name   string
+	days   map[time.Weekday]bool
+	ranges []timeRange
+	loc    *time.Location
+}
+
+// timeRange contains start and end as minutes after midnight, end < start means the range ends on the next day
+type timeRange struct {
+	from, to int
+}
+
+// New creates a schedule from its configuration
+func New(name string, cfg config.ScheduleConfig) (*Schedule, error) {
+	if err := config.ValidateSchedule(name, &cfg); err != nil {
+		return nil, err
+	}
+
+	s := &Schedule{Name: name, days: make(map[time.Weekday]bool), loc: time.Local}
+
+	// LoadLocation returns UTC for an empty name, but empty means local time
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("schedule '%s' has invalid timezone '%s': %w", name, cfg.Timezone, err)
+		}
+
+		s.loc = loc
+	}
+
+	for _, d := range cfg.Days {
+		days, _ := config.ParseWeekdays(d)
+		for _, day := range days {
+			s.days[day] = true
+		}
+	}
+
+	if len(cfg.Days) == 0 {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			s.days[d] = true
+		}
+	}
+
+	for _, t := range cfg.Times {
+		from, to, _ := config.ParseTimeRange(t)
+		s.ranges = append(s.ranges, timeRange{from: from, to: to})
+	}
+
+	if len(cfg.Times) == 0 {
+		s.ranges = []timeRange{{from: 0, to: 24 * 60}}
+	}
+
+	return s, nil
+}
+
+// Active returns true if t is inside one of the time ranges on one of the days. A range, which ends on the
+// next day, belongs to the day of its start
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.loc)
+	day := t.Weekday()
+	yesterday := (day + 6) % 7
+	minute := t.Hour()*60 + t.Minute()
+
+	for _, r := range s.ranges {
+		if r.from < r.to {
+			if s.days[day] && minute >= r.from && minute < r.to {
+				return true
+			}
+
+			continue
+		}
+
+		if (s.days[day] && minute >= r.from) || (s.days[yesterday] && minute < r.to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Registry contains all schedules and the blocking and cname groups, which are attached to them
+type Registry struct {
+	schedules map[string]*Schedule
+	blocking  map[string][]*Schedule
+	cname     map[string][]*Schedule
+	now       func() time.Time
+}
+
+// NewRegistry creates the schedules and resolves the references of blocking and cname groups
+func NewRegistry(cfg map[string]config.ScheduleConfig, blockingGroups map[string][]string,
+	cnameGroups map[string]config.Groups) (*Registry, error) {
+	r := &Registry{
+		schedules: make(map[string]*Schedule),
+		blocking:  make(map[string][]*Schedule),
+		cname:     make(map[string][]*Schedule),
+		now:       time.Now,
+	}
+
+	for name, scheduleCfg := range cfg {
+		s, err := New(name, scheduleCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		r.schedules[name] = s
+	}
+
+	resolve := func(kind, group string, names []string, target map[string][]*Schedule) error {
+		for _, name := range names {
+			s, found := r.schedules[name]
+			if !found {
+				return fmt.Errorf("%s group '%s' references unknown schedule '%s'", kind, group, name)
+			}
+
+			target[group] = append(target[group], s)
+		}
+
+		return nil
+	}
+
+	for group, names := range blockingGroups {
+		if err := resolve("blocking", group, names, r.blocking); err != nil {
+			return nil, err
+		}
+	}
+
+	for group, g := range cnameGroups {
+		if err := resolve("cname", group, g.Schedules, r.cname); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// BlockingGroups returns the groups without blocking groups, whose schedules are all inactive
+func (r *Registry) BlockingGroups(groups []string) []string {
+	if r == nil {
+		return groups
+	}
+
+	return r.filter(r.blocking, groups)
+}
+
+// CnameGroups returns the groups without cname groups, whose schedules are all inactive
+func (r *Registry) CnameGroups(groups []string) []string {
+	if r == nil {
+		return groups
+	}
+
+	return r.filter(r.cname, groups)
+}
+
+func (r *Registry) filter(attached map[string][]*Schedule, groups []string) []string {
+	if len(attached) == 0 {
+		return groups
+	}
+
+	now := r.now()
+	result := make([]string, 0, len(groups))
+
+	for _, g := range groups {
+		schedules, found := attached[g]
+		if !found || anyActive(schedules, now) {
+			result = append(result, g)
+		}
+	}
+
+	return result
+}
+
+func anyActive(schedules []*Schedule, t time.Time) bool {
+	for _, s := range schedules {
+		if s.Active(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Status returns all schedules sorted by name with their current state and attached groups
+func (r *Registry) Status() []api.ScheduleStatus {
+	result := make([]api.ScheduleStatus, 0)
+	if r == nil {
+		return result
+	}
+
+	now := r.now()
+
+	for name, s := range r.schedules {
+		result = append(result, api.ScheduleStatus{
+			Name:           name,
+			Active:         s.Active(now),
+			BlockingGroups: attachedGroups(r.blocking, s),
+			CnameGroups:    attachedGroups(r.cname, s),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func attachedGroups(attached map[string][]*Schedule, s *Schedule) (result []string) {
+	for group, schedules := range attached {
+		for _, gs := range schedules {
+			if gs == s {
+				result = append(result, group)
+				break
+			}
+		}
+	}
+
+	sort.Strings(result)
+
+	return
+}
+
+// Configuration returns the schedules with their state
+func (r *Registry) Configuration() (result []string) {
+	for _, s := range r.Status() {
+		state := "inactive"
+		if s.Active {
+			state = "active"
+		}
+
+		result = append(result, fmt.Sprintf("%s = %s, blocking groups [%s], cname groups [%s]", s.Name, state,
+			strings.Join(s.BlockingGroups, ", "), strings.Join(s.CnameGroups, ", ")))
+	}
+
+	if len(result) == 0 {
+		result = []string{"no schedules defined"}
+	}
+
+	return
+}
+
+// RegisterAPIEndpoints registers the REST endpoint with the state of all schedules
+func (r *Registry) RegisterAPIEndpoints(router chi.Router) {
+	router.Get(api.SchedulesPath, r.apiSchedules)
+}
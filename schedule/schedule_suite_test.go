@@ -0,0 +1,16 @@
+package schedule
+
+import (
+	"testing"
+
+	"github.com/stgnet/blocky/log"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSchedule(t *testing.T) {
+	log.NewLogger("Warn", "text")
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Schedule Suite")
+}
@@ -0,0 +1,142 @@
+package schedule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/stgnet/blocky/api"
+	"github.com/stgnet/blocky/config"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schedule", func() {
+	// 2021-03-01 is a monday
+	at := func(day int, clock string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", "2021-03-0"+strconv.Itoa(day)+" "+clock, time.UTC)
+		return t
+	}
+
+	schoolNights, _ := New("schoolNights", config.ScheduleConfig{
+		Days:     []string{"sun-thu"},
+		Times:    []string{"20:00-06:00"},
+		Timezone: "UTC",
+	})
+
+	DescribeTable("Active",
+		func(s *Schedule, t time.Time, expected bool) {
+			Expect(s.Active(t)).Should(Equal(expected))
+		},
+		Entry("monday evening", schoolNights, at(1, "21:00"), true),
+		Entry("tuesday morning belongs to monday night", schoolNights, at(2, "05:59"), true),
+		Entry("tuesday after end", schoolNights, at(2, "06:00"), false),
+		Entry("monday afternoon", schoolNights, at(1, "15:00"), false),
+		Entry("friday evening", schoolNights, at(5, "21:00"), false),
+		Entry("saturday morning belongs to friday", schoolNights, at(6, "05:00"), false),
+		Entry("monday morning belongs to sunday night", schoolNights, at(1, "05:00"), true),
+	)
+
+	It("should be active the whole day without times", func() {
+		weekend, err := New("weekend", config.ScheduleConfig{Days: []string{"saturday", "sun"}, Timezone: "UTC"})
+		Expect(err).Should(Succeed())
+
+		Expect(weekend.Active(at(6, "00:00"))).Should(BeTrue())
+		Expect(weekend.Active(at(7, "23:59"))).Should(BeTrue())
+		Expect(weekend.Active(at(1, "00:00"))).Should(BeFalse())
+	})
+
+	It("should use the timezone", func() {
+		s, err := New("evening", config.ScheduleConfig{Times: []string{"18:00-24:00"}, Timezone: "Europe/Berlin"})
+		Expect(err).Should(Succeed())
+
+		// 17:30 UTC is 18:30 in Berlin (winter time)
+		Expect(s.Active(at(1, "17:30"))).Should(BeTrue())
+		Expect(s.Active(at(1, "16:30"))).Should(BeFalse())
+	})
+
+	It("should use local time without timezone", func() {
+		s, err := New("evening", config.ScheduleConfig{Times: []string{"18:00-24:00"}})
+		Expect(err).Should(Succeed())
+		Expect(s.loc).Should(BeIdenticalTo(time.Local))
+	})
+
+	It("should reject invalid schedules", func() {
+		_, err := New("invalid", config.ScheduleConfig{Days: []string{"someday"}})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("invalid day of week 'someday'"))
+
+		_, err = New("invalid", config.ScheduleConfig{Days: []string{"mon"}, Timezone: "Mars/Olympus"})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("invalid timezone 'Mars/Olympus'"))
+	})
+})
+
+var _ = Describe("Registry", func() {
+	var sut *Registry
+
+	BeforeEach(func() {
+		var err error
+		sut, err = NewRegistry(map[string]config.ScheduleConfig{
+			"schoolNights": {Days: []string{"sun-thu"}, Times: []string{"20:00-06:00"}, Timezone: "UTC"},
+			"weekend":      {Days: []string{"sat-sun"}, Timezone: "UTC"},
+		}, map[string][]string{
+			"social": {"schoolNights"},
+			"games":  {"schoolNights", "weekend"},
+		}, map[string]config.Groups{
+			"youtube": {Cname: "restrict.youtube.com", Schedules: []string{"weekend"}},
+			"other":   {Cname: "restrict.youtube.com"},
+		})
+		Expect(err).Should(Succeed())
+
+		// monday 21:00
+		sut.now = func() time.Time { return time.Date(2021, 3, 1, 21, 0, 0, 0, time.UTC) }
+	})
+
+	It("should remove groups with inactive schedules", func() {
+		Expect(sut.BlockingGroups([]string{"ads", "games", "social"})).Should(Equal([]string{"ads", "games", "social"}))
+		Expect(sut.CnameGroups([]string{"other", "youtube"})).Should(Equal([]string{"other"}))
+
+		// saturday 12:00
+		sut.now = func() time.Time { return time.Date(2021, 3, 6, 12, 0, 0, 0, time.UTC) }
+
+		Expect(sut.BlockingGroups([]string{"ads", "games", "social"})).Should(Equal([]string{"ads", "games"}))
+		Expect(sut.CnameGroups([]string{"other", "youtube"})).Should(Equal([]string{"other", "youtube"}))
+	})
+
+	It("should return the state of all schedules via API", func() {
+		router := chi.NewRouter()
+		sut.RegisterAPIEndpoints(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, api.SchedulesPath, nil))
+		Expect(rr.Code).Should(Equal(http.StatusOK))
+
+		var result []api.ScheduleStatus
+		Expect(json.NewDecoder(rr.Body).Decode(&result)).Should(Succeed())
+		Expect(result).Should(Equal([]api.ScheduleStatus{
+			{Name: "schoolNights", Active: true, BlockingGroups: []string{"games", "social"}},
+			{Name: "weekend", Active: false, BlockingGroups: []string{"games"}, CnameGroups: []string{"youtube"}},
+		}))
+	})
+
+	It("should reject references to unknown schedules", func() {
+		_, err := NewRegistry(nil, map[string][]string{"social": {"unknown"}}, nil)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("unknown schedule 'unknown'"))
+	})
+
+	When("registry is nil", func() {
+		It("should keep all groups", func() {
+			var registry *Registry
+
+			Expect(registry.BlockingGroups([]string{"social"})).Should(Equal([]string{"social"}))
+			Expect(registry.Status()).Should(BeEmpty())
+		})
+	})
+})
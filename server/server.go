@@ -1,13 +1,18 @@
 package server
 
 import (
-	"github.com/stgnet/blocky/log"
+	"context"
+	"errors"
 	"net/http"
 	"runtime"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/stgnet/blocky/clients"
 	"github.com/stgnet/blocky/config"
+	"github.com/stgnet/blocky/log"
 	"github.com/stgnet/blocky/metrics"
 	"github.com/stgnet/blocky/resolver"
 
@@ -26,9 +31,21 @@ type Server struct {
 	tcpServer     *dns.Server
 	httpListener  net.Listener
 	httpsListener net.Listener
-	queryResolver resolver.Resolver
+	pipeline      atomic.Value
+	reloadLock    sync.Mutex
 	cfg           *config.Config
 	httpMux       *chi.Mux
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+// queryPipeline is the resolver chain with its configuration and API endpoints. It will be replaced as a whole
+// on config reload
+type queryPipeline struct {
+	resolver resolver.Resolver
+	router   *chi.Mux
+	cfg      *config.Config
+	clients  *clients.Registry
 }
 
 func logger() *logrus.Entry {
@@ -78,18 +95,26 @@ func NewServer(cfg *config.Config) (server *Server, err error) {
 		metrics.Start(router, cfg.Prometheus)
 	}
 
-	queryResolver := createQueryResolver(cfg, router)
+	pipeline, err := newQueryPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 
 	server = &Server{
 		udpServer:     udpServer,
 		tcpServer:     tcpServer,
-		queryResolver: queryResolver,
 		cfg:           cfg,
 		httpListener:  httpListener,
 		httpsListener: httpsListener,
 		httpMux:       router,
+		ctx:           ctx,
+		cancel:        cancel,
 	}
 
+	server.pipeline.Store(pipeline)
+
 	server.printConfiguration()
 
 	server.registerDNSHandlers(udpServer)
@@ -99,19 +124,103 @@ func NewServer(cfg *config.Config) (server *Server, err error) {
 	return server, nil
 }
 
-func createQueryResolver(cfg *config.Config, router *chi.Mux) resolver.Resolver {
-	return resolver.Chain(
-		resolver.NewClientNamesResolver(cfg.ClientLookup),
-		resolver.NewQueryLoggingResolver(cfg.QueryLog),
-		resolver.NewStatsResolver(),
-		resolver.NewMetricsResolver(cfg.Prometheus),
-		resolver.NewConditionalUpstreamResolver(cfg.Conditional),
-		resolver.NewCustomDNSResolver(cfg.CustomDNS),
-		resolver.NewCnameResolver(cfg.Cname),
-		resolver.NewBlockingResolver(router, cfg.Blocking),
-		resolver.NewCachingResolver(cfg.Caching),
-		resolver.NewParallelBestResolver(cfg.Upstream),
-	)
+func newQueryPipeline(cfg *config.Config) (*queryPipeline, error) {
+	router := chi.NewRouter()
+
+	pc := &resolver.PipelineContext{
+		Cfg:    cfg,
+		Router: router,
+	}
+
+	queryResolver, err := createQueryResolver(pc)
+	if err != nil {
+		return nil, fmt.Errorf("can't create resolver pipeline: %v", err)
+	}
+
+	return &queryPipeline{
+		resolver: queryResolver,
+		router:   router,
+		cfg:      cfg,
+		clients:  pc.Clients,
+	}, nil
+}
+
+func createQueryResolver(pc *resolver.PipelineContext) (resolver.Resolver, error) {
+	pipeline := pc.Cfg.Pipeline
+	if len(pipeline) == 0 {
+		pipeline = resolver.DefaultPipeline
+	}
+
+	return resolver.NewPipeline(pipeline, pc)
+}
+
+func (s *Server) currentPipeline() *queryPipeline {
+	return s.pipeline.Load().(*queryPipeline)
+}
+
+func (s *Server) queryResolver() resolver.Resolver {
+	return s.currentPipeline().resolver
+}
+
+// Reload reads the config file again and replaces the resolver pipeline. If the new configuration is invalid,
+// it will be rejected and the running pipeline is kept
+func (s *Server) Reload() error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	current := s.currentPipeline()
+
+	if current.cfg.Path == "" {
+		return errors.New("config file path is unknown, can't reload configuration")
+	}
+
+	logger().Infof("reloading configuration from '%s'", current.cfg.Path)
+
+	cfg, err := config.LoadConfig(current.cfg.Path)
+	if err != nil {
+		return err
+	}
+
+	pipeline, err := newQueryPipeline(&cfg)
+	if err != nil {
+		return err
+	}
+
+	// runtime changes are kept also without state file
+	if err = pipeline.clients.TakeOver(current.clients); err != nil {
+		resolver.StopChain(pipeline.resolver)
+
+		return fmt.Errorf("can't take over clients: %w", err)
+	}
+
+	resolver.TransferState(current.resolver, pipeline.resolver)
+
+	s.pipeline.Store(pipeline)
+
+	resolver.StopChain(current.resolver)
+
+	log.NewLogger(cfg.LogLevel, cfg.LogFormat)
+
+	if restartRequired(current.cfg, &cfg) {
+		logger().Warn("changes of ports, certificates, prometheus or bootstrap DNS configuration require a restart")
+	}
+
+	logger().Info("configuration reloaded")
+
+	s.printConfiguration()
+
+	return nil
+}
+
+// returns true, if the changed configuration can't be applied without restart
+func restartRequired(oldCfg, newCfg *config.Config) bool {
+	return oldCfg.Port != newCfg.Port ||
+		oldCfg.HTTPPort != newCfg.HTTPPort ||
+		oldCfg.HTTPSPort != newCfg.HTTPSPort ||
+		oldCfg.CertFile != newCfg.CertFile ||
+		oldCfg.KeyFile != newCfg.KeyFile ||
+		oldCfg.Prometheus != newCfg.Prometheus ||
+		oldCfg.BootstrapDNS != newCfg.BootstrapDNS
 }
 
 func (s *Server) registerDNSHandlers(server *dns.Server) {
@@ -123,7 +232,7 @@ func (s *Server) registerDNSHandlers(server *dns.Server) {
 func (s *Server) printConfiguration() {
 	logger().Info("current configuration:")
 
-	res := s.queryResolver
+	res := s.queryResolver()
 	for res != nil {
 		logger().Infof("-> resolver: '%s'", resolver.Name(res))
 
@@ -200,11 +309,17 @@ func (s *Server) Start() {
 	}()
 
 	registerPrintConfigurationTrigger(s)
+	registerReloadTrigger(s)
 }
 
 func (s *Server) Stop() {
 	logger().Info("Stopping server")
 
+	// cancel all in-flight queries
+	s.cancel()
+
+	resolver.StopChain(s.queryResolver())
+
 	if err := s.udpServer.Shutdown(); err != nil {
 		logger().Fatalf("stop %s listener failed: %v", s.udpServer.Net, err)
 	}
@@ -214,17 +329,27 @@ func (s *Server) Stop() {
 	}
 }
 
-func createResolverRequest(remoteAddress net.Addr, request *dns.Msg) *resolver.Request {
+// queryContext creates the context for a single query with the configured query deadline
+func (p *queryPipeline) queryContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if p.cfg.QueryTimeout > 0 {
+		return context.WithTimeout(parent, p.cfg.QueryTimeout)
+	}
+
+	return context.WithCancel(parent)
+}
+
+func createResolverRequest(ctx context.Context, remoteAddress net.Addr, request *dns.Msg) *resolver.Request {
 	clientIP := resolveClientIP(remoteAddress)
 
-	return newRequest(clientIP, request)
+	return newRequest(ctx, clientIP, request)
 }
 
-func newRequest(clientIP net.IP, request *dns.Msg) *resolver.Request {
+func newRequest(ctx context.Context, clientIP net.IP, request *dns.Msg) *resolver.Request {
 	return &resolver.Request{
 		ClientIP:  clientIP,
 		Req:       request,
 		RequestTS: time.Now(),
+		Ctx:       ctx,
 		Log: log.Logger.WithFields(logrus.Fields{
 			"question":  util.QuestionToString(request.Question),
 			"client_ip": clientIP,
@@ -235,14 +360,22 @@ func newRequest(clientIP net.IP, request *dns.Msg) *resolver.Request {
 func (s *Server) OnRequest(w dns.ResponseWriter, request *dns.Msg) {
 	logger().Debug("new request")
 
-	r := createResolverRequest(w.RemoteAddr(), request)
+	pipeline := s.currentPipeline()
 
-	response, err := s.queryResolver.Resolve(r)
+	ctx, cancel := pipeline.queryContext(s.ctx)
+	defer cancel()
 
-	if err != nil {
-		logger().Errorf("error on processing request: %v", err)
+	r := createResolverRequest(ctx, w.RemoteAddr(), request)
+
+	response, err := pipeline.resolver.Resolve(r)
+
+	switch {
+	case err != nil:
+		logQueryError(err)
 		dns.HandleFailed(w, request)
-	} else {
+	case response.Drop:
+		logger().Debug("dropping request without response")
+	default:
 		response.Res.MsgHdr.RecursionAvailable = request.MsgHdr.RecursionDesired
 
 		if err := w.WriteMsg(response.Res); err != nil {
@@ -251,6 +384,17 @@ func (s *Server) OnRequest(w dns.ResponseWriter, request *dns.Msg) {
 	}
 }
 
+func logQueryError(err error) {
+	switch {
+	case resolver.IsTimeout(err):
+		logger().Warnf("query deadline exceeded: %v", err)
+	case errors.Is(err, context.Canceled):
+		logger().Debugf("query was cancelled: %v", err)
+	default:
+		logger().Errorf("error on processing request: %v", err)
+	}
+}
+
 // Handler for docker health check. Just returns OK code without delegating to resolver chain
 func (s *Server) OnHealthCheck(w dns.ResponseWriter, request *dns.Msg) {
 	resp := new(dns.Msg)
@@ -19,3 +19,18 @@ func registerPrintConfigurationTrigger(s *Server) {
 		}
 	}()
 }
+
+func registerReloadTrigger(s *Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for {
+			<-signals
+
+			if err := s.Reload(); err != nil {
+				logger().Error("can't reload configuration, keeping running configuration: ", err)
+			}
+		}
+	}()
+}
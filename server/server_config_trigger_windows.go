@@ -2,3 +2,6 @@ package server
 
 func registerPrintConfigurationTrigger(s *Server) {
 }
+
+func registerReloadTrigger(s *Server) {
+}
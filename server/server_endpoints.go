@@ -4,8 +4,10 @@ import (
 	"github.com/stgnet/blocky/api"
 	"github.com/stgnet/blocky/config"
 	"github.com/stgnet/blocky/docs"
+	"github.com/stgnet/blocky/resolver"
 	"github.com/stgnet/blocky/util"
 	"github.com/stgnet/blocky/web"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -30,6 +32,10 @@ const (
 
 func (s *Server) registerAPIEndpoints(router *chi.Mux) {
 	router.Post(api.BlockingQueryPath, s.apiQuery)
+	router.Get(api.ConfigReloadPath, s.apiConfigReload)
+
+	// all other API endpoints are provided by resolvers of the current pipeline
+	router.Handle("/api/*", http.HandlerFunc(s.pipelineAPIHandler))
 
 	router.Get("/dns-query", s.dohGetRequestHandler)
 	router.Post("/dns-query", s.dohPostRequestHandler)
@@ -94,17 +100,29 @@ func (s *Server) processDohMessage(rawMsg []byte, rw http.ResponseWriter, req *h
 		return
 	}
 
-	r := newRequest(net.ParseIP(extractIP(req)), msg)
+	pipeline := s.currentPipeline()
+
+	ctx, cancel := pipeline.queryContext(req.Context())
+	defer cancel()
 
-	resResponse, err := s.queryResolver.Resolve(r)
+	r := newRequest(ctx, net.ParseIP(extractIP(req)), msg)
+
+	resResponse, err := pipeline.resolver.Resolve(r)
 
 	if err != nil {
-		logger().Error("unable to process query: ", err)
+		logQueryError(err)
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
 
 		return
 	}
 
+	if resResponse.Drop {
+		logger().Debug("dropping request without response")
+
+		// closes the connection (HTTP/1) or resets the stream (HTTP/2) without response
+		panic(http.ErrAbortHandler)
+	}
+
 	response := new(dns.Msg)
 	response.SetReply(msg)
 
@@ -123,6 +141,28 @@ func (s *Server) processDohMessage(rawMsg []byte, rw http.ResponseWriter, req *h
 	}
 }
 
+// pipelineAPIHandler delegates the request to the API endpoints of the current resolver pipeline
+func (s *Server) pipelineAPIHandler(rw http.ResponseWriter, req *http.Request) {
+	// reset the routing context: pipeline's router performs the routing on its own
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, nil)
+
+	s.currentPipeline().router.ServeHTTP(rw, req.WithContext(ctx))
+}
+
+// apiConfigReload is the http endpoint to reload the configuration
+// @Summary Reload configuration
+// @Description reads the config file and replaces the resolver pipeline. Invalid configuration will be rejected
+// @Tags config
+// @Success 200   "Configuration was reloaded"
+// @Failure 500   "Configuration is invalid, running configuration is kept"
+// @Router /config/reload [get]
+func (s *Server) apiConfigReload(rw http.ResponseWriter, _ *http.Request) {
+	if err := s.Reload(); err != nil {
+		logger().Error("can't reload configuration: ", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func extractIP(r *http.Request) string {
 	hostPort := r.Header.Get("X-FORWARDED-FOR")
 
@@ -148,7 +188,7 @@ func extractIP(r *http.Request) string {
 // @Accept  json
 // @Produce  json
 // @Param query body api.QueryRequest true "query data"
-// @Success 200 {object} api.QueryResult "query was executed"
+// @Success 200 {object} api.QueryResult "query was executed, dropped queries are marked as dropped"
 // @Failure 400   "Wrong request format"
 // @Router /query [post]
 func (s *Server) apiQuery(rw http.ResponseWriter, req *http.Request) {
@@ -179,10 +219,19 @@ func (s *Server) apiQuery(rw http.ResponseWriter, req *http.Request) {
 		query += "."
 	}
 
+	pipeline := s.currentPipeline()
+
+	ctx, cancel := pipeline.queryContext(req.Context())
+	defer cancel()
+
 	dnsRequest := util.NewMsgWithQuestion(query, qType)
-	r := createResolverRequest(nil, dnsRequest)
+	r := createResolverRequest(ctx, nil, dnsRequest)
 
-	response, err := s.queryResolver.Resolve(r)
+	if queryRequest.Explain {
+		r.Trace = resolver.NewTrace()
+	}
+
+	response, err := pipeline.resolver.Resolve(r)
 
 	if err != nil {
 		logger().Error("unable to process query: ", err)
@@ -191,12 +240,24 @@ func (s *Server) apiQuery(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	jsonResponse, _ := json.Marshal(api.QueryResult{
+	result := api.QueryResult{
 		Reason:       response.Reason,
 		ResponseType: response.RType.String(),
-		Response:     util.AnswerToString(response.Res.Answer),
-		ReturnCode:   dns.RcodeToString[response.Res.Rcode],
-	})
+	}
+
+	// a dropped query is not answered by the DNS server, there is no response and no return code
+	if response.Drop {
+		result.Dropped = true
+	} else {
+		result.Response = util.AnswerToString(response.Res.Answer)
+		result.ReturnCode = dns.RcodeToString[response.Res.Rcode]
+	}
+
+	if r.Trace != nil {
+		result.Trace = r.Trace.Steps()
+	}
+
+	jsonResponse, _ := json.Marshal(result)
 	_, err = rw.Write(jsonResponse)
 
 	if err != nil {
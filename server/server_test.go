@@ -9,10 +9,13 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
+	"os"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"time"
 
@@ -118,7 +121,7 @@ var _ = Describe("Running DNS server", func() {
 		BeforeEach(func() {
 			mockClientName = ""
 			// reset client cache
-			res := sut.queryResolver
+			res := sut.queryResolver()
 			for res != nil {
 				if t, ok := res.(*resolver.ClientNamesResolver); ok {
 					t.FlushCache()
@@ -280,6 +283,130 @@ var _ = Describe("Running DNS server", func() {
 		})
 	})
 
+	Describe("Blocking Rest API", func() {
+		When("Blocking status API is called", func() {
+			It("should be delegated to the blocking resolver of the pipeline", func() {
+				r, err := http.Get("http://localhost:4000/api/blocking/status")
+				Expect(err).Should(Succeed())
+				defer r.Body.Close()
+
+				Expect(r.StatusCode).Should(Equal(http.StatusOK))
+
+				var result api.BlockingStatus
+				err = json.NewDecoder(r.Body).Decode(&result)
+				Expect(err).Should(Succeed())
+				Expect(result.Enabled).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("Config reload", func() {
+		var (
+			server  *Server
+			cfgFile *os.File
+		)
+
+		writeConfig := func(mappedIP string) {
+			err := ioutil.WriteFile(cfgFile.Name(), []byte(fmt.Sprintf(`
+customDNS:
+  mapping:
+    reload.lan: %s
+port: 55558
+logLevel: warn`, mappedIP)), 0600)
+			Expect(err).Should(Succeed())
+		}
+
+		resolveReloadDomain := func() string {
+			response, err := server.queryResolver().Resolve(&resolver.Request{
+				ClientIP: net.ParseIP("192.168.178.99"),
+				Req:      util.NewMsgWithQuestion("reload.lan.", dns.TypeA),
+				Log:      logrus.NewEntry(logrus.New()),
+			})
+			Expect(err).Should(Succeed())
+
+			return util.AnswerToString(response.Res.Answer)
+		}
+
+		BeforeEach(func() {
+			cfgFile = TempFile("")
+			writeConfig("192.168.178.10")
+
+			cfg, err := config.LoadConfig(cfgFile.Name())
+			Expect(err).Should(Succeed())
+
+			server, err = NewServer(&cfg)
+			Expect(err).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			_ = os.Remove(cfgFile.Name())
+		})
+
+		When("config file was changed", func() {
+			It("should replace the resolver pipeline", func() {
+				Expect(resolveReloadDomain()).Should(Equal("A (192.168.178.10)"))
+
+				writeConfig("192.168.178.20")
+
+				httpCode, _ := DoGetRequest(api.ConfigReloadPath, server.apiConfigReload)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				Expect(resolveReloadDomain()).Should(Equal("A (192.168.178.20)"))
+			})
+		})
+
+		When("no state file is configured", func() {
+			It("should keep the clients and allow grants created via API", func() {
+				Expect(server.cfg.StateFile).Should(BeEmpty())
+
+				_, err := server.currentPipeline().clients.Put("phone", config.ClientConfig{
+					MAC:    []string{"11:22:33:44:55:66"},
+					Groups: []string{"adults"},
+				})
+				Expect(err).Should(Succeed())
+
+				httpCode, _ := DoGetRequest("/api/blocking/allow?client=phone&domain=example.com&duration=1h",
+					server.currentPipeline().router.ServeHTTP)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				Expect(server.Reload()).Should(Succeed())
+
+				Expect(server.currentPipeline().clients.Clients()).Should(HaveLen(1))
+
+				httpCode, body := DoGetRequest("/api/blocking/allow/list", server.currentPipeline().router.ServeHTTP)
+				Expect(httpCode).Should(Equal(http.StatusOK))
+
+				var grants []api.AllowGrant
+				Expect(json.NewDecoder(body).Decode(&grants)).Should(Succeed())
+				Expect(grants).Should(HaveLen(1))
+				Expect(grants[0].Client).Should(Equal("phone"))
+			})
+		})
+
+		When("new config file is invalid", func() {
+			It("should keep the running pipeline", func() {
+				current := server.queryResolver()
+
+				err := ioutil.WriteFile(cfgFile.Name(), []byte("malformed_config"), 0600)
+				Expect(err).Should(Succeed())
+
+				httpCode, _ := DoGetRequest(api.ConfigReloadPath, server.apiConfigReload)
+				Expect(httpCode).Should(Equal(http.StatusInternalServerError))
+
+				Expect(server.queryResolver()).Should(BeIdenticalTo(current))
+				Expect(resolveReloadDomain()).Should(Equal("A (192.168.178.10)"))
+			})
+		})
+
+		When("config file path is unknown", func() {
+			It("should return error", func() {
+				server.currentPipeline().cfg.Path = ""
+
+				Expect(server.Reload()).ShouldNot(Succeed())
+			})
+		})
+	})
+
 	Describe("Query Rest API", func() {
 		When("Query API is called", func() {
 			It("Should process the query", func() {
@@ -566,8 +693,56 @@ var _ = Describe("Running DNS server", func() {
 		})
 	})
 
+	Describe("dropped queries", func() {
+		var sut *Server
+
+		BeforeEach(func() {
+			sut = &Server{}
+			sut.pipeline.Store(&queryPipeline{resolver: &dropResolver{}, cfg: &config.Config{}})
+		})
+
+		It("should close the DoH connection without response", func() {
+			ts := httptest.NewServer(http.HandlerFunc(sut.dohGetRequestHandler))
+			defer ts.Close()
+
+			resp, err := http.Get(ts.URL + "?dns=AAABAAABAAAAAAAAA3d3dwdleGFtcGxlA2NvbQAAAQAB")
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should mark the query result as dropped", func() {
+			jsonValue, _ := json.Marshal(api.QueryRequest{Query: "example.com", Type: "A"})
+			rec := httptest.NewRecorder()
+
+			sut.apiQuery(rec, httptest.NewRequest(http.MethodPost, api.BlockingQueryPath, bytes.NewBuffer(jsonValue)))
+			Expect(rec.Code).Should(Equal(http.StatusOK))
+
+			var result api.QueryResult
+			Expect(json.NewDecoder(rec.Body).Decode(&result)).Should(Succeed())
+			Expect(result.Dropped).Should(BeTrue())
+			Expect(result.ReturnCode).Should(BeEmpty())
+		})
+	})
+
 })
 
+// dropResolver drops all queries
+type dropResolver struct{}
+
+func (r *dropResolver) Resolve(req *resolver.Request) (*resolver.Response, error) {
+	response := new(dns.Msg)
+	response.SetReply(req.Req)
+
+	return &resolver.Response{Res: response, RType: resolver.BLOCKED, Reason: "RPZ DROP", Drop: true}, nil
+}
+
+func (r *dropResolver) Configuration() []string {
+	return nil
+}
+
 func requestServer(request *dns.Msg) *dns.Msg {
 	conn, err := net.Dial("udp", ":55555")
 	if err != nil {
@@ -0,0 +1,127 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists runtime changes (which are not part of the configuration file) in a JSON file.
+// Each feature uses its own section of the file. A nil store or a store without path keeps nothing
+type Store struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewStore creates a store for the file, empty path disables the persistence
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the path of the state file
+func (s *Store) Path() string {
+	if s == nil {
+		return ""
+	}
+
+	return s.path
+}
+
+// Load reads the section into v. Returns false if the section does not exist
+func (s *Store) Load(section string, v interface{}) (bool, error) {
+	if s.Path() == "" {
+		return false, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sections, err := s.read()
+	if err != nil {
+		return false, err
+	}
+
+	raw, found := sections[section]
+	if !found {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, fmt.Errorf("can't parse section '%s' of state file '%s': %w", section, s.path, err)
+	}
+
+	return true, nil
+}
+
+// Save replaces the section with v, other sections are kept. The file is replaced atomically
+func (s *Store) Save(section string, v interface{}) error {
+	if s.Path() == "" {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sections, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	sections[section] = raw
+
+	data, err := json.MarshalIndent(sections, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("can't write state file: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("can't write state file: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("can't write state file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// read must be called with lock. A missing file is an empty state
+func (s *Store) read() (map[string]json.RawMessage, error) {
+	sections := make(map[string]json.RawMessage)
+
+	data, err := ioutil.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sections, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't read state file: %w", err)
+	}
+
+	if len(data) == 0 {
+		return sections, nil
+	}
+
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return nil, fmt.Errorf("can't parse state file '%s': %w", s.path, err)
+	}
+
+	return sections, nil
+}
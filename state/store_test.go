@@ -0,0 +1,92 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		dir  string
+		path string
+		sut  *Store
+	)
+
+	type entry struct {
+		Value string `json:"value"`
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "state")
+		Expect(err).Should(Succeed())
+
+		path = filepath.Join(dir, "state.json")
+		sut = NewStore(path)
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	When("state file does not exist", func() {
+		It("should load nothing", func() {
+			var e entry
+			found, err := sut.Load("section", &e)
+			Expect(err).Should(Succeed())
+			Expect(found).Should(BeFalse())
+		})
+	})
+
+	When("sections are saved", func() {
+		It("should keep all sections and load them with a new store", func() {
+			Expect(sut.Save("a", entry{Value: "1"})).Should(Succeed())
+			Expect(sut.Save("b", entry{Value: "2"})).Should(Succeed())
+			Expect(sut.Save("a", entry{Value: "3"})).Should(Succeed())
+
+			other := NewStore(path)
+
+			var e entry
+			found, err := other.Load("a", &e)
+			Expect(err).Should(Succeed())
+			Expect(found).Should(BeTrue())
+			Expect(e.Value).Should(Equal("3"))
+
+			found, err = other.Load("b", &e)
+			Expect(err).Should(Succeed())
+			Expect(found).Should(BeTrue())
+			Expect(e.Value).Should(Equal("2"))
+
+			files, _ := ioutil.ReadDir(dir)
+			Expect(files).Should(HaveLen(1))
+		})
+	})
+
+	When("state file is corrupt", func() {
+		It("should return error", func() {
+			Expect(ioutil.WriteFile(path, []byte("{no json"), 0600)).Should(Succeed())
+
+			var e entry
+			_, err := sut.Load("a", &e)
+			Expect(err).Should(HaveOccurred())
+			Expect(sut.Save("a", e)).ShouldNot(Succeed())
+		})
+	})
+
+	When("store has no path", func() {
+		It("should keep nothing", func() {
+			for _, s := range []*Store{nil, NewStore("")} {
+				Expect(s.Save("a", entry{Value: "1"})).Should(Succeed())
+
+				var e entry
+				found, err := s.Load("a", &e)
+				Expect(err).Should(Succeed())
+				Expect(found).Should(BeFalse())
+			}
+		})
+	})
+})